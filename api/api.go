@@ -2,56 +2,92 @@ package api
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/util"
 	"github.com/sirupsen/logrus"
 )
 
+// ErrorMessage -- error response body as sent by the API server
 type ErrorMessage struct {
 	Status string `json:"status"`
 	Code   int    `json:"code"`
 	Msg    string `json:"msg"`
 }
 
-func delete(endpoint string, params map[string]string, bodyType string, body []byte, auths ...config.Auth) (*http.Response, error) {
-	return _request("DELETE", endpoint, params, bodyType, body, auths...)
+// Client -- ondevice.io API client
+//
+// Unlike the package level functions (which use the credentials in auth.json and
+// http.DefaultClient), Clients are configured explicitly, their methods take a
+// context and return errors instead of exiting the process.
+// Clients are safe for concurrent use.
+type Client struct {
+	auth       config.Auth
+	httpClient *http.Client
 }
 
-func get(endpoint string, params map[string]string, auths ...config.Auth) (*http.Response, error) {
-	return _request("GET", endpoint, params, "", nil, auths...)
+// NewClient -- creates a Client using the given credentials
+//
+// If apiServer isn't empty, it overrides the credentials' API server URL.
+// If httpClient is nil, http.DefaultClient will be used.
+func NewClient(auth config.Auth, apiServer string, httpClient *http.Client) (*Client, error) {
+	if auth == nil {
+		return nil, ErrMissingAuth
+	}
+	if apiServer != "" {
+		auth = auth.WithAPIServer(apiServer)
+	}
+	if server := auth.APIServer(); server != "" {
+		if _, err := url.Parse(server); err != nil {
+			return nil, fmt.Errorf("malformed API server URL '%s': %s", server, err)
+		}
+	}
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	return &Client{
+		auth:       auth,
+		httpClient: httpClient,
+	}, nil
 }
 
-func post(endpoint string, params map[string]string, bodyType string, body []byte, auths ...config.Auth) (*http.Response, error) {
-	return _request("POST", endpoint, params, bodyType, body, auths...)
+// Auth -- returns the credentials this Client uses
+func (c *Client) Auth() config.Auth {
+	return c.auth
 }
 
-func _request(method string, endpoint string, params map[string]string, bodyType string, body []byte, auths ...config.Auth) (*http.Response, error) {
-	var auth config.Auth
+// defaultClient -- returns a Client using the given credentials (or the ones in auth.json)
+//
+// used by the package level functions
+func defaultClient(auths ...config.Auth) (*Client, error) {
+	if len(auths) > 0 {
+		return NewClient(auths[0], "", nil)
+	}
 
-	if auths == nil {
-		var a = config.LoadAuth()
-		var err error
-		if auth, err = a.GetClientAuth(); err != nil {
-			logrus.WithError(err).Fatal("missing client auth - try running 'ondevice login'")
-		}
-	} else {
-		auth = auths[0]
+	var auth, err = config.LoadAuth().GetClientAuth()
+	if err != nil {
+		return nil, ErrMissingAuth
 	}
+	return NewClient(auth, "", nil)
+}
 
-	url := auth.GetURL(endpoint, params, "https")
+func (c *Client) request(ctx context.Context, method string, endpoint string, params map[string]string, bodyType string, body []byte) (*http.Response, error) {
+	url := c.auth.GetURL(endpoint, params, "https")
 	logrus.Debugf("%s request to URL %s\n", method, url)
 	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
-		// TODO return err
-		logrus.WithError(err).Fatal("failed to create request")
 		return nil, err
 	}
-	req.Header.Add("Authorization", auth.GetAuthHeader())
+	req = req.WithContext(ctx)
+	req.Header.Add("Authorization", c.auth.GetAuthHeader())
 	req.Header.Add("User-agent", fmt.Sprintf("ondevice v%s", config.GetVersion()))
 
 	if body != nil {
@@ -60,47 +96,31 @@ func _request(method string, endpoint string, params map[string]string, bodyType
 		req.Header.Add("Content-type", bodyType)
 	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-
-	return resp, err
+	return c.httpClient.Do(req)
 }
 
-func deleteBody(endpoint string, params map[string]string, bodyType string, body []byte, auths ...config.Auth) ([]byte, error) {
-	return _getResponse(delete(endpoint, params, bodyType, body, auths...))
+func (c *Client) deleteBody(ctx context.Context, endpoint string, params map[string]string, bodyType string, body []byte) ([]byte, error) {
+	return _getResponse(c.request(ctx, "DELETE", endpoint, params, bodyType, body))
 }
 
-func getBody(endpoint string, params map[string]string, auths ...config.Auth) ([]byte, error) {
-	return _getResponse(get(endpoint, params, auths...))
+func (c *Client) getBody(ctx context.Context, endpoint string, params map[string]string) ([]byte, error) {
+	return _getResponse(c.request(ctx, "GET", endpoint, params, "", nil))
 }
 
-func postBody(endpoint string, params map[string]string, bodyType string, body []byte, auths ...config.Auth) ([]byte, error) {
-	return _getResponse(post(endpoint, params, bodyType, body, auths...))
+func (c *Client) postBody(ctx context.Context, endpoint string, params map[string]string, bodyType string, body []byte) ([]byte, error) {
+	return _getResponse(c.request(ctx, "POST", endpoint, params, bodyType, body))
 }
 
 func _getResponse(resp *http.Response, err error) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
+	defer resp.Body.Close()
 
-	var errMsg ErrorMessage
-	if resp.StatusCode != http.StatusOK {
-		errMsg = getErrorMessage(resp)
-
-		if resp.StatusCode == http.StatusUnauthorized {
-			return nil, fmt.Errorf("Authentication failed: %s", errMsg.Msg)
-		} else if resp.StatusCode == http.StatusTooManyRequests {
-			var delayStr = resp.Header.Get("X-Ratelimit-Delay")
-			return nil, fmt.Errorf("Error: Too many requests (try again in %ss)", delayStr)
-		}
-
-		// else
-		return nil, fmt.Errorf("Request error (code %d): %s", errMsg.Code, errMsg.Msg)
+	if err = _checkResponse(resp); err != nil {
+		return nil, err
 	}
 
-	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return nil, err
@@ -109,18 +129,40 @@ func _getResponse(resp *http.Response, err error) ([]byte, error) {
 	return body, nil
 }
 
-func deleteObject(tgtValue interface{}, endpoint string, params map[string]string, bodyType string, body []byte, auths ...config.Auth) error {
-	body, err := deleteBody(endpoint, params, bodyType, body, auths...)
+// _checkResponse -- returns an *Error for non-200 responses
+func _checkResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var errMsg = getErrorMessage(resp)
+	var rc = Error{
+		StatusCode: resp.StatusCode,
+		Message:    errMsg.Msg,
+	}
+	if errMsg.Code != 0 {
+		rc.APICode = errMsg.Code
+	} else {
+		rc.APICode = resp.StatusCode
+	}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		rc.RetryAfter = util.ParseRetryAfter(resp.Header)
+	}
+	return &rc
+}
+
+func (c *Client) deleteObject(ctx context.Context, tgtValue interface{}, endpoint string, params map[string]string, bodyType string, body []byte) error {
+	body, err := c.deleteBody(ctx, endpoint, params, bodyType, body)
 	return _getObject(tgtValue, body, err)
 }
 
-func getObject(tgtValue interface{}, endpoint string, params map[string]string, auths ...config.Auth) error {
-	body, err := getBody(endpoint, params, auths...)
+func (c *Client) getObject(ctx context.Context, tgtValue interface{}, endpoint string, params map[string]string) error {
+	body, err := c.getBody(ctx, endpoint, params)
 	return _getObject(tgtValue, body, err)
 }
 
-func postObject(tgtValue interface{}, endpoint string, params map[string]string, bodyType string, body []byte, auths ...config.Auth) error {
-	body, err := postBody(endpoint, params, bodyType, body, auths...)
+func (c *Client) postObject(ctx context.Context, tgtValue interface{}, endpoint string, params map[string]string, bodyType string, body []byte) error {
+	body, err := c.postBody(ctx, endpoint, params, bodyType, body)
 	return _getObject(tgtValue, body, err)
 }
 
@@ -137,32 +179,32 @@ func _getObject(tgtValue interface{}, body []byte, err error) error {
 	return nil
 }
 
+// getErrorMessage -- parses the body of an error response
+//
+// falls back to the response status if the body can't be parsed
 func getErrorMessage(resp *http.Response) ErrorMessage {
 	var contentType = strings.SplitN(resp.Header.Get("Content-type"), ";", 2)
-	var body []byte
-	var err error
-	var rc ErrorMessage
-
-	if len(contentType) < 2 {
-		logrus.Fatal("missing/malformed response content type: ", resp.Header.Get("Content-type"))
+	var rc = ErrorMessage{
+		Status: "error",
+		Code:   resp.StatusCode,
+		Msg:    resp.Status,
 	}
 
-	if body, err = ioutil.ReadAll(resp.Body); err != nil {
-		logrus.WithError(err).Fatal("failed to read response body")
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		logrus.WithError(err).Debug("failed to read error response body")
+		return rc
 	}
 
-	switch contentType[0] {
+	switch strings.TrimSpace(contentType[0]) {
 	case "text/plain":
-		rc.Code = resp.StatusCode
-		rc.Status = "error"
 		rc.Msg = string(body)
 	case "application/json":
 		if err = json.Unmarshal(body, &rc); err != nil {
-			logrus.Infof("response body: '%s'", string(body))
-			logrus.WithError(err).Fatalf("failed to parse response message (response: %s)", resp.Status)
+			logrus.WithError(err).Debugf("failed to parse error response (response: %s, body: '%s')", resp.Status, string(body))
 		}
 	default:
-		logrus.Fatal("unexpected error response format: ", resp.Header.Get("Content-type"))
+		logrus.Debug("unexpected error response format: ", resp.Header.Get("Content-type"))
 	}
 
 	return rc
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClient(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.1/devices":
+			w.Header().Set("Content-type", "application/json; charset=utf-8")
+			fmt.Fprint(w, `{"devices":[{"id":"demo.dev1","state":"online"},{"id":"demo.dev2","state":"offline"}]}`)
+		case "/v1.1/device/dev1/props":
+			w.Header().Set("Content-type", "application/json; charset=utf-8")
+			w.Header().Set("X-Ratelimit-Delay", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"status":"error","code":429,"msg":"slow down"}`)
+		case "/v1.1/device/dev2/props":
+			// echo the (JSON encoded) properties
+			var req struct {
+				Props map[string]interface{} `json:"props"`
+			}
+			if r.Method != "POST" || r.Header.Get("Content-type") != "application/json" || json.NewDecoder(r.Body).Decode(&req) != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-type", "application/json; charset=utf-8")
+			json.NewEncoder(w).Encode(map[string]interface{}{"props": map[string]interface{}{"dev2": req.Props}})
+		default:
+			// no content type -> used to call logrus.Fatal()
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	var c, err = NewClient(config.NewAuth("demo", "secret"), server.URL, nil)
+	assert.NoError(t, err)
+
+	devices, err := c.ListDevices(context.Background(), "online", false)
+	assert.NoError(t, err)
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, "dev1", devices[0].UnqualifiedID())
+	}
+
+	_, err = c.ListProperties(context.Background(), "dev1")
+	assert.True(t, IsRateLimited(err))
+	var apiErr *Error
+	if assert.True(t, errors.As(err, &apiErr)) {
+		assert.Equal(t, 5*time.Second, apiErr.RetryAfter)
+		assert.Equal(t, "slow down", apiErr.Message)
+	}
+
+	props, err := c.SetProperties(context.Background(), "dev2", map[string]interface{}{"name": "x", "count": 5, "tags": []string{"a", "b"}})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"name": "x", "count": float64(5), "tags": []interface{}{"a", "b"}}, props)
+
+	err = c.DeleteDevice(context.Background(), "unknown")
+	assert.True(t, IsNotFound(err))
+
+	var ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = c.ListDevices(ctx, "", false)
+	assert.Error(t, err)
+
+	_, err = NewClient(nil, "", nil)
+	assert.Equal(t, ErrMissingAuth, err)
+}
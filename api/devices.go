@@ -1,13 +1,12 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"net/url"
 	"strings"
 
 	"github.com/ondevice/ondevice/config"
-	"github.com/sirupsen/logrus"
 )
 
 // Device -- state info for a specific device
@@ -44,12 +43,57 @@ type propertyListResponse struct {
 
 // DeleteDevice -- remove a device (will fail if the device has recently been online)
 func DeleteDevice(devID string, auths ...config.Auth) error {
-	var _, err = deleteBody("/device/"+devID, nil, "", nil, auths...)
-	return err
+	var c, err = defaultClient(auths...)
+	if err != nil {
+		return err
+	}
+	return c.DeleteDevice(context.Background(), devID)
 }
 
 // ListDevices -- list your devices and their state
 func ListDevices(state string, props bool, auths ...config.Auth) ([]Device, error) {
+	var c, err = defaultClient(auths...)
+	if err != nil {
+		return nil, err
+	}
+	return c.ListDevices(context.Background(), state, props)
+}
+
+// ListProperties -- Query device properties
+func ListProperties(devID string, auths ...config.Auth) (map[string]interface{}, error) {
+	var c, err = defaultClient(auths...)
+	if err != nil {
+		return nil, err
+	}
+	return c.ListProperties(context.Background(), devID)
+}
+
+// RemoveProperties -- remove one or more device properties
+func RemoveProperties(devID string, props []string, auths ...config.Auth) (map[string]interface{}, error) {
+	var c, err = defaultClient(auths...)
+	if err != nil {
+		return nil, err
+	}
+	return c.RemoveProperties(context.Background(), devID, props)
+}
+
+// SetProperties -- Set device property values (strings, numbers, bools, lists or objects)
+func SetProperties(devID string, props map[string]interface{}, auths ...config.Auth) (map[string]interface{}, error) {
+	var c, err = defaultClient(auths...)
+	if err != nil {
+		return nil, err
+	}
+	return c.SetProperties(context.Background(), devID, props)
+}
+
+// DeleteDevice -- remove a device (will fail if the device has recently been online)
+func (c *Client) DeleteDevice(ctx context.Context, devID string) error {
+	var _, err = c.deleteBody(ctx, "/device/"+devID, nil, "", nil)
+	return err
+}
+
+// ListDevices -- list your devices and their state (if state isn't empty, only devices in that state are returned)
+func (c *Client) ListDevices(ctx context.Context, state string, props bool) ([]Device, error) {
 	var resp deviceResponse
 	params := map[string]string{}
 
@@ -57,7 +101,7 @@ func ListDevices(state string, props bool, auths ...config.Auth) ([]Device, erro
 		params["props"] = "true"
 	}
 
-	if err := getObject(&resp, "/devices", params, auths...); err != nil {
+	if err := c.getObject(ctx, &resp, "/devices", params); err != nil {
 		return nil, err
 	}
 
@@ -75,53 +119,47 @@ func ListDevices(state string, props bool, auths ...config.Auth) ([]Device, erro
 }
 
 // ListProperties -- Query device properties
-func ListProperties(devID string, auths ...config.Auth) (map[string]interface{}, error) {
+func (c *Client) ListProperties(ctx context.Context, devID string) (map[string]interface{}, error) {
 	var rc propertyListResponse
-	err := getObject(&rc, "/device/"+devID+"/props", nil, auths...)
+	err := c.getObject(ctx, &rc, "/device/"+devID+"/props", nil)
 	return _propertyList(rc, err)
 }
 
 // RemoveProperties -- remove one or more device properties
-func RemoveProperties(devID string, props []string, auths ...config.Auth) (map[string]interface{}, error) {
+func (c *Client) RemoveProperties(ctx context.Context, devID string, props []string) (map[string]interface{}, error) {
 	var rc propertyListResponse
-	values := url.Values{}
 
 	if len(props) == 0 {
 		return nil, fmt.Errorf("Can't delete empty list of properties")
 	}
 
-	for _, prop := range props {
-		values.Add(prop, "")
-	}
-
 	obj := map[string][]string{"props": props}
 	data, _ := json.Marshal(obj)
 
-	err := deleteObject(&rc, "/device/"+devID+"/props", nil, "application/json", data, auths...)
+	err := c.deleteObject(ctx, &rc, "/device/"+devID+"/props", nil, "application/json", data)
 	return _propertyList(rc, err)
 }
 
-// SetProperties -- Set device property values
-func SetProperties(devID string, props map[string]string, auths ...config.Auth) (map[string]interface{}, error) {
+// SetProperties -- Set device property values (strings, numbers, bools, lists or objects)
+func (c *Client) SetProperties(ctx context.Context, devID string, props map[string]interface{}) (map[string]interface{}, error) {
 	var rc propertyListResponse
-	values := url.Values{}
 
 	if len(props) == 0 {
 		return nil, fmt.Errorf("Can't set empty list of properties")
 	}
 
-	for k, v := range props {
-		values.Add(k, v)
+	obj := map[string]interface{}{"props": props}
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return nil, err
 	}
 
-	// TODO use the JSON request here
-	err := postObject(&rc, "/device/"+devID+"/props", nil, "application/x-www-form-urlencoded", []byte(values.Encode()), auths...)
+	err = c.postObject(ctx, &rc, "/device/"+devID+"/props", nil, "application/json", data)
 	return _propertyList(rc, err)
 }
 
 func _propertyList(data propertyListResponse, err error) (map[string]interface{}, error) {
 	if err != nil {
-		logrus.WithError(err).Fatal("couldn't get device properties")
 		return nil, err
 	}
 
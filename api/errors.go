@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrMissingAuth -- there are no client credentials (try running 'ondevice login')
+var ErrMissingAuth = errors.New("missing client auth - try running 'ondevice login'")
+
+// Error -- error response we got from the API server (implements util.APIError)
+type Error struct {
+	// StatusCode -- the response's HTTP status code
+	StatusCode int
+	// APICode -- the error code the API server sent us (usually matches StatusCode)
+	APICode int
+	// Message -- the error message the API server sent us
+	Message string
+	// RetryAfter -- for rate limited requests (StatusCode 429), this tells us how long to wait before trying again
+	RetryAfter time.Duration
+}
+
+// Code -- returns the HTTP status code (implements util.APIError)
+func (e *Error) Code() int {
+	return e.StatusCode
+}
+
+func (e *Error) Error() string {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return fmt.Sprintf("Authentication failed: %s", e.Message)
+	case http.StatusTooManyRequests:
+		return fmt.Sprintf("Error: Too many requests (try again in %s)", e.RetryAfter)
+	}
+	return fmt.Sprintf("Request error (code %d): %s", e.APICode, e.Message)
+}
+
+// IsNotFound -- returns true if err is an API error with status 404
+func IsNotFound(err error) bool {
+	return _hasStatus(err, http.StatusNotFound)
+}
+
+// IsUnauthorized -- returns true if err is an API error with status 401 (i.e. invalid credentials)
+func IsUnauthorized(err error) bool {
+	return _hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsRateLimited -- returns true if err is an API error with status 429 (see Error.RetryAfter)
+func IsRateLimited(err error) bool {
+	return _hasStatus(err, http.StatusTooManyRequests)
+}
+
+func _hasStatus(err error, status int) bool {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == status
+	}
+	return false
+}
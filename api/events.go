@@ -3,6 +3,7 @@ package api
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -39,8 +40,19 @@ type Event struct {
 	Data   map[string]interface{} `json:"data"`
 }
 
-// Listen -- Listen for account events
+// Listen -- Listen for account events (using the credentials in auth.json)
 func (e *EventListener) Listen(cb func(Event) error) error {
+	var c, err = defaultClient()
+	if err != nil {
+		return err
+	}
+	return c.Events(context.Background(), *e, cb)
+}
+
+// Events -- Listen for account events (calling cb for each of them)
+//
+// returns once the event stream ends, cb returns an error or ctx is done
+func (c *Client) Events(ctx context.Context, e EventListener, cb func(Event) error) error {
 	var resp *http.Response
 	var err error
 
@@ -66,7 +78,11 @@ func (e *EventListener) Listen(cb func(Event) error) error {
 	}
 
 	// send request
-	if resp, err = get("/event.stream", params); err != nil {
+	if resp, err = c.request(ctx, "GET", "/event.stream", params, "", nil); err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err = _checkResponse(resp); err != nil {
 		return err
 	}
 
@@ -78,7 +94,9 @@ func (e *EventListener) Listen(cb func(Event) error) error {
 	for true {
 		data, isPrefix, err := reader.ReadLine()
 		if err != nil {
-			if err != io.EOF {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			} else if err != io.EOF {
 				return err
 			} else {
 				break
@@ -1,6 +1,10 @@
 package api
 
-import "github.com/ondevice/ondevice/config"
+import (
+	"context"
+
+	"github.com/ondevice/ondevice/config"
+)
 
 // KeyInfo -- API key info
 type KeyInfo struct {
@@ -41,8 +45,17 @@ func (i KeyInfo) IsType(typeName string) bool {
 
 // GetKeyInfo -- Returns the role and permissions associated with the given credentials
 func GetKeyInfo(auth config.Auth) (KeyInfo, error) {
+	var c, err = NewClient(auth, "", nil)
+	if err != nil {
+		return KeyInfo{}, err
+	}
+	return c.GetKeyInfo(context.Background())
+}
+
+// GetKeyInfo -- Returns the role and permissions associated with the Client's credentials
+func (c *Client) GetKeyInfo(ctx context.Context) (KeyInfo, error) {
 	var rc KeyInfo
-	err := getObject(&rc, "/keyInfo", nil, auth)
+	err := c.getObject(ctx, &rc, "/keyInfo", nil)
 	if err != nil {
 		return rc, err
 	}
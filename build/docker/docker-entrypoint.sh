@@ -3,9 +3,6 @@
 # fix volume permissions
 chown -R ondevice:ondevice /home/ondevice/.config/
 
-# TODO as soon as `ondevice service` support exists, parse $SSH_ADDR
-# and call something like `ondevice service set ssh 'addr=$SSH_ADDR'
-
 # anything starting with a / will be run as-is
 if echo "$1" | grep -q ^/; then
 	exec "$@"
@@ -20,5 +17,13 @@ else
 		/usr/sbin/sshd -e
 	fi
 
+	if [ -n "$SSH_BUILTIN" ]; then
+		# use ondevice's built-in SSH server (authenticating users with ~ondevice/.ssh/authorized_keys)
+		su-exec ondevice ondevice service add ssh ssh builtin=true
+	elif [ -n "$SSH_ADDR" ]; then
+		# point the 'ssh' service to $SSH_ADDR
+		su-exec ondevice ondevice service add ssh ssh "addr=$SSH_ADDR"
+	fi
+
 	exec su-exec ondevice ondevice "$@"
 fi
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ondevice/ondevice/control"
+	"github.com/ondevice/ondevice/daemon"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// approveCmd represents the approve command
+var approveCmd = &cobra.Command{
+	Use:   "approve [id]...",
+	Short: "approve (or deny) incoming connections",
+	Long: `approve or deny connection requests waiting for the device's user's consent.
+
+Connections only have to be approved if 'device.require-approval' is set, e.g.:
+  $ ondevice config device.require-approval=true
+
+Without arguments, you'll be asked about each pending connection request.
+Requests nobody answers within 'device.approval-timeout' seconds (default: 25) will be
+rejected.
+
+If you specify tunnel IDs, they'll be approved (or denied if --deny is set) without asking.`,
+	Example: `  $ ondevice approve
+  Allow demo@198.51.100.17 to connect to 'ssh' (protocol: ssh, expires in 21s)? (y/N): y
+  $ ondevice approve --wait
+  $ ondevice approve --deny hwpnxcgo`,
+	Run: approveRun,
+}
+
+var approveDeny, approveWait bool
+
+func init() {
+	approveCmd.Flags().BoolVar(&approveDeny, "deny", false, "deny the given connection requests (instead of approving them)")
+	approveCmd.Flags().BoolVar(&approveWait, "wait", false, "keep waiting for new connection requests (until interrupted)")
+	rootCmd.AddCommand(approveCmd)
+}
+
+func approveRun(cmd *cobra.Command, args []string) {
+	if len(args) > 0 {
+		var failed = false
+		for _, id := range args {
+			if err := control.ApproveConnection(id, !approveDeny); err != nil {
+				logrus.WithError(err).Errorf("failed to answer connection request '%s'", id)
+				failed = true
+			}
+		}
+		if failed {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var reader = bufio.NewReader(os.Stdin)
+	var asked = make(map[string]bool)
+	for {
+		var pending, err = control.ListPending()
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to fetch pending connection requests (is 'ondevice daemon' running?)")
+		}
+
+		// only remember the requests that are still pending (the others won't show up again)
+		var stillPending = make(map[string]bool, len(pending))
+		var count = 0
+		for _, p := range pending {
+			stillPending[p.ID] = true
+			if asked[p.ID] {
+				continue
+			}
+			count++
+
+			var approve = approvePrompt(reader, p)
+			if err := control.ApproveConnection(p.ID, approve); err != nil {
+				logrus.WithError(err).Errorf("failed to answer connection request '%s' (has it expired?)", p.ID)
+			}
+		}
+		asked = stillPending
+
+		if !approveWait {
+			if count == 0 {
+				fmt.Println("no pending connection requests")
+			}
+			return
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// approvePrompt -- asks the user whether to approve the given connection request
+func approvePrompt(reader *bufio.Reader, p daemon.PendingConnection) bool {
+	for {
+		fmt.Printf("Allow %s@%s to connect to '%s' (protocol: %s, expires in %s)? (y/N): ",
+			p.ClientUser, p.ClientIP, p.Service, p.Protocol, time.Until(p.ExpiresAt).Round(time.Second))
+		var input, err = reader.ReadString('\n')
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to read your response")
+		}
+
+		switch strings.TrimSpace(strings.ToLower(input)) {
+		case "y", "yes":
+			return true
+		case "n", "no", "":
+			return false
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/daemon"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "query the device's connection audit log",
+	Long: `lists the connection attempts 'ondevice daemon' has recorded in its audit log.
+
+Connections are logged as soon as they've been accepted (or rejected), accepted ones
+get another 'closed' entry (with their duration and traffic) once they've ended.
+
+The log is written to path.audit_log (default: 'audit.log' next to ondevice.conf) as
+JSON lines and rotated once it reaches device.audit-max-size kB
+(keeping device.audit-backups old logs).
+
+--since and --until accept RFC3339 timestamps, dates (YYYY-MM-DD) or durations
+relative to now (e.g. '24h').`,
+	Example: `  $ ondevice audit --since=24h --service=ssh
+  TIME                  TUNNEL    SERVICE  PROTOCOL  CLIENT              RESULT    DURATION  RX     TX
+  2020-05-20T12:34:56Z  hwpnxcgo  ssh      ssh       demo@198.51.100.17  accepted  -         -      -
+  2020-05-20T12:40:08Z  hwpnxcgo  ssh      ssh       demo@198.51.100.17  closed    5m12s     3.1kB  12.4kB
+  2020-05-20T13:01:02Z  kmtqbxzs  ssh      ssh       eve@203.0.113.99    403       -         -      -`,
+	Run:  auditRun,
+	Args: cobra.NoArgs,
+}
+
+var auditSince, auditUntil, auditUser, auditService string
+var auditJSON bool
+
+func init() {
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "only show connection attempts after this time")
+	auditCmd.Flags().StringVar(&auditUntil, "until", "", "only show connection attempts before this time")
+	auditCmd.Flags().StringVar(&auditUser, "user", "", "only show connection attempts by this client user")
+	auditCmd.Flags().StringVar(&auditService, "service", "", "only show connection attempts to this service")
+	auditCmd.Flags().BoolVar(&auditJSON, "json", false, "print the matching entries as JSON lines")
+	rootCmd.AddCommand(auditCmd)
+}
+
+func auditRun(cmd *cobra.Command, args []string) {
+	var since, until time.Time
+	var err error
+	if since, err = auditParseTime(auditSince); err != nil {
+		logrus.WithError(err).Fatal("invalid --since value")
+	}
+	if until, err = auditParseTime(auditUntil); err != nil {
+		logrus.WithError(err).Fatal("invalid --until value")
+	}
+
+	var path = config.MustLoad().GetPath(config.PathAuditLog)
+	if path.Error() != nil {
+		logrus.WithError(path.Error()).Fatal("invalid audit log path")
+	}
+
+	var w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if !auditJSON {
+		fmt.Fprintln(w, "TIME\tTUNNEL\tSERVICE\tPROTOCOL\tCLIENT\tRESULT\tDURATION\tRX\tTX")
+	}
+
+	err = daemon.ReadAuditLog(path.GetAbsolutePath(), func(e daemon.AuditEntry) bool {
+		if (!since.IsZero() && e.Ts.Before(since)) ||
+			(!until.IsZero() && e.Ts.After(until)) ||
+			(auditUser != "" && e.ClientUser != auditUser) ||
+			(auditService != "" && e.Service != auditService) {
+			return true
+		}
+
+		if auditJSON {
+			var data, _ = json.Marshal(e)
+			fmt.Println(string(data))
+			return true
+		}
+
+		var client = e.ClientIP
+		if e.ClientUser != "" {
+			client = e.ClientUser + "@" + e.ClientIP
+		}
+		var result = "accepted"
+		if e.Event == daemon.AuditClose {
+			result = "closed"
+		}
+		if !e.Accepted {
+			result = fmt.Sprintf("%d", e.ErrorCode)
+		}
+
+		// connect entries don't have any stats yet (entries of older versions were only written on close)
+		var duration, rx, tx = "-", "-", "-"
+		if e.Event != daemon.AuditConnect {
+			duration = time.Duration(e.Duration * float64(time.Second)).Round(time.Second).String()
+			rx, tx = statusFormatBytes(e.BytesRead), statusFormatBytes(e.BytesWritten)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", e.Ts.Format(time.RFC3339), e.TunnelID, e.Service, e.Protocol,
+			client, result, duration, rx, tx)
+		return true
+	})
+	w.Flush()
+
+	if err != nil {
+		logrus.WithError(err).Fatal("failed to read audit log")
+	}
+}
+
+// auditParseTime -- parses RFC3339 timestamps, dates or durations (relative to now)
+func auditParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
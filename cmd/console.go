@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ondevice/ondevice/cmd/internal"
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/tunnel"
+	"github.com/ondevice/ondevice/util"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// consoleCmd -- interactive session with a device's serial console
+type consoleCmd struct {
+	cobra.Command
+}
+
+func init() {
+	var c consoleCmd
+	c.Command = cobra.Command{
+		Use:   "console <devId> <service>",
+		Short: "connects to a serial console attached to one of your devices",
+		Long: `connects your terminal to one of your device's 'serial' services (e.g. the
+console port of a router or PLC attached to the device).
+
+Your terminal is put into raw mode, so everything you type (including Ctrl-C)
+is sent to the serial port. Type ~. at the beginning of a line to disconnect.
+
+Only one client can use a serial port at a time.`,
+		Example: `- set up the service (on the device)
+  $ ondevice service add router serial path=/dev/ttyUSB0 baud=9600
+
+- connect to it
+  $ ondevice console myDev router`,
+		Run:               c.run,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: c.validateArgs,
+	}
+	rootCmd.AddCommand(&c.Command)
+}
+
+func (c *consoleCmd) run(cmd *cobra.Command, args []string) {
+	var devID, svc = args[0], args[1]
+
+	auth, err := config.LoadAuth().GetClientAuthForDevice(devID)
+	if err != nil {
+		logrus.WithError(err).Fatal("missing client credentials")
+		return
+	}
+
+	conn, e := tunnel.Dial(devID, svc, "serial", auth)
+	if e != nil {
+		util.FailWithAPIError(e)
+	}
+	defer conn.Close()
+
+	var fd = int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to put the terminal into raw mode")
+			return
+		}
+		defer terminal.Restore(fd, state)
+	}
+	fmt.Fprintf(os.Stderr, "connected to %s:%s (type ~. at the beginning of a line to disconnect)\r\n", devID, svc)
+
+	var done = make(chan struct{}, 2)
+	go func() {
+		io.Copy(os.Stdout, conn)
+		done <- struct{}{}
+	}()
+	go func() {
+		copyConsoleInput(conn, os.Stdin)
+		done <- struct{}{}
+	}()
+
+	<-done
+	fmt.Fprint(os.Stderr, "\r\ndisconnected\r\n")
+}
+
+// copyConsoleInput -- copies r to w until r's done (or the user types the escape sequence '~.' at the beginning of a line)
+func copyConsoleInput(w io.Writer, r io.Reader) error {
+	var buff = make([]byte, 1024)
+	var lineStart, tilde = true, false
+
+	for {
+		count, err := r.Read(buff)
+		if err != nil {
+			return err
+		}
+
+		var out = make([]byte, 0, count+1)
+		for _, b := range buff[:count] {
+			if tilde {
+				tilde = false
+				if b == '.' {
+					w.Write(out)
+					return nil
+				} else if b != '~' {
+					out = append(out, '~') // '~~' sends a single '~'
+				}
+			} else if lineStart && b == '~' {
+				tilde = true
+				continue
+			}
+
+			out = append(out, b)
+			lineStart = b == '\r' || b == '\n'
+		}
+
+		if _, err = w.Write(out); err != nil {
+			return err
+		}
+	}
+}
+
+// validateArgs -- does shell completion
+func (c *consoleCmd) validateArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return internal.DeviceListCompletion{DontIgnoreUser: true}.Run(cmd, args, toComplete)
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
@@ -61,6 +61,15 @@ Example Socket URLs:
 
 On the client side, set the ONDEVICE_HOST environment variable to match the
 socket parameter.
+
+Prometheus metrics are available at the control socket's /metrics endpoint.
+Use --metrics (or the device.metrics-addr config value) to also serve them
+on a TCP address (e.g. --metrics=127.0.0.1:9101).
+
+If the device.require-approval config value is set, incoming connections have to
+be approved by a local user first (see 'ondevice approve').
+
+Every connection attempt is recorded in the audit log (see 'ondevice audit').
 `,
 	Run: daemonRun,
 }
@@ -69,6 +78,7 @@ func init() {
 	rootCmd.AddCommand(daemonCmd)
 	daemonCmd.Flags().String("pidfile", "", "if set, overrides the config value set in path.ondevice_pid")
 	daemonCmd.Flags().String("sock", "", "if set, overrides the config vlaue set in path.ondevice_sock")
+	daemonCmd.Flags().String("metrics", "", "if set, overrides the config value set in device.metrics-addr")
 }
 
 func daemonRun(cmd *cobra.Command, args []string) {
@@ -89,6 +99,10 @@ func daemonRun(cmd *cobra.Command, args []string) {
 	}
 
 	c := control.NewSocket(d, *controlURL)
+	c.MetricsAddr = config.MustLoad().GetString(config.KeyDeviceMetricsAddr)
+	if metricsFlag := cmd.Flag("metrics").Value.String(); metricsFlag != "" {
+		c.MetricsAddr = metricsFlag
+	}
 	d.Control = c
 
 	d.Run()
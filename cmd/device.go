@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"sort"
 	"strings"
@@ -36,7 +37,10 @@ import (
 type deviceCmd struct {
 	cobra.Command
 
-	yesFlag bool
+	yesFlag      bool
+	filterFlags  []string
+	dryRunFlag   bool
+	parallelFlag int
 }
 
 func init() {
@@ -53,12 +57,26 @@ keep tracks of running maintenance scripts, etc.
   $ ondevice device <devId> props
 - add/update properties
   $ ondevice device <devId> set [key1=val1 ...]
+  values are strings unless you use ':=', which sets JSON values (numbers, bools,
+  lists or objects). ':=@path' reads the value from a JSON file, '@path' sets all the
+  properties of a JSON object (use '-' to read from stdin)
 - remove properties
   $ ondevice device <devId> rm [--yes/-y] [key1 key2 ...]
 
 Each invocation will print the resulting property list.
 This command requires a client key with the 'manage' permission.
 
+Bulk updates:
+  With --filter (instead of a devId), 'set' and 'rm' update all the devices matching
+  the filter expression (see 'ondevice list --help' for the syntax, specify --filter
+  multiple times to match all of them). 'ondevice device @group ...' updates all
+  the devices of the group (see 'ondevice group').
+  You'll be asked for confirmation first (unless you specify --yes), --dry-run only
+  lists the matching devices. Up to --parallel devices are updated at a time.
+  Once all of them are done, the failures are listed and 'ondevice device' exits
+  with status 1 if there were any. Special properties ('on:...') can't be changed
+  this way (i.e. devices can't be deleted), and reading values from stdin requires --yes.
+
 Have a look at ondevice list's filters for a simple way to list devices with specific properties.
 
 
@@ -76,11 +94,26 @@ Special properties:
   foo=bar
   $ ondevice device q5dkpm rm foo
   test=1234
+  $ ondevice device q5dkpm set count:=5 enabled:=true tags:='["a","b"]'
+  count=5
+  enabled=true
+  tags=["a","b"]
+  test=1234
+  $ ondevice device q5dkpm set config:=@config.json
 
   # rename and then delete the device (using the on:id special property)
   $ ondevice device q5dkpm set on:id=rpi
   $ ondevice device rpi rm on:id
-  Do you really want to delete the device 'rpi' (y/N):`,
+  Do you really want to delete the device 'rpi' (y/N):
+
+  # tag outdated devices (and remove the tag again)
+  $ ondevice device --filter 'on:version<0.6' set rollout=canary
+  Do you really want to update 3 devices (set rollout) (y/N): y
+  demo.7t91ta: ok
+  demo.fbqh2p: ok
+  demo.thm7br: ok
+  3 devices: 3 updated, 0 failed
+  $ ondevice device --filter rollout=canary rm rollout --yes`,
 		Run:               c.run,
 		ValidArgsFunction: c.validateArgs,
 	}
@@ -88,12 +121,30 @@ Special properties:
 	rootCmd.AddCommand(&c.Command)
 
 	c.Flags().BoolVarP(&c.yesFlag, "yes", "y", false, `don't ask before deleting a device (by removing the 'on:id' property).
-Has no effect on other properties.`)
+Has no effect on other properties.
+With --filter, this skips the confirmation prompt for the bulk update.`)
+	c.Flags().StringArrayVar(&c.filterFlags, "filter", nil, "update all the devices matching this filter expression (instead of a single devId)")
+	c.Flags().BoolVar(&c.dryRunFlag, "dry-run", false, "only list the devices --filter would update")
+	c.Flags().IntVarP(&c.parallelFlag, "parallel", "p", 10, "maximum number of devices to update at the same time (with --filter)")
 }
 
 func (c *deviceCmd) run(_ *cobra.Command, args []string) {
 	var err error
 
+	if len(args) > 0 && strings.HasPrefix(args[0], "@") {
+		// 'ondevice device @group ...' -> shorthand for --filter @group
+		c.filterFlags = append(c.filterFlags, args[0])
+		args = args[1:]
+	}
+
+	if len(c.filterFlags) > 0 {
+		c.runBulk(args)
+		return
+	} else if c.dryRunFlag {
+		logrus.Fatal("--dry-run requires --filter")
+		return
+	}
+
 	if len(args) < 1 {
 		err = errors.New("missing deviceId")
 	} else if len(args) < 2 {
@@ -158,31 +209,7 @@ func (c *deviceCmd) removeProperties(devID string, args []string, auth config.Au
 			logrus.Fatal("to delete a device, remove its 'on:id' property (and nothing else)")
 		}
 
-		var confirmed = c.yesFlag
-		if !confirmed {
-			var reader = bufio.NewReader(os.Stdin)
-			var input string
-			var err error
-
-			for input == "" {
-				fmt.Printf("Do you really want to delete the device '%s' (y/N): ", devID)
-				input, err = reader.ReadString('\n')
-				if err != nil {
-					logrus.WithError(err).Fatal("failed to read your response")
-				}
-
-				switch strings.TrimSpace(strings.ToLower(input)) {
-				case "y", "yes":
-					confirmed = true
-				case "n", "no", "":
-					confirmed = false
-					input = "no"
-				default:
-					input = ""
-				}
-			}
-		}
-
+		var confirmed = c.yesFlag || c.confirm(fmt.Sprintf("Do you really want to delete the device '%s'", devID))
 		if confirmed {
 			if err := api.DeleteDevice(devID, auth); err != nil {
 				return err
@@ -196,18 +223,114 @@ func (c *deviceCmd) removeProperties(devID string, args []string, auth config.Au
 	return c.printProperties(api.RemoveProperties(devID, args, auth))
 }
 
+// confirm -- asks the user the given yes/no question (returns false unless they answered yes)
+func (*deviceCmd) confirm(question string) bool {
+	var reader = bufio.NewReader(os.Stdin)
+	for {
+		fmt.Printf("%s (y/N): ", question)
+		var input, err = reader.ReadString('\n')
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to read your response")
+		}
+
+		switch strings.TrimSpace(strings.ToLower(input)) {
+		case "y", "yes":
+			return true
+		case "n", "no", "":
+			return false
+		}
+	}
+}
+
 func (c *deviceCmd) setProperties(devID string, args []string, auth config.Auth) error {
-	var props = make(map[string]string)
+	var props, err = parsePropertyArgs(args)
+	if err != nil {
+		return err
+	}
+
+	return c.printProperties(api.SetProperties(devID, props, auth))
+}
+
+// parsePropertyArgs -- parses 'ondevice device set' style arguments:
+//
+// - key=value (string value)
+// - key:=<JSON> (typed value, e.g. count:=5, enabled:=true or tags:='["a","b"]')
+// - key:=@<path> (JSON value read from a file, '-' reads from stdin)
+// - @<path> (JSON object containing multiple properties)
+func parsePropertyArgs(args []string) (map[string]interface{}, error) {
+	var props = make(map[string]interface{})
+	var setValue = func(key string, value interface{}) error {
+		if key == "" {
+			return errors.New("Missing property name")
+		} else if _, ok := props[key]; ok {
+			return fmt.Errorf("Duplicate value for property '%s'", key)
+		}
+		props[key] = value
+		return nil
+	}
 
 	for _, arg := range args {
+		if strings.HasPrefix(arg, "@") {
+			var obj map[string]interface{}
+			if err := _readJSONFile(arg[1:], &obj); err != nil {
+				return nil, err
+			}
+			for k, v := range obj {
+				if err := setValue(k, v); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
 		s := strings.SplitN(arg, "=", 2)
-		if _, ok := props[s[0]]; ok {
-			return fmt.Errorf("Duplicate value for property '%s'", s[0])
+		if len(s) != 2 {
+			return nil, fmt.Errorf("Malformed property, expected key=value or key:=<JSON>: '%s'", arg)
+		}
+
+		var key, value = s[0], s[1]
+		if !strings.HasSuffix(key, ":") {
+			if err := setValue(key, value); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// typed value
+		key = strings.TrimSuffix(key, ":")
+		var typed interface{}
+		if strings.HasPrefix(value, "@") {
+			if err := _readJSONFile(value[1:], &typed); err != nil {
+				return nil, err
+			}
+		} else if err := json.Unmarshal([]byte(value), &typed); err != nil {
+			return nil, fmt.Errorf("Malformed JSON value for property '%s': %s", key, err.Error())
+		}
+		if err := setValue(key, typed); err != nil {
+			return nil, err
 		}
-		props[s[0]] = s[1]
 	}
 
-	return c.printProperties(api.SetProperties(devID, props, auth))
+	return props, nil
+}
+
+// _readJSONFile -- parses the given JSON file ('-' reads from stdin)
+func _readJSONFile(path string, tgt interface{}) error {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = json.Unmarshal(data, tgt); err != nil {
+		return fmt.Errorf("Malformed JSON in '%s': %s", path, err.Error())
+	}
+	return nil
 }
 
 func (c *deviceCmd) printProperties(props map[string]interface{}, err error) error {
@@ -262,6 +385,7 @@ func (c deviceCmd) validateArgs(cmd *cobra.Command, args []string, toComplete st
 		// first arg -> devId
 		return internal.DeviceListCompletion{
 			DontIgnoreUser: true,
+			Groups:         true,
 		}.Run(cmd, args, toComplete)
 	} else if len(args) == 1 {
 		return []string{"props", "set", "rm"}, cobra.ShellCompDirectiveNoFileComp
@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ondevice/ondevice/api"
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/filter"
+	"github.com/sirupsen/logrus"
+)
+
+// bulkResult -- the outcome of updating a single device (using 'ondevice device --filter')
+type bulkResult struct {
+	ID    string
+	Error error
+}
+
+// bulkUpdateFunc -- updates a single device (see deviceCmd.parseBulkArgs())
+type bulkUpdateFunc func(devID string, auth config.Auth) error
+
+// runBulk -- 'ondevice device --filter <expr> <set/rm> ...', updates all the matching devices
+func (c *deviceCmd) runBulk(args []string) {
+	update, description, err := c.parseBulkArgs(args)
+	if err != nil {
+		logrus.Fatal(err)
+		return
+	}
+
+	expr, err := filter.ParseAll(c.filterFlags, config.LoadGroups())
+	if err != nil {
+		logrus.WithError(err).Fatal("invalid filter expression")
+		return
+	}
+
+	auth, err := config.LoadAuth().GetClientAuth()
+	if err != nil {
+		logrus.Fatal("missing client auth, have you run 'ondevice login'?")
+		return
+	}
+
+	allDevices, err := api.ListDevices("", true, auth)
+	if err != nil {
+		logrus.WithError(err).Fatal("failed to fetch device list")
+	}
+
+	var devIDs []string
+	for _, dev := range allDevices {
+		if ok, err := expr.Match(dev); err != nil {
+			logrus.WithError(err).Fatal("failed to filter device list")
+		} else if ok {
+			devIDs = append(devIDs, dev.ID)
+		}
+	}
+	if len(devIDs) == 0 {
+		logrus.Fatal("no matching devices")
+		return
+	}
+
+	if c.dryRunFlag {
+		fmt.Fprintf(os.Stderr, "would update %d devices (%s):\n", len(devIDs), description)
+		for _, devID := range devIDs {
+			fmt.Println(devID)
+		}
+		return
+	}
+
+	if !c.yesFlag && !c.confirm(fmt.Sprintf("Do you really want to update %d devices (%s)", len(devIDs), description)) {
+		logrus.Fatal("Aborted update")
+		return
+	}
+
+	if !c.printBulkSummary(c.updateDevices(devIDs, auth, update)) {
+		os.Exit(1)
+	}
+}
+
+// parseBulkArgs -- validates the 'set'/'rm' arguments, returning the update to run on each device and its description
+func (c *deviceCmd) parseBulkArgs(args []string) (bulkUpdateFunc, string, error) {
+	if len(args) < 1 {
+		return nil, "", errors.New("missing device command (use 'ondevice device --filter <expr> <set/rm> ...')")
+	} else if c.parallelFlag < 1 {
+		return nil, "", errors.New("--parallel has to be at least 1")
+	}
+
+	switch cmd := args[0]; cmd {
+	case "set":
+		// we'd fail to read the confirmation from stdin (check before reading the values)
+		if _readsStdin(args[1:]) && !c.yesFlag && !c.dryRunFlag {
+			return nil, "", errors.New("--yes is required when reading values from stdin")
+		}
+		var props, err = parsePropertyArgs(args[1:])
+		if err != nil {
+			return nil, "", err
+		} else if len(props) == 0 {
+			return nil, "", errors.New("too few arguments")
+		}
+
+		var keys = make([]string, 0, len(props))
+		for k := range props {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if err = _checkBulkKeys(keys); err != nil {
+			return nil, "", err
+		}
+
+		return func(devID string, auth config.Auth) error {
+			var _, err = api.SetProperties(devID, props, auth)
+			return err
+		}, "set " + strings.Join(keys, ", "), nil
+	case "rm":
+		var keys = args[1:]
+		if len(keys) == 0 {
+			return nil, "", errors.New("too few arguments")
+		} else if err := _checkBulkKeys(keys); err != nil {
+			return nil, "", err
+		}
+
+		return func(devID string, auth config.Auth) error {
+			var _, err = api.RemoveProperties(devID, keys, auth)
+			return err
+		}, "remove " + strings.Join(keys, ", "), nil
+	default:
+		return nil, "", fmt.Errorf("unsupported device command for --filter (use 'set' or 'rm'): '%s'", cmd)
+	}
+}
+
+// updateDevices -- runs update() on each of the devices (at most --parallel at a time), printing the outcome as it goes
+//
+// the results are in the same order as devIDs
+func (c *deviceCmd) updateDevices(devIDs []string, auth config.Auth, update bulkUpdateFunc) []bulkResult {
+	var results = make([]bulkResult, len(devIDs))
+	var slots = make(chan struct{}, c.parallelFlag)
+	var outputLock sync.Mutex
+	var wg sync.WaitGroup
+	for i, devID := range devIDs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, devID string) {
+			defer wg.Done()
+			var rc = bulkResult{ID: devID, Error: c.bulkUpdate(devID, auth, update)}
+
+			outputLock.Lock()
+			if rc.Error != nil {
+				fmt.Fprintf(os.Stderr, "%s: failed: %s\n", devID, rc.Error)
+			} else {
+				fmt.Printf("%s: ok\n", devID)
+			}
+			outputLock.Unlock()
+
+			results[i] = rc
+			<-slots
+		}(i, devID)
+	}
+	wg.Wait()
+
+	return results
+}
+
+// bulkUpdate -- runs update() on the given device (retrying a few times if we're being rate limited)
+func (*deviceCmd) bulkUpdate(devID string, auth config.Auth, update bulkUpdateFunc) error {
+	for attempt := 1; ; attempt++ {
+		var err = update(devID, auth)
+		if attempt >= 3 || !api.IsRateLimited(err) {
+			return err
+		}
+
+		var delay = time.Second
+		var apiErr *api.Error
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+			delay = apiErr.RetryAfter
+		}
+		logrus.Debugf("%s: rate limited, retrying in %s", devID, delay)
+		time.Sleep(delay)
+	}
+}
+
+// printBulkSummary -- prints the number of updated devices and lists the failures (returns false if there were any)
+func (*deviceCmd) printBulkSummary(results []bulkResult) bool {
+	var failed []bulkResult
+	for _, rc := range results {
+		if rc.Error != nil {
+			failed = append(failed, rc)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].ID < failed[j].ID })
+
+	fmt.Fprintf(os.Stderr, "%d devices: %d updated, %d failed\n", len(results), len(results)-len(failed), len(failed))
+	for _, rc := range failed {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", rc.ID, rc.Error)
+	}
+
+	return len(failed) == 0
+}
+
+// _checkBulkKeys -- special properties (e.g. 'on:id', which would delete the device) can't be changed using --filter
+func _checkBulkKeys(keys []string) error {
+	for _, key := range keys {
+		if strings.HasPrefix(key, "on:") {
+			return fmt.Errorf("special properties can't be changed using --filter: '%s'", key)
+		}
+	}
+	return nil
+}
+
+// _readsStdin -- returns true if any of the property arguments reads from stdin ('@-' or 'key:=@-')
+func _readsStdin(args []string) bool {
+	for _, arg := range args {
+		if arg == "@-" || strings.HasSuffix(arg, ":=@-") {
+			return true
+		}
+	}
+	return false
+}
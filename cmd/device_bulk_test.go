@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ondevice/ondevice/api"
+	"github.com/ondevice/ondevice/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBulkArgs(t *testing.T) {
+	var c = deviceCmd{parallelFlag: 1}
+
+	var _, description, err = c.parseBulkArgs([]string{"set", "b=1", "a:=[1,2]"})
+	assert.NoError(t, err)
+	assert.Equal(t, "set a, b", description)
+
+	_, description, err = c.parseBulkArgs([]string{"rm", "a", "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, "remove a, b", description)
+
+	for _, args := range [][]string{
+		{},
+		{"props"},
+		{"set"},
+		{"set", "noValue"},
+		{"rm"},
+		// special properties
+		{"set", "on:id=abc"},
+		{"set", "on:name:=\"foo\""},
+		{"rm", "on:id"},
+		{"rm", "a", "on:name"},
+		// we'd be reading the confirmation from stdin as well (returns before reading from stdin)
+		{"set", "@-"},
+		{"set", "a:=@-"},
+	} {
+		_, _, err = c.parseBulkArgs(args)
+		assert.Error(t, err, args)
+	}
+
+	c.parallelFlag = 0
+	_, _, err = c.parseBulkArgs([]string{"rm", "a"})
+	assert.Error(t, err)
+}
+
+func TestBulkUpdate(t *testing.T) {
+	var c = deviceCmd{parallelFlag: 2}
+	var devIDs = []string{"dev1", "dev2", "dev3", "dev4", "dev5"}
+
+	var lock sync.Mutex
+	var running, maxRunning int
+	var attempts = map[string]int{}
+	var update = func(devID string, auth config.Auth) error {
+		lock.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		attempts[devID]++
+		var attempt = attempts[devID]
+		lock.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		lock.Lock()
+		running--
+		lock.Unlock()
+
+		switch devID {
+		case "dev2":
+			return errors.New("failed")
+		case "dev4":
+			// rate limited once, then succeeds
+			if attempt == 1 {
+				return &api.Error{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Millisecond}
+			}
+		}
+		return nil
+	}
+
+	var results = c.updateDevices(devIDs, nil, update)
+	assert.Equal(t, 2, maxRunning)
+	assert.Equal(t, 2, attempts["dev4"])
+	assert.Equal(t, 1, attempts["dev2"])
+	if assert.Len(t, results, len(devIDs)) {
+		for i, rc := range results {
+			assert.Equal(t, devIDs[i], rc.ID)
+			assert.Equal(t, rc.ID == "dev2", rc.Error != nil, rc.ID)
+		}
+	}
+	assert.False(t, c.printBulkSummary(results))
+}
@@ -22,9 +22,12 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ondevice/ondevice/api"
+	"github.com/ondevice/ondevice/cmd/internal"
+	"github.com/ondevice/ondevice/config"
 	"github.com/ondevice/ondevice/util"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -90,7 +93,8 @@ Doesn't affect live events printed after that.`)
 	c.Flags().StringVar(&c.typeFlag, "type", "", `Filters the output by event type (comma-separated list).
 Some types: deviceOnline, deviceOffline, connect, accept, close,
 For a full list of event types, have a look at the ondevice.io documentation.`)
-	c.Flags().StringVar(&c.deviceFlag, "device", "", `only show events for the given device(s) (comma-separated)`)
+	c.Flags().StringVar(&c.deviceFlag, "device", "", `only show events for the given device(s) (comma-separated)
+Use '@name' to include the devices of one of your groups (see 'ondevice group').`)
 	c.Flags().IntVar(&c.timeoutFlag, "timeout", -1, `exit with code 2 after n seconds (0: exit immediately, default: no timeout)
 Stops the event stream after n seconds.
 0 means 'exit immediately' (will only print existing events), negative values
@@ -102,10 +106,39 @@ If both --timeout and --await are present, whichever one happens first will
 cause the program to exit (check the return code to see what happened first).`)
 }
 
+// resolveDevices -- expands the '@group' entries of the comma separated --device list
+func (c *eventCmd) resolveDevices(devices string) string {
+	if !strings.Contains(devices, "@") {
+		return devices
+	}
+
+	var groups = config.LoadGroups()
+	var rc []string
+	for _, devID := range strings.Split(devices, ",") {
+		if !strings.HasPrefix(devID, "@") {
+			rc = append(rc, devID)
+			continue
+		}
+
+		auth, err := config.LoadAuth().GetClientAuth()
+		if err != nil {
+			logrus.Fatal("missing client auth, have you run 'ondevice login'?")
+		}
+		groupDevices, err := internal.ResolveGroup(groups, devID, auth)
+		if err != nil {
+			logrus.WithError(err).Fatalf("failed to resolve device group '%s'", devID)
+		} else if len(groupDevices) == 0 {
+			logrus.Fatalf("device group '%s' doesn't contain any devices", devID)
+		}
+		rc = append(rc, groupDevices...)
+	}
+	return strings.Join(rc, ",")
+}
+
 func (c *eventCmd) run(cmd *cobra.Command, args []string) {
 	// init listener
 	listener := api.EventListener{
-		Devices: c.deviceFlag,
+		Devices: c.resolveDevices(c.deviceFlag),
 		Types:   c.typeFlag,
 	}
 	if c.flagWasSet("since") {
@@ -0,0 +1,305 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ondevice/ondevice/api"
+	"github.com/ondevice/ondevice/cmd/internal"
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/filter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// execCmd -- runs a command on each (online) device matching the given filters
+type execCmd struct {
+	cobra.Command
+
+	parallelFlag  int
+	loginFlag     string
+	timeoutFlag   time.Duration
+	collectFlag   bool
+	jsonFlag      bool
+	sshOptionFlag []string
+
+	outputLock sync.Mutex
+}
+
+// execResult -- the outcome of running the command on a single device
+type execResult struct {
+	ID       string  `json:"id"`
+	ExitCode int     `json:"exitCode"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration"`
+	Stdout   string  `json:"stdout"`
+	Stderr   string  `json:"stderr"`
+}
+
+func init() {
+	var c execCmd
+	c.Command = cobra.Command{
+		Use:   "exec [filters...] -- <command> [args...]",
+		Short: "run a command on many devices at once",
+		Long: `runs the given command (using 'ondevice ssh') on each of your online devices
+matching the filters (see 'ondevice list --help' for the filter syntax).
+
+Without filters, the command runs on all of your online devices.
+
+By default, each line of output is prefixed with the device ID (as soon as
+it arrives). With --collect, each device's output is printed in one block
+once the command has finished there. --json prints one JSON object per device
+(with its exit code, output and the duration in seconds) instead.
+
+Once all the devices are done, a summary of the failures is printed to stderr
+and 'ondevice exec' exits with status 1 if the command failed anywhere.
+
+ssh runs in batch mode (i.e. it won't ask for passwords or confirm host keys).
+Use -o to pass extra options to ssh.`,
+		Example: `- check the disk usage of all the devices with the 'location' property 'berlin'
+  $ ondevice exec location=berlin -- df -h /
+  demo.q5dkpm: Filesystem      Size  Used Avail Use% Mounted on
+  demo.q5dkpm: /dev/root        29G  3.1G   25G  12% /
+  demo.thm7br: Filesystem      Size  Used Avail Use% Mounted on
+  demo.thm7br: /dev/mmcblk0p2   15G   14G  128M 99% /
+  2 devices: 2 succeeded, 0 failed
+
+- upgrade outdated devices (at most 5 at once), logging in as root
+  $ ondevice exec 'fooVersion<2.3.4' -l root -p 5 -- apt-get install -y foo
+
+- JSON output (one line per device)
+  $ ondevice exec --json -- uptime
+  {"id":"demo.q5dkpm","exitCode":0,"duration":1.23,"stdout":" 10:42:01 up 3 days,  2:01,  0 users,  load average: 0.00, 0.01, 0.05\n","stderr":""}`,
+		Run:               c.run,
+		Args:              cobra.MinimumNArgs(1),
+		ValidArgsFunction: internal.GroupCompletion,
+	}
+	rootCmd.AddCommand(&c.Command)
+
+	c.Flags().IntVarP(&c.parallelFlag, "parallel", "p", 10, "maximum number of devices to run the command on at the same time")
+	c.Flags().StringVarP(&c.loginFlag, "login", "l", "", "the user to log in as (on the devices)")
+	c.Flags().DurationVar(&c.timeoutFlag, "timeout", 0, "give up on devices that take longer than that (e.g. 30s, default: no timeout)")
+	c.Flags().BoolVar(&c.collectFlag, "collect", false, "print each device's output in one block (once it's done)")
+	c.Flags().BoolVar(&c.jsonFlag, "json", false, "print one JSON object per device")
+	c.Flags().StringArrayVarP(&c.sshOptionFlag, "ssh-option", "o", nil, "extra ssh option (e.g. -o ConnectTimeout=10)")
+}
+
+func (c *execCmd) run(cmd *cobra.Command, args []string) {
+	var dash = cmd.ArgsLenAtDash()
+	if dash < 0 || dash >= len(args) {
+		logrus.Fatal("missing command (use 'ondevice exec [filters...] -- <command>')")
+		return
+	}
+	var filters, command = args[:dash], args[dash:]
+
+	if c.parallelFlag < 1 {
+		logrus.Fatal("--parallel has to be at least 1")
+		return
+	} else if c.jsonFlag && c.collectFlag {
+		logrus.Fatal("specified conflicting output modes (--json and --collect)")
+		return
+	}
+
+	expr, err := filter.ParseAll(filters, config.LoadGroups())
+	if err != nil {
+		logrus.WithError(err).Fatal("invalid filter expression")
+		return
+	}
+
+	auth, err := config.LoadAuth().GetClientAuth()
+	if err != nil {
+		logrus.Fatal("missing client auth, have you run 'ondevice login'?")
+		return
+	}
+
+	allDevices, err := api.ListDevices("online", len(filters) > 0, auth)
+	if err != nil {
+		logrus.WithError(err).Fatal("failed to fetch device list")
+	}
+
+	var devIDs []string
+	for _, dev := range allDevices {
+		if ok, err := expr.Match(dev); err != nil {
+			logrus.WithError(err).Fatal("failed to filter device list")
+		} else if ok {
+			devIDs = append(devIDs, dev.ID)
+		}
+	}
+	if len(devIDs) == 0 {
+		logrus.Fatal("no matching online devices")
+		return
+	}
+
+	// run the command (on at most --parallel devices at a time)
+	var results = make([]execResult, len(devIDs))
+	var slots = make(chan struct{}, c.parallelFlag)
+	var wg sync.WaitGroup
+	for i, devID := range devIDs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(i int, devID string) {
+			defer wg.Done()
+			results[i] = c.runOnDevice(devID, command)
+			<-slots
+		}(i, devID)
+	}
+	wg.Wait()
+
+	if !c.printSummary(results) {
+		os.Exit(1)
+	}
+}
+
+// runOnDevice -- runs the command on the given device using ssh (and prints its output)
+func (c *execCmd) runOnDevice(devID string, command []string) execResult {
+	var target = devID
+	if c.loginFlag != "" {
+		target = c.loginFlag + "@" + devID
+	}
+
+	var sshArgs = []string{"-oBatchMode=yes"}
+	for _, opt := range c.sshOptionFlag {
+		sshArgs = append(sshArgs, "-o"+opt)
+	}
+	sshArgs = append(sshArgs, target, "--")
+	sshArgs = append(sshArgs, command...)
+	var sshCommand = sshCommandLine(sshArgs)
+
+	var ctx, cancel = context.Background(), context.CancelFunc(func() {})
+	if c.timeoutFlag > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.timeoutFlag)
+	}
+	defer cancel()
+
+	var rc = execResult{ID: devID}
+	var stdout, stderr bytes.Buffer
+	var proc = exec.CommandContext(ctx, sshCommand[0], sshCommand[1:]...)
+	if c.jsonFlag || c.collectFlag {
+		proc.Stdout, proc.Stderr = &stdout, &stderr
+	} else {
+		proc.Stdout = &linePrefixWriter{w: os.Stdout, lock: &c.outputLock, prefix: devID + ": "}
+		proc.Stderr = &linePrefixWriter{w: os.Stderr, lock: &c.outputLock, prefix: devID + ": "}
+	}
+
+	var start = time.Now()
+	var err = proc.Run()
+	rc.Duration = time.Since(start).Seconds()
+	rc.Stdout, rc.Stderr = stdout.String(), stderr.String()
+	rc.ExitCode, rc.Error = c.classifyError(err, ctx.Err() == context.DeadlineExceeded)
+
+	if w, ok := proc.Stdout.(*linePrefixWriter); ok {
+		w.Flush()
+		proc.Stderr.(*linePrefixWriter).Flush()
+	}
+	c.printResult(rc)
+	return rc
+}
+
+// classifyError -- returns the exit code and error message for what ssh's Run() returned (-1 if there's no exit code)
+func (c *execCmd) classifyError(err error, timedOut bool) (int, string) {
+	if timedOut {
+		return -1, fmt.Sprintf("timed out after %s", c.timeoutFlag)
+	} else if exitErr, ok := err.(*exec.ExitError); ok {
+		var exitCode = exitErr.ExitCode()
+		if exitCode == 255 {
+			return exitCode, "ssh failed (connection error or remote exit status 255)"
+		}
+		return exitCode, ""
+	} else if err != nil {
+		return -1, err.Error()
+	}
+	return 0, ""
+}
+
+// printResult -- prints the result of a single device (in --json or --collect mode)
+func (c *execCmd) printResult(rc execResult) {
+	c.outputLock.Lock()
+	defer c.outputLock.Unlock()
+
+	if c.jsonFlag {
+		data, err := json.Marshal(rc)
+		if err != nil {
+			logrus.WithError(err).Fatal("JSON serialization failed")
+		}
+		fmt.Println(string(data))
+	} else if c.collectFlag {
+		fmt.Printf("=== %s (exit code %d) ===\n", rc.ID, rc.ExitCode)
+		fmt.Print(rc.Stdout)
+		fmt.Fprint(os.Stderr, rc.Stderr)
+		if rc.Stdout != "" && rc.Stdout[len(rc.Stdout)-1] != '\n' {
+			fmt.Println()
+		}
+	}
+}
+
+// printSummary -- prints the number of successful runs and lists the failures (returns false if there were any)
+func (c *execCmd) printSummary(results []execResult) bool {
+	var failed []execResult
+	for _, rc := range results {
+		if rc.ExitCode != 0 || rc.Error != "" {
+			failed = append(failed, rc)
+		}
+	}
+	sort.Slice(failed, func(i, j int) bool { return failed[i].ID < failed[j].ID })
+
+	fmt.Fprintf(os.Stderr, "%d devices: %d succeeded, %d failed\n", len(results), len(results)-len(failed), len(failed))
+	for _, rc := range failed {
+		if rc.Error != "" {
+			fmt.Fprintf(os.Stderr, "  %s: %s\n", rc.ID, rc.Error)
+		} else {
+			fmt.Fprintf(os.Stderr, "  %s: exit code %d\n", rc.ID, rc.ExitCode)
+		}
+	}
+
+	return len(failed) == 0
+}
+
+// linePrefixWriter -- prefixes each line written to it (only writing complete lines, see Flush())
+type linePrefixWriter struct {
+	w      io.Writer
+	lock   *sync.Mutex // shared by all the writers (so lines of different devices won't get mixed up)
+	prefix string
+	buff   []byte
+}
+
+func (p *linePrefixWriter) Write(data []byte) (int, error) {
+	p.buff = append(p.buff, data...)
+
+	var i = bytes.LastIndexByte(p.buff, '\n')
+	if i < 0 {
+		return len(data), nil
+	}
+	p.writeLines(p.buff[:i+1])
+	p.buff = append(p.buff[:0], p.buff[i+1:]...)
+	return len(data), nil
+}
+
+// Flush -- writes the last line (if it doesn't end with a newline)
+func (p *linePrefixWriter) Flush() {
+	if len(p.buff) > 0 {
+		p.writeLines(append(p.buff, '\n'))
+		p.buff = nil
+	}
+}
+
+func (p *linePrefixWriter) writeLines(data []byte) {
+	var out bytes.Buffer
+	for _, line := range bytes.SplitAfter(data, []byte("\n")) {
+		if len(line) > 0 {
+			out.WriteString(p.prefix)
+			out.Write(line)
+		}
+	}
+
+	p.lock.Lock()
+	p.w.Write(out.Bytes())
+	p.lock.Unlock()
+}
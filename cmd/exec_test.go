@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"os/exec"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLinePrefixWriter(t *testing.T) {
+	for _, tc := range []struct {
+		writes   []string
+		expected string // before Flush()
+		flushed  string
+	}{
+		{[]string{"foo\nbar\n"}, "dev: foo\ndev: bar\n", ""},
+		{[]string{"foo\n\nbar\n"}, "dev: foo\ndev: \ndev: bar\n", ""},
+		// incomplete lines wait for the next Write() (or Flush())
+		{[]string{"fo", "o\nba", "r\n"}, "dev: foo\ndev: bar\n", ""},
+		{[]string{"foo\nba", "r"}, "dev: foo\n", "dev: bar\n"},
+		{[]string{"foo"}, "", "dev: foo\n"},
+		{[]string{"", "\n"}, "dev: \n", ""},
+		{nil, "", ""},
+	} {
+		var out bytes.Buffer
+		var w = linePrefixWriter{w: &out, lock: &sync.Mutex{}, prefix: "dev: "}
+		for _, data := range tc.writes {
+			var n, err = w.Write([]byte(data))
+			assert.NoError(t, err)
+			assert.Equal(t, len(data), n)
+		}
+		assert.Equal(t, tc.expected, out.String(), tc.writes)
+
+		w.Flush()
+		assert.Equal(t, tc.expected+tc.flushed, out.String(), tc.writes)
+	}
+}
+
+func TestExecResults(t *testing.T) {
+	var c = execCmd{timeoutFlag: 30 * time.Second}
+
+	for _, tc := range []struct {
+		err      error
+		timedOut bool
+		exitCode int
+		hasError bool
+	}{
+		{nil, false, 0, false},
+		{exec.Command("sh", "-c", "exit 3").Run(), false, 3, false},
+		{exec.Command("sh", "-c", "exit 255").Run(), false, 255, true},
+		{errors.New("ssh not found"), false, -1, true},
+		// the process gets killed once the timeout's been reached
+		{exec.Command("sh", "-c", "kill -9 $$").Run(), true, -1, true},
+	} {
+		var exitCode, msg = c.classifyError(tc.err, tc.timedOut)
+		assert.Equal(t, tc.exitCode, exitCode, tc.err)
+		assert.Equal(t, tc.hasError, msg != "", tc.err)
+	}
+
+	var _, msg = c.classifyError(nil, true)
+	assert.Equal(t, "timed out after 30s", msg)
+
+	// summary (false if the command failed anywhere)
+	assert.True(t, c.printSummary([]execResult{{ID: "a"}, {ID: "b"}}))
+	assert.False(t, c.printSummary([]execResult{{ID: "a"}, {ID: "b", ExitCode: 1}}))
+	assert.False(t, c.printSummary([]execResult{{ID: "a", ExitCode: -1, Error: "timed out after 30s"}}))
+	assert.False(t, c.printSummary([]execResult{{ID: "a", Error: "failed"}}))
+}
@@ -0,0 +1,189 @@
+package cmd
+
+import (
+	"io"
+	"net"
+	"sync"
+
+	"github.com/ondevice/ondevice/cmd/internal"
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/tunnel"
+	"github.com/ondevice/ondevice/util"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// forwardCmd represents the forward command
+type forwardCmd struct {
+	cobra.Command
+
+	listenFlag   string
+	muxFlag      bool
+	protocolFlag string
+
+	mux     *tunnel.Mux
+	muxLock sync.Mutex
+}
+
+func init() {
+	var c forwardCmd
+	c.Command = cobra.Command{
+		Use:   "forward <devId> <service>",
+		Short: "forwards a local TCP port to one of your device's services",
+		Long: `listens on a local TCP port and forwards each incoming connection to the
+given service on your device (without the need for ssh or sshd).
+
+Each incoming connection opens its own tunnel. The device needs to offer the
+service in question (see 'ondevice service' on the device).
+
+--protocol has to match the protocol of the device's service (defaults to 'tcp').
+
+With --mux, all connections share a single (multiplexed) tunnel, which saves
+the handshake for each new connection.`,
+		Example: `- access the device's web UI (service 'web') on http://localhost:8080/
+  $ ondevice forward myDev web --listen 127.0.0.1:8080
+
+- connect to a database running on the device
+  $ ondevice forward myDev db --listen 127.0.0.1:54320 &
+  $ psql -h localhost -p 54320 -U webapp`,
+		Run:               c.run,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: c.validateArgs,
+	}
+	rootCmd.AddCommand(&c.Command)
+
+	c.Flags().StringVar(&c.listenFlag, "listen", "127.0.0.1:0", "local address to listen on (host:port, port 0 picks a random one)")
+	c.Flags().BoolVar(&c.muxFlag, "mux", false, "use a single multiplexed tunnel for all connections")
+	c.Flags().StringVar(&c.protocolFlag, "protocol", "tcp", "the protocol of the device's service")
+}
+
+func (c *forwardCmd) run(cmd *cobra.Command, args []string) {
+	var devID, svc = args[0], args[1]
+
+	c.listenAndServe(devID, svc, func(addr net.Addr) {
+		logrus.Infof("forwarding %s to %s:%s", addr, devID, svc)
+	})
+}
+
+// listenAndServe -- listens on --listen and forwards each incoming connection to the given service
+//
+// calls onListen() once it's listening
+func (c *forwardCmd) listenAndServe(devID string, svc string, onListen func(addr net.Addr)) {
+	auth, err := config.LoadAuth().GetClientAuthForDevice(devID)
+	if err != nil {
+		logrus.WithError(err).Fatal("missing client credentials")
+		return
+	}
+
+	l, err := net.Listen("tcp", c.listenFlag)
+	if err != nil {
+		logrus.WithError(err).Fatalf("failed to listen on '%s'", c.listenFlag)
+		return
+	}
+	defer l.Close()
+
+	onListen(l.Addr())
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			logrus.WithError(err).Fatal("failed to accept connection")
+			return
+		}
+
+		if c.muxFlag {
+			go c.forwardStream(conn, devID, svc, auth)
+		} else {
+			go c.forward(conn, devID, svc, auth)
+		}
+	}
+}
+
+// forward -- opens a tunnel and pumps data between it and conn until both sides are done
+func (c *forwardCmd) forward(conn net.Conn, devID string, svc string, auth config.Auth) {
+	defer conn.Close()
+	logrus.Debugf("new connection from %s", conn.RemoteAddr())
+
+	t, err := tunnel.Dial(devID, svc, c.protocolFlag, auth)
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to connect to %s:%s", devID, svc)
+		return
+	}
+	defer t.Close()
+
+	go func() {
+		io.Copy(conn, t)
+		// the device won't send any more data -> close our write channel
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+
+		// interrupt the io.Copy() below once the tunnel's closed
+		t.Wait()
+		conn.Close()
+	}()
+
+	if _, err := io.Copy(t, conn); err != nil {
+		logrus.WithError(err).Debug("stopped reading from local connection")
+		return
+	}
+	t.CloseWrite()
+	t.Wait()
+	logrus.Debugf("connection from %s closed", conn.RemoteAddr())
+}
+
+// forwardStream -- like forward(), but uses a stream of the shared multiplexed tunnel
+func (c *forwardCmd) forwardStream(conn net.Conn, devID string, svc string, auth config.Auth) {
+	defer conn.Close()
+	logrus.Debugf("new connection from %s", conn.RemoteAddr())
+
+	m, err := c.getMux(devID, auth)
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to connect to %s", devID)
+		return
+	}
+
+	s, err := m.Open(svc, c.protocolFlag)
+	if err != nil {
+		logrus.WithError(err).Errorf("failed to connect to %s:%s", devID, svc)
+		return
+	}
+	defer s.Close()
+
+	go func() {
+		io.Copy(conn, s)
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+	}()
+
+	if _, err := io.Copy(s, conn); err != nil {
+		logrus.WithError(err).Error("error forwarding local connection")
+		return
+	}
+	s.SendEOF()
+	s.Wait()
+	logrus.Debugf("connection from %s closed", conn.RemoteAddr())
+}
+
+// getMux -- returns the shared multiplexed tunnel (reconnecting if necessary)
+func (c *forwardCmd) getMux(devID string, auth config.Auth) (*tunnel.Mux, util.APIError) {
+	c.muxLock.Lock()
+	defer c.muxLock.Unlock()
+
+	if c.mux == nil || c.mux.IsClosed() {
+		m, err := tunnel.ConnectMux(devID, auth)
+		if err != nil {
+			return nil, err
+		}
+		c.mux = m
+	}
+	return c.mux, nil
+}
+
+// validateArgs -- does shell completion
+func (c *forwardCmd) validateArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return internal.DeviceListCompletion{DontIgnoreUser: true}.Run(cmd, args, toComplete)
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/ondevice/ondevice/cmd/internal"
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/filter"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// groupCmd represents the group command
+var groupCmd = &cobra.Command{
+	Use:   "group",
+	Short: "manage named groups of devices",
+	Long: `list, add, remove or show your device groups.
+
+Groups are named selections of devices, either saved filter expressions (see
+'ondevice list --help' for the syntax) or static lists of devIDs. They're stored
+locally in groups.json (next to ondevice.conf, see the config value path.groups_json).
+
+Use '@name' to refer to a group:
+- in filter expressions (ondevice list, ondevice exec, ondevice device --filter),
+  e.g. 'ondevice list @prod-eu' or 'ondevice exec "@prod-eu and on:state=online" -- uptime'
+  (groups can refer to other groups, too)
+- instead of a devId for 'ondevice device' (updating all of the group's devices)
+  and 'ondevice event --device'
+- when completing devIDs in your shell (e.g. 'ondevice ssh @db<TAB>' lists the
+  group's devices)`,
+	Example: `  $ ondevice group add prod-eu 'env=prod and region in (de, fr)'
+  $ ondevice group add db --devices db1,db2
+  $ ondevice group
+  Name    Type    Definition
+  db      devices db1,db2
+  prod-eu filter  env=prod and region in (de, fr)
+  $ ondevice list @prod-eu
+  $ ondevice group rm db`,
+	Run:  groupListRun,
+	Args: cobra.NoArgs,
+}
+
+var groupListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list your device groups",
+	Run:     groupListRun,
+	Args:    cobra.NoArgs,
+}
+
+var groupAddCmd = &cobra.Command{
+	Use:     "add <name> [filters...]",
+	Aliases: []string{"set"},
+	Short:   "add (or replace) a device group",
+	Long: `ondevice group add saves the given filter expression (or, with --devices, the list
+of devIDs) as group (replacing any existing group with the same name).
+
+Multiple filter arguments are combined (devices have to match all of them), just
+like with 'ondevice list'.`,
+	Example: `  $ ondevice group add prod-eu env=prod 'region in (de, fr)'
+  $ ondevice group add stale 'on:state=offline and age(on:stateTs)>7d'
+  $ ondevice group add db --devices db1,db2`,
+	Run:               groupAddRun,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: groupFilterCompletion,
+}
+
+var groupRemoveCmd = &cobra.Command{
+	Use:               "rm <name>...",
+	Aliases:           []string{"remove"},
+	Short:             "remove one or more device groups",
+	Run:               groupRemoveRun,
+	Args:              cobra.MinimumNArgs(1),
+	ValidArgsFunction: groupNameCompletion,
+}
+
+var groupShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "print a device group's definition",
+	Example: `  $ ondevice group show prod-eu
+  name=prod-eu
+  filter=env=prod and region in (de, fr)`,
+	Run:               groupShowRun,
+	Args:              cobra.ExactArgs(1),
+	ValidArgsFunction: groupNameCompletion,
+}
+
+var groupDevices []string
+
+func init() {
+	groupAddCmd.Flags().StringSliceVar(&groupDevices, "devices", nil, "comma separated list of devIDs (instead of filters)")
+
+	rootCmd.AddCommand(groupCmd)
+	groupCmd.AddCommand(groupListCmd)
+	groupCmd.AddCommand(groupAddCmd)
+	groupCmd.AddCommand(groupRemoveCmd)
+	groupCmd.AddCommand(groupShowCmd)
+}
+
+func groupListRun(cmd *cobra.Command, args []string) {
+	var groups = groupLoad()
+
+	var list = groups.ListGroups()
+	var nameWidth = 4
+	for _, group := range list {
+		if len(group.Name) > nameWidth {
+			nameWidth = len(group.Name)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%-*s %-7s %s\n", nameWidth, "Name", "Type", "Definition")
+	for _, group := range list {
+		if len(group.Filters) == 1 {
+			fmt.Printf("%-*s %-7s %s\n", nameWidth, group.Name, "filter", group.Filters[0])
+		} else if len(group.Filters) > 1 {
+			// quoted, so you can tell where each of them ends
+			var quoted = make([]string, 0, len(group.Filters))
+			for _, f := range group.Filters {
+				quoted = append(quoted, strconv.Quote(f))
+			}
+			fmt.Printf("%-*s %-7s %s\n", nameWidth, group.Name, "filter", strings.Join(quoted, " "))
+		} else {
+			fmt.Printf("%-*s %-7s %s\n", nameWidth, group.Name, "devices", strings.Join(group.Devices, ","))
+		}
+	}
+}
+
+func groupAddRun(cmd *cobra.Command, args []string) {
+	var name, filters = strings.TrimPrefix(args[0], "@"), args[1:]
+	var group = config.Group{Name: name}
+
+	if len(groupDevices) > 0 {
+		if len(filters) > 0 {
+			logrus.Fatal("specify either filters or --devices (not both)")
+		}
+		group.Devices = groupDevices
+	} else {
+		group.Filters = filters
+	}
+
+	var groups = groupLoad()
+	if _, exists := groups.GetGroup(name); exists {
+		logrus.Infof("replacing existing group '@%s'", name)
+	}
+	if err := groups.SetGroup(group); err != nil {
+		logrus.WithError(err).Fatal("failed to add group")
+	}
+
+	// make sure the filter expressions are valid (and don't reference unknown groups)
+	if len(group.Filters) > 0 {
+		if _, err := filter.Parse("@"+name, groups); err != nil {
+			logrus.WithError(err).Fatal("invalid filter expression")
+		}
+	}
+
+	groupWrite(groups)
+}
+
+func groupRemoveRun(cmd *cobra.Command, args []string) {
+	var groups = groupLoad()
+
+	// remember which groups are valid now (to make sure we don't break them by removing groups they refer to)
+	var valid = map[string]bool{}
+	for _, group := range groups.ListGroups() {
+		if _, err := filter.Parse("@"+group.Name, groups); err == nil {
+			valid[group.Name] = true
+		}
+	}
+
+	for _, name := range args {
+		if !groups.RemoveGroup(strings.TrimPrefix(name, "@")) {
+			logrus.Fatalf("group not found: '%s'", name)
+		}
+	}
+
+	for _, group := range groups.ListGroups() {
+		if !valid[group.Name] {
+			continue
+		}
+		if _, err := filter.Parse("@"+group.Name, groups); err != nil {
+			logrus.WithError(err).Fatalf("group '@%s' still refers to the group(s) you're trying to remove", group.Name)
+		}
+	}
+
+	groupWrite(groups)
+}
+
+func groupShowRun(cmd *cobra.Command, args []string) {
+	var groups = groupLoad()
+
+	var group, ok = groups.GetGroup(strings.TrimPrefix(args[0], "@"))
+	if !ok {
+		logrus.Fatalf("group not found: '%s'", args[0])
+	}
+
+	fmt.Printf("name=%s\n", group.Name)
+	if len(group.Filters) > 0 {
+		for _, f := range group.Filters {
+			fmt.Printf("filter=%s\n", f)
+		}
+	} else {
+		fmt.Printf("devices=%s\n", strings.Join(group.Devices, ","))
+	}
+}
+
+// groupLoad -- loads groups.json (exiting on error)
+func groupLoad() config.GroupConfig {
+	var groups = config.LoadGroups()
+	if err := groups.Error(); err != nil {
+		logrus.WithError(err).Fatal("failed to load groups.json")
+	}
+	return groups
+}
+
+// groupWrite -- writes groups.json (if something's changed)
+func groupWrite(groups config.GroupConfig) {
+	if !groups.IsChanged() {
+		logrus.Info("ondevice group: nothing changed")
+		return
+	}
+
+	if err := groups.Write(); err != nil {
+		logrus.WithError(err).Fatal("failed to write groups.json")
+	}
+}
+
+// groupNameCompletion -- completes group names (without the '@')
+func groupNameCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var names, rc = internal.GroupCompletion(cmd, args, "@"+toComplete)
+	for i := range names {
+		names[i] = strings.TrimPrefix(names[i], "@")
+	}
+	return names, rc
+}
+
+// groupFilterCompletion -- completes '@group' references in the filters following the group name
+func groupFilterCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return internal.GroupCompletion(cmd, args, toComplete)
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/spf13/cobra"
+)
+
+// httpCmd -- serves a device's 'http' service on a local port
+type httpCmd struct {
+	forwardCmd
+}
+
+func init() {
+	var c httpCmd
+	c.protocolFlag = "http"
+	c.Command = cobra.Command{
+		Use:   "http <devId> [service]",
+		Short: "access a device's web application in your browser",
+		Long: `serves one of your device's 'http' services on a local port.
+
+The device side acts as a reverse proxy for the service's upstream URL (see
+'ondevice service add <name> http url=...'). It sets the Host header to
+match the upstream server and adds X-Forwarded-For, X-Forwarded-Host,
+X-Forwarded-Proto as well as X-Ondevice-User (the ondevice user you're
+connecting as).
+
+[service] defaults to 'http'.`,
+		Example: `- open the device's web UI on a random local port
+  $ ondevice http myDev
+  serving myDev:http on http://127.0.0.1:38457/
+
+- use a fixed port for the 'grafana' service
+  $ ondevice http myDev grafana --listen 127.0.0.1:3000`,
+		Run:               c.run,
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: c.validateArgs,
+	}
+	rootCmd.AddCommand(&c.Command)
+
+	c.Flags().StringVar(&c.listenFlag, "listen", "127.0.0.1:0", "local address to listen on (host:port, port 0 picks a random one)")
+	c.Flags().BoolVar(&c.muxFlag, "mux", false, "use a single multiplexed tunnel for all connections")
+}
+
+func (c *httpCmd) run(cmd *cobra.Command, args []string) {
+	var devID, svc = args[0], "http"
+	if len(args) > 1 {
+		svc = args[1]
+	}
+
+	c.listenAndServe(devID, svc, func(addr net.Addr) {
+		fmt.Printf("serving %s:%s on http://%s/\n", devID, svc, addr)
+	})
+}
@@ -14,6 +14,10 @@ import (
 type DeviceListCompletion struct {
 	// DontIgnoreUser -- unless this is set, we'll ignore everything including the first '@' (i.e. the user part in 'user@devId')
 	DontIgnoreUser bool
+
+	// Groups -- set this for commands accepting '@group' instead of a devId (completes group names).
+	// Otherwise, '@group' will be expanded to the group's devIDs
+	Groups bool
 }
 
 // Run -- proviceds shell completion for devIDs
@@ -39,6 +43,12 @@ func (c DeviceListCompletion) Run(cmd *cobra.Command, args []string, toComplete
 	}
 	var a = cfg.LoadAuth()
 
+	if strings.HasPrefix(toComplete, "@") {
+		return c.completeGroup(cfg, a, prefix, toComplete)
+	} else if c.Groups && toComplete == "" {
+		matchingDevices = matchingGroups(cfg.LoadGroups(), "")
+	}
+
 	if dotPos < 1 { // no dot in the hostname part
 		var auth config.Auth
 		var err error
@@ -107,8 +117,65 @@ func (c DeviceListCompletion) stripUserAt(userAtHost string) (userAt string, hos
 	}
 
 	var atIndex = strings.Index(userAtHost, "@")
-	if atIndex >= 0 {
+	if atIndex > 0 { // a leading '@' refers to a group
 		return userAtHost[:atIndex+1], userAtHost[atIndex+1:]
 	}
 	return "", userAtHost
 }
+
+// completeGroup -- completes '@group' names (or, if toComplete is a group name and !c.Groups, its devIDs)
+func (c DeviceListCompletion) completeGroup(cfg config.Config, a config.AuthConfig, prefix string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	var groups = cfg.LoadGroups()
+	var names = matchingGroups(groups, toComplete)
+	if c.Groups || len(names) != 1 || names[0] != toComplete {
+		for i := range names {
+			names[i] = prefix + names[i]
+		}
+		if !c.Groups {
+			return names, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+		}
+		return names, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	// expand the group
+	var auth, err = a.GetClientAuth()
+	if err != nil {
+		logrus.WithError(err).Error("missing client auth, have you run 'ondevice login'?")
+		return nil, cobra.ShellCompDirectiveError
+	}
+	devIDs, err := ResolveGroup(groups, toComplete, auth)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var rc = make([]string, 0, len(devIDs))
+	for _, devID := range devIDs {
+		rc = append(rc, prefix+devID)
+	}
+	return rc, cobra.ShellCompDirectiveNoFileComp
+}
+
+// GroupCompletion -- completes '@group' names (e.g. for commands taking filters)
+func GroupCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if toComplete != "" && !strings.HasPrefix(toComplete, "@") {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	var cfg, err = config.Load()
+	if err != nil {
+		logrus.WithError(err).Error("failed to load ondevice.conf")
+		return nil, cobra.ShellCompDirectiveError
+	}
+	return matchingGroups(cfg.LoadGroups(), toComplete), cobra.ShellCompDirectiveNoFileComp
+}
+
+// matchingGroups -- returns the '@name' of each group starting with toComplete
+func matchingGroups(groups config.GroupConfig, toComplete string) []string {
+	var rc []string
+	for _, group := range groups.ListGroups() {
+		if name := "@" + group.Name; strings.HasPrefix(name, toComplete) {
+			rc = append(rc, name)
+		}
+	}
+	return rc
+}
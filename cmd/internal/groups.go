@@ -0,0 +1,44 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ondevice/ondevice/api"
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/filter"
+)
+
+// ResolveGroup -- returns the devIDs of the given group ('@name' or 'name')
+//
+// Static groups return their list of devices as is, for filter groups we'll query the API server
+func ResolveGroup(groups config.GroupConfig, name string, auth config.Auth) ([]string, error) {
+	name = strings.TrimPrefix(name, "@")
+	var group, ok = groups.GetGroup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown device group '@%s'", name)
+	} else if len(group.Filters) == 0 {
+		return group.Devices, nil
+	}
+
+	var expr, err = filter.Parse("@"+name, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := api.ListDevices("", true, auth)
+	if err != nil {
+		return nil, err
+	}
+
+	var rc []string
+	for _, dev := range devices {
+		var ok, err = expr.Match(dev)
+		if err != nil {
+			return nil, err
+		} else if ok {
+			rc = append(rc, dev.ID)
+		}
+	}
+	return rc, nil
+}
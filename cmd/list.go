@@ -22,6 +22,7 @@ import (
 	"os"
 
 	"github.com/ondevice/ondevice/api"
+	"github.com/ondevice/ondevice/cmd/internal"
 	"github.com/ondevice/ondevice/config"
 	"github.com/ondevice/ondevice/filter"
 	"github.com/sirupsen/logrus"
@@ -49,22 +50,48 @@ func init() {
 Filters:
   with filters you can limit the output based on device properties.
 
-  filters have the format:
+  simple filters have the format:
     propertyName[operator[value]]
   e.g.:
     somePackageVersion<2.3.4
     foo=
 
-  All comparisons are string-based (e.g. "234" is less than "99")
-  Missing values are treated like the empty string
-  ("arch=" lists devices with empty or missing 'arch' property).
+  they can be combined using 'and', 'or' and 'not' (or '&&', '||' and '!') and
+  parentheses. Multiple filter arguments have to match all of them.
+    'location=berlin or location=vienna'
+    'not (on:state=online) and arch=armv7l'
+
+  Values containing spaces, parentheses, operators or keywords have to be quoted
+  (using single or double quotes).
 
   The following comparison operators are supported (comma-separated):
-    "=,==,!=,<,<<,<=,>,>>,>="
+    "=,==,!=,<,<<,<=,>,>>,>=,=~,!~"
 
   The one-character operators ("=,<,>") each have a two-character alias ("==,<<,>>"
-  respectively). These are provided to fix ambiguities (if the value to c start with "")
-  Note that you might have to escape '>' and '<' to shell redirection`,
+  respectively). '=~' and '!~' match (or don't match) the given regular expression.
+  Note that you might have to escape '>' and '<' to shell redirection
+
+  Numbers are compared numerically ("99" is less than "234"), versions (like
+  "2.3.10", "v1.2" or on:version's "ondevice v0.5.1") by their components (so "2.3.9" is less than "2.3.10"),
+  everything else is compared as string.
+  Missing values are treated like the empty string
+  ("arch=" lists devices with empty or missing 'arch' property).
+  List properties match if any of their values does ("tags=prod" lists devices
+  tagged 'prod', "tags!=prod" the ones that aren't), values of object properties
+  can be accessed using dots (e.g. "net.wifi.ssid=lab").
+
+  'in' checks whether a property has one of the listed values:
+    'location in (berlin, vienna)', 'arch not in (x86_64, amd64)'
+
+  'age(propertyName)' compares the time since a timestamp (e.g. on:stateTs or
+  on:createdAt) with a duration (using the units s, m, h, d and w):
+    'on:state=offline and age(on:stateTs)>2h' (offline for more than two hours)
+
+  '@name' matches the devices of one of your groups (see 'ondevice group'):
+    '@prod-eu and on:state=online'
+
+  Special properties (prefixed with 'on:'): on:id, on:name, on:state, on:stateTs,
+  on:ip, on:version and on:createdAt`,
 		Example: `  $ ondevice list
   ID            State   IP             Version         Name
   demo.7t91ta   offline                ondevice v0.4.3
@@ -78,10 +105,14 @@ Filters:
   demo.fbqh2p
   demo.thm7br
 
-  #only lists devices with the "fooVersion" property less than "2.3.4" (simple
-  #string comparison, so "2.3.4" < "2.34.5") and without the "foo" property
+  #only lists devices with the "fooVersion" property less than "2.3.4" (version
+  #comparison, so "2.3.10" > "2.3.4") and without the "foo" property
   #(unset is equivalent to "")
 
+  $ ondevice list 'on:state=offline and age(on:stateTs)>1d' --print-ids
+  demo.7t91ta
+  demo.fbqh2p
+
 - JSON output
   $ ondevice list --json --props
   {"id":"demo.7t91ta",state":"offline","stateTs":1490197318991,"version":"ondevice v0.4.3"}
@@ -90,7 +121,8 @@ Filters:
   {"id":"demo.thm7br","ip":"10.0.0.127","state":"offline", "": "My Raspberry PI","stateTs":1490963689912,"version":"ondevice v0.4.3"}
 
   #note that JSON fields may be missing or null`,
-		Run: c.run,
+		Run:               c.run,
+		ValidArgsFunction: internal.GroupCompletion,
 	}
 	rootCmd.AddCommand(&c.Command)
 
@@ -112,6 +144,12 @@ func (c *listCmd) run(cmd *cobra.Command, filters []string) {
 		logrus.Fatal("specified conflicting output modes (--json and --print-ids)")
 	}
 
+	expr, err := filter.ParseAll(filters, config.LoadGroups())
+	if err != nil {
+		logrus.WithError(err).Fatal("invalid filter expression")
+		return
+	}
+
 	// --user
 	var auth config.Auth
 	if c.userFlag != "" {
@@ -139,7 +177,7 @@ func (c *listCmd) run(cmd *cobra.Command, filters []string) {
 	var devices = make([]api.Device, 0, len(allDevices))
 	for _, dev := range allDevices {
 		var ok bool
-		if ok, err = c._matches(dev, filters); err != nil {
+		if ok, err = expr.Match(dev); err != nil {
 			logrus.WithError(err).Fatal("failed to filter device list")
 		} else if ok {
 			devices = append(devices, dev)
@@ -195,19 +233,6 @@ func (*listCmd) _getColumns(dev api.Device) []string {
 	return []string{dev.ID, dev.State, dev.IP, dev.Version, dev.Name}
 }
 
-// returns true if the device matches the given --with(out) flags
-func (*listCmd) _matches(dev api.Device, filters []string) (bool, error) {
-	for _, f := range filters {
-		if ok, err := filter.Matches(dev, f); err != nil {
-			return false, err
-		} else if !ok {
-			return false, nil
-		}
-	}
-
-	return true, nil
-}
-
 func (c *listCmd) _printColumns(widths []int, cols []string, w *os.File) {
 	if len(widths) != len(cols) {
 		logrus.Fatalf("mismatch between cols and widths count (cols=%v, widths=%v)", cols, widths)
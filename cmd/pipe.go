@@ -36,7 +36,8 @@ type pipeCmd struct {
 	reader *bufio.Reader
 	writer *bufio.Writer
 
-	sentEOF bool
+	sentEOF      bool
+	protocolFlag string
 }
 
 func init() {
@@ -53,10 +54,14 @@ This command is used internally by 'ondevice ssh' to serve as ssh's ProxyCommand
 
   Sends 'hello world' to q5dkpm's 'echo' service. The echo service simply returns
   data back to the sender unaltered. Therefore the above command is equivalent
-  to simply calling 'echo hello world' (as long as your device is online).`,
+  to simply calling 'echo hello world' (as long as your device is online).
+
+  $ ondevice pipe <devId> uptime --protocol=exec
+  Runs the device's 'uptime' exec service and prints its output.`,
 		Run:    c.run,
 		Hidden: true,
 	}
+	c.Flags().StringVar(&c.protocolFlag, "protocol", "", "the protocol of the device's service (defaults to the service name)")
 	rootCmd.AddCommand(&c.Command)
 }
 
@@ -73,6 +78,10 @@ func (c *pipeCmd) run(cmd *cobra.Command, args []string) {
 
 	devID := args[0]
 	service := args[1]
+	protocol := c.protocolFlag
+	if protocol == "" {
+		protocol = service
+	}
 
 	auth, err := config.LoadAuth().GetClientAuthForDevice(devID)
 	if err != nil {
@@ -90,7 +99,7 @@ func (c *pipeCmd) run(cmd *cobra.Command, args []string) {
 	t.CloseListeners = append(t.CloseListeners, c.onClose)
 	t.DataListeners = append(t.DataListeners, c.onData)
 	t.ErrorListeners = append(t.ErrorListeners, c.onError)
-	if e := tunnel.Connect(&t, devID, service, service, auth); e != nil {
+	if e := tunnel.Connect(&t, devID, service, protocol, auth); e != nil {
 		util.FailWithAPIError(e)
 	}
 
@@ -112,7 +121,11 @@ func (c *pipeCmd) run(cmd *cobra.Command, args []string) {
 			}
 		}
 
-		t.Write(buff[:count])
+		// blocks if the device can't keep up
+		if _, err = t.Write(buff[:count]); err != nil {
+			logrus.WithError(err).Debug("failed to write to tunnel")
+			break
+		}
 	}
 
 	t.Wait()
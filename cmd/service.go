@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/control"
+	"github.com/ondevice/ondevice/service"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// serviceCmd represents the service command
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "manage the services your device offers",
+	Long: `list, add, remove or show the services 'ondevice daemon' offers.
+
+Services are stored in services.json (next to ondevice.conf, see the config value
+path.services_json). If that file doesn't exist, the device will offer the 'ssh'
+service (connecting to $SSH_ADDR or 127.0.0.1:22).
+
+Supported protocols (and their options):
+- ssh: addr=<host:port> (the SSH server to connect to)
+  or: builtin=true [authorized_keys=<path>] [shell=<path>] (use the built-in SSH server
+  instead, for devices without sshd. Clients are authenticated using the given
+  authorized_keys file (default: ~/.ssh/authorized_keys), sessions run as the user
+  running 'ondevice daemon')
+- tcp: addr=<host:port> (any TCP server)
+- udp: addr=<host:port> (any UDP server, e.g. DNS or SNMP. Use 'ondevice udp' to access it)
+- unix: path=<socket path> (any UNIX domain socket, e.g. /var/run/docker.sock)
+- serial: path=<device> [baud=115200] [data_bits=8] [parity=none|even|odd] [stop_bits=1]
+  (a serial port, e.g. a router's console. Use 'ondevice console' to access it.
+  The port is locked while it's in use, linux only)
+- exec: cmd=<command> (spawns the command for each tunnel, connected to its stdin/stdout.
+  Either a shell command or a JSON array, e.g. cmd='["nc", "-U", "/tmp/admin.sock"]')
+- http: url=<upstream URL> (reverse proxy for a web application, use 'ondevice http'
+  to access it. Adds X-Forwarded-* and X-Ondevice-User headers)
+- socks: allow=<destinations> (SOCKS5 proxy, use 'ondevice socks' to access it.
+  Comma separated list of allowed destinations: IPs, CIDR ranges, host names or
+  wildcards like '*.lan', each with an optional port, e.g. allow='10.0.0.0/8,*.lan:80'.
+  allow='*' permits any destination)
+- echo: (returns whatever it receives, useful for testing)
+
+Access to each service can be restricted to specific client users, IP addresses
+(or CIDR ranges) and time windows (see 'ondevice service add --help').
+
+If 'ondevice daemon' is running, it'll be notified of any changes (and will announce
+new services immediately).`,
+	Example: `  $ ondevice service add web tcp addr=127.0.0.1:8080
+  $ ondevice service add db tcp addr=127.0.0.1:5432
+  $ ondevice service add docker unix path=/var/run/docker.sock
+  $ ondevice service add dns udp addr=127.0.0.1:53
+  $ ondevice service add ssh ssh builtin=true
+  $ ondevice service add uptime exec cmd=uptime
+  $ ondevice service add router serial path=/dev/ttyUSB0 baud=9600
+  $ ondevice service add http http url=http://127.0.0.1:3000
+  $ ondevice service add socks socks allow=192.168.1.0/24
+  $ ondevice service
+  db    tcp   addr=127.0.0.1:5432
+  ssh   ssh   addr=127.0.0.1:22
+  web   tcp   addr=127.0.0.1:8080
+  $ ondevice service rm db`,
+	Run:  serviceListRun,
+	Args: cobra.NoArgs,
+}
+
+var serviceListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list the configured services",
+	Run:     serviceListRun,
+	Args:    cobra.NoArgs,
+}
+
+var serviceAddCmd = &cobra.Command{
+	Use:     "add <name> <protocol> [key=value...]",
+	Aliases: []string{"set"},
+	Short:   "add (or replace) a service",
+	Long: `ondevice service add creates a service (replacing any existing service with the same name)
+
+Options are specified as key=value pairs (see 'ondevice service --help' for the options each protocol supports)
+
+The --allow-* flags restrict who may connect to the service (clients have to match
+each of them, specify them multiple times to allow more than one user/IP/time window).
+Denied connection requests are rejected with an 'Access Denied' (403) error.
+
+Time windows are specified as '[days] [HH:MM-HH:MM]' in the device's local time
+(e.g. 'Mon-Fri 08:00-18:00', 'Sat,Sun' or '22:00-06:00').`,
+	Example: `  $ ondevice service add ssh ssh addr=127.0.0.1:22
+  $ ondevice service add web tcp addr=127.0.0.1:8080
+  $ ondevice service add db tcp addr=127.0.0.1:5432 --allow-user=alice --allow-ip=203.0.113.0/24 --allow-time="Mon-Fri 08:00-18:00"`,
+	Run:  serviceAddRun,
+	Args: cobra.MinimumNArgs(2),
+}
+
+var serviceRemoveCmd = &cobra.Command{
+	Use:     "rm <name>...",
+	Aliases: []string{"remove"},
+	Short:   "remove one or more services",
+	Run:     serviceRemoveRun,
+	Args:    cobra.MinimumNArgs(1),
+}
+
+var serviceShowCmd = &cobra.Command{
+	Use:   "show <name>",
+	Short: "print a service's protocol and options",
+	Example: `  $ ondevice service show web
+  name=web
+  protocol=tcp
+  addr=127.0.0.1:8080`,
+	Run:  serviceShowRun,
+	Args: cobra.ExactArgs(1),
+}
+
+var serviceAllowUsers, serviceAllowIPs, serviceAllowTimes []string
+
+func init() {
+	serviceAddCmd.Flags().StringArrayVar(&serviceAllowUsers, "allow-user", nil, "only allow this client user to connect")
+	serviceAddCmd.Flags().StringArrayVar(&serviceAllowIPs, "allow-ip", nil, "only allow clients with this IP address (or from this CIDR range) to connect")
+	serviceAddCmd.Flags().StringArrayVar(&serviceAllowTimes, "allow-time", nil, "only allow clients to connect during this time window")
+
+	rootCmd.AddCommand(serviceCmd)
+	serviceCmd.AddCommand(serviceListCmd)
+	serviceCmd.AddCommand(serviceAddCmd)
+	serviceCmd.AddCommand(serviceRemoveCmd)
+	serviceCmd.AddCommand(serviceShowCmd)
+}
+
+func serviceListRun(cmd *cobra.Command, args []string) {
+	var services = config.LoadServices()
+	if err := services.Error(); err != nil {
+		logrus.WithError(err).Fatal("failed to load services")
+	}
+
+	var list = services.ListServices()
+	var nameWidth, protocolWidth = 4, 8
+	for _, svc := range list {
+		if len(svc.Name) > nameWidth {
+			nameWidth = len(svc.Name)
+		}
+		if len(svc.Protocol) > protocolWidth {
+			protocolWidth = len(svc.Protocol)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "%-*s %-*s %s\n", nameWidth, "Name", protocolWidth, "Protocol", "Options")
+	for _, svc := range list {
+		fmt.Printf("%-*s %-*s %s\n", nameWidth, svc.Name, protocolWidth, svc.Protocol, strings.Join(serviceFormatOptions(svc), " "))
+	}
+}
+
+func serviceAddRun(cmd *cobra.Command, args []string) {
+	var name, protocol = args[0], args[1]
+	var options = make(map[string]string)
+
+	for _, keyValue := range args[2:] {
+		var parts = strings.SplitN(keyValue, "=", 2)
+		if len(parts) != 2 {
+			logrus.Fatalf("malformed option, expected key=value pairs: '%s'", keyValue)
+		}
+		if _, ok := options[parts[0]]; ok {
+			logrus.Fatalf("duplicate value for option '%s'", parts[0])
+		}
+		options[parts[0]] = parts[1]
+	}
+
+	var svc = config.NewService(name, protocol, options)
+	if len(serviceAllowUsers)+len(serviceAllowIPs)+len(serviceAllowTimes) > 0 {
+		svc.ACL = &config.ServiceACL{
+			Users: serviceAllowUsers,
+			IPs:   serviceAllowIPs,
+			Times: serviceAllowTimes,
+		}
+	}
+	if err := service.Validate(svc); err != nil {
+		logrus.WithError(err).Fatalf("invalid service definition: '%s'", name)
+	}
+
+	var services = config.LoadServices()
+	if err := services.Error(); err != nil {
+		logrus.WithError(err).Fatal("failed to load services")
+	}
+	if _, exists := services.GetService(name); exists {
+		logrus.Infof("replacing existing service '%s'", name)
+	}
+	if err := services.SetService(svc); err != nil {
+		logrus.WithError(err).Fatal("failed to add service")
+	}
+
+	serviceWrite(services)
+}
+
+func serviceRemoveRun(cmd *cobra.Command, args []string) {
+	var services = config.LoadServices()
+	if err := services.Error(); err != nil {
+		logrus.WithError(err).Fatal("failed to load services")
+	}
+
+	for _, name := range args {
+		if !services.RemoveService(name) {
+			logrus.Fatalf("service not found: '%s'", name)
+		}
+	}
+
+	serviceWrite(services)
+}
+
+func serviceShowRun(cmd *cobra.Command, args []string) {
+	var services = config.LoadServices()
+	if err := services.Error(); err != nil {
+		logrus.WithError(err).Fatal("failed to load services")
+	}
+
+	var svc, ok = services.GetService(args[0])
+	if !ok {
+		logrus.Fatalf("service not found: '%s'", args[0])
+	}
+
+	fmt.Printf("name=%s\n", svc.Name)
+	fmt.Printf("protocol=%s\n", svc.Protocol)
+	for _, opt := range serviceFormatOptions(svc) {
+		fmt.Println(opt)
+	}
+}
+
+// serviceFormatOptions -- returns the service's options as sorted list of 'key=value' strings (followed by its ACL entries)
+func serviceFormatOptions(svc config.Service) []string {
+	var rc = make([]string, 0, len(svc.Options))
+	for k, v := range svc.Options {
+		rc = append(rc, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(rc)
+
+	if acl := svc.ACL; acl != nil {
+		for _, user := range acl.Users {
+			rc = append(rc, "acl.user="+user)
+		}
+		for _, ip := range acl.IPs {
+			rc = append(rc, "acl.ip="+ip)
+		}
+		for _, t := range acl.Times {
+			rc = append(rc, fmt.Sprintf("acl.time='%s'", t))
+		}
+	}
+	return rc
+}
+
+// serviceWrite -- writes services.json and notifies the ondevice daemon (if it's running)
+func serviceWrite(services config.ServiceConfig) {
+	if !services.IsChanged() {
+		logrus.Info("ondevice service: nothing changed")
+		return
+	}
+
+	if err := services.Write(); err != nil {
+		logrus.WithError(err).Fatal("failed to write services.json")
+	}
+
+	// note that ondevice daemon re-reads services.json -> only do this AFTER services.Write()
+	if err := control.UpdateServices(); err != nil {
+		logrus.WithError(err).Debug("couldn't notify ondevice daemon (it's probably not running)")
+	}
+}
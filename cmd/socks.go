@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/spf13/cobra"
+)
+
+// socksCmd -- local SOCKS5 proxy, passing connections on to a device's 'socks' service
+type socksCmd struct {
+	forwardCmd
+}
+
+func init() {
+	var c socksCmd
+	c.protocolFlag = "socks"
+	c.Command = cobra.Command{
+		Use:   "socks <devId> [service]",
+		Short: "reach hosts on your device's network through a local SOCKS5 proxy",
+		Long: `listens on a local port and passes SOCKS5 connections on to one of your
+device's 'socks' services (no need for ssh or sshd).
+
+The device connects to the requested destinations (if its allow-list permits
+them, see 'ondevice service --help'). Only the CONNECT command is supported
+(i.e. no UDP or incoming connections).
+
+[service] defaults to 'socks'.`,
+		Example: `- set up the service on the device (allowing access to the local network)
+  $ ondevice service add socks socks allow=192.168.1.0/24,*.lan
+
+- start the proxy (on your machine) and use it
+  $ ondevice socks myDev &
+  $ curl --socks5-hostname 127.0.0.1:1080 http://printer.lan/`,
+		Run:               c.run,
+		Args:              cobra.RangeArgs(1, 2),
+		ValidArgsFunction: c.validateArgs,
+	}
+	rootCmd.AddCommand(&c.Command)
+
+	c.Flags().StringVar(&c.listenFlag, "listen", "127.0.0.1:1080", "local address to listen on (host:port)")
+	c.Flags().BoolVar(&c.muxFlag, "mux", false, "use a single multiplexed tunnel for all connections")
+}
+
+func (c *socksCmd) run(cmd *cobra.Command, args []string) {
+	var devID, svc = args[0], "socks"
+	if len(args) > 1 {
+		svc = args[1]
+	}
+
+	c.listenAndServe(devID, svc, func(addr net.Addr) {
+		fmt.Printf("SOCKS5 proxy for %s:%s listening on %s\n", devID, svc, addr)
+	})
+}
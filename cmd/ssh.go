@@ -75,6 +75,14 @@ Notes:
 }
 
 func (c *sshCmd) run(cmd *cobra.Command, args []string) {
+	var sshCommand = sshCommandLine(args)
+
+	// ExecExternalCommand won't return
+	internal.ExecExternalCommand(sshCommand[0], sshCommand)
+}
+
+// sshCommandLine -- returns the ssh command line (set up to connect through ondevice) for the given ssh arguments
+func sshCommandLine(args []string) []string {
 	var sshCommand = config.MustLoad().GetValue(config.CommandSSH).Strings()
 
 	// we use the ProxyCommand option to have ssh invoke 'ondevice pipe %h ssh'
@@ -85,8 +93,5 @@ func (c *sshCmd) run(cmd *cobra.Command, args []string) {
 		sshCommand = append(sshCommand, fmt.Sprintf("-oUserKnownHostsFile=%s", knownHostsPath.GetAbsolutePath()))
 	}
 
-	sshCommand = append(sshCommand, args...)
-
-	// ExecExternalCommand won't return
-	internal.ExecExternalCommand(sshCommand[0], sshCommand)
+	return append(sshCommand, args...)
 }
@@ -20,6 +20,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"text/tabwriter"
+	"time"
 
 	"github.com/ondevice/ondevice/config"
 	"github.com/ondevice/ondevice/control"
@@ -37,13 +39,24 @@ Exit Codes:
   0: daemon up and running
   1: on error
   2: daemon running but not online
-  3: daemon not running (or unreachable)`,
+  3: daemon not running (or unreachable)
+
+With --tunnels, the daemon's active tunnels are listed instead.`,
 	Example: `  $ ondevice status
   Device:
     devID:  demo.q5dkpm
     state:  online
     version:  0.4.4
 
+  $ ondevice status  # (the daemon can't reach the API server)
+  Device:
+    devID:  demo.q5dkpm
+    state:  backoff
+    retryAt:  2020-05-20T12:34:56Z
+    lastError:  Error opening websocket: dial tcp: i/o timeout
+    lastErrorAt:  2020-05-20T12:33:51Z
+    version:  0.4.4
+
   Client:
     version:  0.4.4
 
@@ -57,15 +70,21 @@ Exit Codes:
       "devId": "demo.q5dkpm",
       "state": "online"
     }
-  }`,
+  }
+
+  $ ondevice status --tunnels
+  ID        SERVICE  PROTOCOL  CLIENT              SINCE                 RX     TX
+  hwpnxcgo  ssh      ssh       demo@198.51.100.17  2020-05-20T12:34:56Z  3.1kB  12.4kB`,
 	Run: statusRun,
 }
 
 var jsonFlag bool
+var tunnelsFlag bool
 
 func init() {
 	rootCmd.AddCommand(statusCmd)
 	statusCmd.Flags().BoolVar(&jsonFlag, "json", false, "prints JSON formatted instead of human readable output")
+	statusCmd.Flags().BoolVar(&tunnelsFlag, "tunnels", false, "lists the daemon's active tunnels")
 }
 
 func statusRun(cmd *cobra.Command, args []string) {
@@ -74,7 +93,9 @@ func statusRun(cmd *cobra.Command, args []string) {
 		logrus.Fatal("too many arguments")
 	}
 
-	if jsonFlag {
+	if tunnelsFlag {
+		rc = statusPrintTunnels()
+	} else if jsonFlag {
 		rc = statusPrintJSON()
 	} else {
 		rc = statusPrint()
@@ -92,6 +113,13 @@ func statusPrint() int {
 		fmt.Println("Device:")
 		fmt.Println("  devID: ", state.Device["devId"])
 		fmt.Println("  state: ", state.Device["state"])
+		if retryAt, ok := state.Device["retryAt"]; ok {
+			fmt.Println("  retryAt: ", retryAt)
+		}
+		if lastError, ok := state.Device["lastError"]; ok {
+			fmt.Println("  lastError: ", lastError)
+			fmt.Println("  lastErrorAt: ", state.Device["lastErrorAt"])
+		}
 		fmt.Println("  version: ", state.Version)
 		fmt.Println("")
 	}
@@ -111,6 +139,47 @@ func statusPrintJSON() int {
 	return statusGetReturnCode(state)
 }
 
+func statusPrintTunnels() int {
+	tunnels, err := control.ListTunnels()
+	if err != nil {
+		logrus.WithError(err).Error("couldn't query the daemon's tunnels")
+		return 3
+	}
+
+	if jsonFlag {
+		buff, _ := json.MarshalIndent(tunnels, "", "  ")
+		fmt.Println(string(buff))
+		return 0
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSERVICE\tPROTOCOL\tCLIENT\tSINCE\tRX\tTX")
+	for _, t := range tunnels {
+		var client = t.ClientIP
+		if t.ClientUser != "" {
+			client = t.ClientUser + "@" + t.ClientIP
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Service, t.Protocol, client,
+			t.StartTs.Format(time.RFC3339), statusFormatBytes(t.BytesRead), statusFormatBytes(t.BytesWritten))
+	}
+	w.Flush()
+	return 0
+}
+
+// statusFormatBytes -- returns a human readable byte count (e.g. "12.4kB")
+func statusFormatBytes(count int64) string {
+	const unit = 1000
+	if count < unit {
+		return fmt.Sprintf("%dB", count)
+	}
+	var value, exp = float64(count) / unit, 0
+	for value >= unit && exp < 4 {
+		value /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%cB", value, "kMGTP"[exp])
+}
+
 func statusGetReturnCode(state control.DeviceState) int {
 	if state.Device == nil {
 		return 3 // missing "device" status -> daemon not running
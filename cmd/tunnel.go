@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/ondevice/ondevice/control"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// tunnelCmd represents the tunnel command
+var tunnelCmd = &cobra.Command{
+	Use:   "tunnel",
+	Short: "manage the tunnels connected to your device",
+	Long: `list or kill the tunnels 'ondevice daemon' is currently serving.
+
+Without a subcommand, this lists the active tunnels (like 'ondevice status --tunnels').`,
+	Example: `  $ ondevice tunnel
+  ID        SERVICE  PROTOCOL  CLIENT              SINCE                 RX     TX
+  hwpnxcgo  ssh      ssh       demo@198.51.100.17  2020-05-20T12:34:56Z  3.1kB  12.4kB
+  $ ondevice tunnel kill hwpnxcgo`,
+	Run:  tunnelListRun,
+	Args: cobra.NoArgs,
+}
+
+var tunnelListCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "list the daemon's active tunnels",
+	Run:     tunnelListRun,
+	Args:    cobra.NoArgs,
+}
+
+var tunnelKillCmd = &cobra.Command{
+	Use:   "kill <id>...",
+	Short: "close one or more active tunnels",
+	Long: `closes the given tunnels (and the connections to their services).
+
+The client will get an error telling it the device has closed the tunnel.`,
+	Run:  tunnelKillRun,
+	Args: cobra.MinimumNArgs(1),
+}
+
+func init() {
+	rootCmd.AddCommand(tunnelCmd)
+	tunnelCmd.AddCommand(tunnelListCmd)
+	tunnelCmd.AddCommand(tunnelKillCmd)
+}
+
+func tunnelListRun(cmd *cobra.Command, args []string) {
+	if rc := statusPrintTunnels(); rc != 0 {
+		os.Exit(rc)
+	}
+}
+
+func tunnelKillRun(cmd *cobra.Command, args []string) {
+	var failed = false
+	for _, tunnelID := range args {
+		if err := control.KillTunnel(tunnelID); err != nil {
+			logrus.WithError(err).Errorf("failed to kill tunnel '%s'", tunnelID)
+			failed = true
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
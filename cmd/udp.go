@@ -0,0 +1,198 @@
+package cmd
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ondevice/ondevice/cmd/internal"
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/service"
+	"github.com/ondevice/ondevice/tunnel"
+	"github.com/ondevice/ondevice/util"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// udpCmd -- relays UDP packets between a local port and one of the device's 'udp' services
+type udpCmd struct {
+	cobra.Command
+
+	listenFlag string
+
+	tunnel *tunnel.Tunnel
+	conn   *net.UDPConn
+
+	lock        sync.Mutex
+	sessions    map[string]*udpPeer // peer address -> session
+	peers       map[uint32]*udpPeer // session ID -> session
+	lastSession uint32
+}
+
+// udpPeer -- a local peer's session
+type udpPeer struct {
+	id       uint32
+	addr     *net.UDPAddr
+	lastUsed time.Time
+}
+
+func init() {
+	var c udpCmd
+	c.Command = cobra.Command{
+		Use:   "udp <devId> <service>",
+		Short: "forwards a local UDP port to one of your device's services",
+		Long: `binds a local UDP port and relays each packet it receives to the given 'udp'
+service on your device (see 'ondevice service --help').
+
+All packets share a single tunnel (which preserves packet boundaries). The
+device uses a separate socket for each local peer address, so responses will
+be routed back to the right peer (sessions idle for two minutes are closed).`,
+		Example: `- query the device's DNS server
+  $ ondevice service add dns udp addr=127.0.0.1:53 # (on the device)
+  $ ondevice udp myDev dns --listen 127.0.0.1:5353 &
+  $ dig @127.0.0.1 -p 5353 example.com
+
+- receive SNMP data
+  $ ondevice udp myDev snmp --listen 127.0.0.1:1161 &
+  $ snmpwalk -v2c -c public 127.0.0.1:1161`,
+		Run:               c.run,
+		Args:              cobra.ExactArgs(2),
+		ValidArgsFunction: c.validateArgs,
+	}
+	rootCmd.AddCommand(&c.Command)
+
+	c.Flags().StringVar(&c.listenFlag, "listen", "127.0.0.1:0", "local address to bind to (host:port, port 0 picks a random one)")
+}
+
+func (c *udpCmd) run(cmd *cobra.Command, args []string) {
+	var devID, svc = args[0], args[1]
+
+	auth, err := config.LoadAuth().GetClientAuthForDevice(devID)
+	if err != nil {
+		logrus.WithError(err).Fatal("missing client credentials")
+		return
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", c.listenFlag)
+	if err != nil {
+		logrus.WithError(err).Fatalf("invalid address: '%s'", c.listenFlag)
+		return
+	}
+	if c.conn, err = net.ListenUDP("udp", addr); err != nil {
+		logrus.WithError(err).Fatalf("failed to listen on '%s'", c.listenFlag)
+		return
+	}
+	defer c.conn.Close()
+
+	c.sessions = make(map[string]*udpPeer)
+	c.peers = make(map[uint32]*udpPeer)
+
+	c.tunnel = new(tunnel.Tunnel)
+	c.tunnel.EnableDatagrams()
+	c.tunnel.DataListeners = append(c.tunnel.DataListeners, c.onDatagram)
+	c.tunnel.CloseListeners = append(c.tunnel.CloseListeners, c.onClose)
+	if e := tunnel.Connect(c.tunnel, devID, svc, "udp", auth); e != nil {
+		util.FailWithAPIError(e)
+	}
+	defer c.tunnel.Close()
+
+	var done = make(chan struct{})
+	defer close(done)
+	go c.expireSessions(done)
+
+	logrus.Infof("forwarding UDP packets from %s to %s:%s", c.conn.LocalAddr(), devID, svc)
+	var buff = make([]byte, service.MaxUDPPayloadSize)
+	for {
+		count, peer, err := c.conn.ReadFromUDP(buff)
+		if err != nil {
+			logrus.WithError(err).Debug("stopped reading UDP packets")
+			return
+		}
+
+		var packet = service.EncodeUDPPacket(c.getSession(peer), buff[:count])
+		if err = c.tunnel.WriteDatagram(packet); err != nil {
+			logrus.WithError(err).Error("failed to forward UDP packet")
+		}
+	}
+}
+
+// getSession -- returns the session ID of the given peer (assigning a new one if necessary)
+func (c *udpCmd) getSession(peer *net.UDPAddr) uint32 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var key = peer.String()
+	var s, ok = c.sessions[key]
+	if !ok {
+		// session IDs are never reused (the device might still have a socket open for an expired one)
+		c.lastSession++
+		s = &udpPeer{id: c.lastSession, addr: peer}
+		logrus.Debugf("new UDP peer: %s (session %d)", key, s.id)
+		c.sessions[key] = s
+		c.peers[s.id] = s
+	}
+	s.lastUsed = time.Now()
+	return s.id
+}
+
+// expireSessions -- forgets peers that haven't sent or received anything for a while (until done is closed)
+func (c *udpCmd) expireSessions(done <-chan struct{}) {
+	var ticker = time.NewTicker(service.UDPSessionTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			c.lock.Lock()
+			for key, s := range c.sessions {
+				if now.Sub(s.lastUsed) > service.UDPSessionTimeout {
+					logrus.Debugf("UDP peer %s idle, closing session %d", key, s.id)
+					delete(c.sessions, key)
+					delete(c.peers, s.id)
+				}
+			}
+			c.lock.Unlock()
+		}
+	}
+}
+
+// onDatagram -- sends the device's response to the right peer
+func (c *udpCmd) onDatagram(datagram []byte) {
+	id, payload, err := service.DecodeUDPPacket(datagram)
+	if err != nil {
+		logrus.WithError(err).Error("dropping malformed UDP packet")
+		return
+	}
+
+	c.lock.Lock()
+	var peer *net.UDPAddr
+	if s := c.peers[id]; s != nil {
+		s.lastUsed = time.Now()
+		peer = s.addr
+	}
+	c.lock.Unlock()
+	if peer == nil {
+		logrus.Debugf("dropping UDP packet for unknown session %d", id)
+		return
+	}
+
+	if _, err = c.conn.WriteToUDP(payload, peer); err != nil {
+		logrus.WithError(err).Debugf("failed to send UDP packet to %s", peer)
+	}
+}
+
+func (c *udpCmd) onClose() {
+	// interrupts the ReadFromUDP() in run()
+	logrus.Info("tunnel closed")
+	c.conn.Close()
+}
+
+// validateArgs -- does shell completion
+func (c *udpCmd) validateArgs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return internal.DeviceListCompletion{DontIgnoreUser: true}.Run(cmd, args, toComplete)
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
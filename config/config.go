@@ -95,6 +95,24 @@ func (c Config) AllValues() map[string]string {
 	return rc
 }
 
+// GetBool -- Returns the specified boolean config value (or its default value if not found or on error)
+func (c Config) GetBool(key Key) bool {
+	var strVal = c.GetString(key)
+	var rc, err = strconv.ParseBool(strVal)
+	if err == nil {
+		return rc
+	}
+
+	if strVal != "" {
+		logrus.WithError(err).Errorf("failed to parse value for '%v' (expected boolean): '%s'", key, strVal)
+	}
+	if rc, err = strconv.ParseBool(key.defaultValue); err != nil {
+		// fail hard because the default value is not a bool (i.e. there's a coding issue)
+		logrus.WithError(err).Fatalf("expected boolean default value for config key '%v', not '%s'", key, key.defaultValue)
+	}
+	return rc
+}
+
 // GetInt -- Returns the specified integer config value (or defaultValue if not found or on error)
 func (c Config) GetInt(key Key) int {
 	var strVal = c.GetString(key)
@@ -262,6 +280,32 @@ func (c Config) LoadAuth() AuthConfig {
 	return &rc
 }
 
+// LoadServices -- fetches the services stored in services.json
+//
+// uses [path].services_json as reference
+func (c Config) LoadServices() ServiceConfig {
+	var path = c.GetPath(PathServicesJSON)
+	if path.Error() != nil {
+		logrus.WithError(path.Error()).Fatal("failed to load services.json path")
+	}
+
+	var rc = internal.LoadServices(path.GetAbsolutePath())
+	return &rc
+}
+
+// LoadGroups -- fetches the device groups stored in groups.json
+//
+// uses [path].groups_json as reference
+func (c Config) LoadGroups() GroupConfig {
+	var path = c.GetPath(PathGroupsJSON)
+	if path.Error() != nil {
+		logrus.WithError(path.Error()).Fatal("failed to load groups.json path")
+	}
+
+	var rc = internal.LoadGroups(path.GetAbsolutePath())
+	return &rc
+}
+
 // Init -- sets up configuration, called by cobra.OnInitialize()
 func Init(cfgFile string) {
 	if cfgFile != "" {
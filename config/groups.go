@@ -0,0 +1,43 @@
+package config
+
+import (
+	"github.com/ondevice/ondevice/config/internal"
+)
+
+// Group -- a named selection of devices (referenced as '@name'), either a saved filter expression or a static list of devIDs
+type Group = internal.GroupEntry
+
+// GroupConfig -- loads/stores the device groups defined in groups.json
+//
+// implemented by config.internal.GroupsJSON
+type GroupConfig interface {
+	// Error -- returns errors that happened while loading groups.json (a missing file isn't an error)
+	Error() error
+
+	// GetGroup -- returns the group with the given name (or false if not found)
+	GetGroup(name string) (Group, bool)
+
+	// IsChanged -- returns true once SetGroup() or RemoveGroup() has been called
+	IsChanged() bool
+
+	// ListGroups -- returns all the groups (sorted by name)
+	ListGroups() []Group
+
+	// RemoveGroup -- removes the given group, returns false if it didn't exist
+	//
+	// You need to call Write() to actually update groups.json
+	RemoveGroup(name string) bool
+
+	// SetGroup -- adds or replaces a group
+	//
+	// You need to call Write() to actually update groups.json
+	SetGroup(group Group) error
+
+	// Write -- updates groups.json
+	Write() error
+}
+
+// LoadGroups -- shorthand for MustLoad().LoadGroups()
+func LoadGroups() GroupConfig {
+	return MustLoad().LoadGroups()
+}
@@ -0,0 +1,15 @@
+package internal
+
+import (
+	"strconv"
+)
+
+// BoolParser -- validates boolean config values ('true', 'false', '1', '0', ...)
+type BoolParser struct{}
+
+// Value -- returns a Value object for the given string
+func (p BoolParser) Value(raw string) ValueImpl {
+	var rc = ValueImpl{parser: p}
+	_, rc.err = strconv.ParseBool(raw)
+	return rc
+}
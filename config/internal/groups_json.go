@@ -0,0 +1,138 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// groupNameRe -- valid group names (referenced as '@name')
+var groupNameRe = regexp.MustCompile(`^[a-zA-Z0-9_.\-]+$`)
+
+// GroupEntry -- a named selection of devices, either a saved filter expression or a static list of devIDs
+type GroupEntry struct {
+	// Name -- the group name (without the '@'), filled in by GroupsJSON
+	Name string `json:"-"`
+
+	// Filters -- filter expressions selecting the group's devices (devices have to match all of them, see 'ondevice list --help')
+	Filters []string `json:"filters,omitempty"`
+
+	// Devices -- static list of devIDs (qualified or unqualified)
+	Devices []string `json:"devices,omitempty"`
+}
+
+// GroupsJSON -- marshals/unmarshals the contents of the groups.json file
+type GroupsJSON struct {
+	Groups map[string]GroupEntry `json:"groups"`
+
+	path string
+	err  error
+
+	isChanged bool
+}
+
+// Error -- returns any error that might have happened in LoadGroups()
+func (j GroupsJSON) Error() error {
+	return j.err
+}
+
+// GetGroup -- returns the group with the given name (the bool is false if it doesn't exist)
+func (j GroupsJSON) GetGroup(name string) (GroupEntry, bool) {
+	var rc, ok = j.Groups[name]
+	rc.Name = name
+	return rc, ok
+}
+
+// IsChanged -- returns true if one of the setters has been called
+func (j GroupsJSON) IsChanged() bool { return j.isChanged }
+
+// ListGroups -- returns all the groups, sorted by name
+func (j GroupsJSON) ListGroups() []GroupEntry {
+	var names = make([]string, 0, len(j.Groups))
+	for name := range j.Groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rc = make([]GroupEntry, 0, len(names))
+	for _, name := range names {
+		var entry, _ = j.GetGroup(name)
+		rc = append(rc, entry)
+	}
+	return rc
+}
+
+// RemoveGroup -- removes the given group (returns false if it didn't exist)
+func (j *GroupsJSON) RemoveGroup(name string) bool {
+	if _, ok := j.Groups[name]; !ok {
+		return false
+	}
+	delete(j.Groups, name)
+	j.isChanged = true
+	return true
+}
+
+// SetGroup -- creates/updates a group (don't forget to call .Write())
+func (j *GroupsJSON) SetGroup(entry GroupEntry) error {
+	if !groupNameRe.MatchString(entry.Name) {
+		return fmt.Errorf("invalid group name: '%s'", entry.Name)
+	}
+	if (len(entry.Filters) == 0) == (len(entry.Devices) == 0) {
+		return fmt.Errorf("group '%s' needs either a filter or a list of devices", entry.Name)
+	}
+
+	if j.Groups == nil {
+		j.Groups = make(map[string]GroupEntry)
+	}
+	j.Groups[entry.Name] = entry
+	j.isChanged = true
+	return nil
+}
+
+// Write -- atomically update groups.json
+func (j GroupsJSON) Write() error {
+	var data, err = json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		logrus.WithError(err).Error("failed to marshal groups.json data")
+		return err
+	}
+
+	return WriteFile(data, j.path, 0o644)
+}
+
+// LoadGroups -- Read groups.json from the given file path
+//
+// A missing file isn't an error (there simply aren't any groups).
+// Other errors will be stored in .Error() (and the returned GroupsJSON won't contain any groups)
+func LoadGroups(path string) GroupsJSON {
+	var rc = GroupsJSON{
+		path:   path,
+		Groups: map[string]GroupEntry{},
+	}
+
+	var data, err = ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return rc
+	} else if err != nil {
+		logrus.WithError(err).WithField("path", path).Error("failed to read groups.json")
+		rc.err = err
+		return rc
+	}
+
+	if err = json.Unmarshal(data, &rc); err != nil {
+		logrus.WithError(err).WithField("path", path).Error("failed to parse groups.json")
+		rc.Groups = map[string]GroupEntry{}
+		rc.err = err
+		return rc
+	}
+
+	if rc.Groups == nil {
+		rc.Groups = map[string]GroupEntry{}
+	}
+	return rc
+}
@@ -0,0 +1,48 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestWriteGroups -- groups.json roundtrip
+func TestWriteGroups(t *testing.T) {
+	var assert = assert.New(t)
+	var dir, err = ioutil.TempDir("", "ondevice-test")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "groups.json")
+	var groups = LoadGroups(path)
+	assert.NoError(groups.Error())
+	assert.Empty(groups.ListGroups())
+
+	assert.NoError(groups.SetGroup(GroupEntry{Name: "prod-eu", Filters: []string{"env=prod", "region=eu"}}))
+	assert.NoError(groups.SetGroup(GroupEntry{Name: "db", Devices: []string{"db1", "demo.db2"}}))
+	assert.Error(groups.SetGroup(GroupEntry{Name: "empty"}))
+	assert.Error(groups.SetGroup(GroupEntry{Name: "both", Filters: []string{"a"}, Devices: []string{"b"}}))
+	assert.Error(groups.SetGroup(GroupEntry{Name: "@invalid", Filters: []string{"a"}}))
+	assert.True(groups.IsChanged())
+	assert.NoError(groups.Write())
+
+	groups = LoadGroups(path)
+	assert.NoError(groups.Error())
+	assert.False(groups.IsChanged())
+
+	var list = groups.ListGroups()
+	if assert.Len(list, 2) {
+		assert.Equal("db", list[0].Name)
+		assert.Equal([]string{"db1", "demo.db2"}, list[0].Devices)
+		assert.Equal("prod-eu", list[1].Name)
+		assert.Equal([]string{"env=prod", "region=eu"}, list[1].Filters)
+	}
+
+	assert.True(groups.RemoveGroup("db"))
+	assert.False(groups.RemoveGroup("db"))
+	_, ok := groups.GetGroup("db")
+	assert.False(ok)
+}
@@ -0,0 +1,179 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ServiceEntry -- a single service offered by `ondevice daemon`
+type ServiceEntry struct {
+	// Name -- the service name clients connect to (e.g. 'ssh' or 'web'), filled in by ServicesJSON
+	Name string `json:"-"`
+
+	// Protocol -- the protocol announced to the API server (e.g. 'ssh', 'tcp' or 'echo')
+	Protocol string `json:"protocol"`
+
+	// Options -- protocol specific settings (e.g. 'addr' for TCP services)
+	Options map[string]string `json:"options,omitempty"`
+
+	// ACL -- restricts who may connect to this service (if nil, anyone with access to the device may)
+	ACL *ServiceACL `json:"acl,omitempty"`
+}
+
+// ServiceACL -- a service's access control list
+//
+// Clients need to match each of the non-empty lists
+type ServiceACL struct {
+	// Users -- the client users allowed to connect
+	Users []string `json:"users,omitempty"`
+
+	// IPs -- the client IP addresses (or CIDR ranges) allowed to connect (e.g. '192.0.2.1' or '10.0.0.0/8')
+	IPs []string `json:"ips,omitempty"`
+
+	// Times -- the (local) time windows during which clients may connect (e.g. 'Mon-Fri 08:00-18:00')
+	Times []string `json:"times,omitempty"`
+}
+
+// IsEmpty -- returns true if the ACL doesn't restrict access
+func (a *ServiceACL) IsEmpty() bool {
+	return a == nil || (len(a.Users) == 0 && len(a.IPs) == 0 && len(a.Times) == 0)
+}
+
+// Option -- returns the given option (or defaultValue if not set)
+func (e ServiceEntry) Option(key string, defaultValue string) string {
+	if val, ok := e.Options[key]; ok {
+		return val
+	}
+	return defaultValue
+}
+
+// ServicesJSON -- marshals/unmarshals the contents of the services.json file
+type ServicesJSON struct {
+	Services map[string]ServiceEntry `json:"services"`
+
+	path string
+	err  error
+
+	isChanged bool
+}
+
+// Error -- returns any error that might have happened in LoadServices()
+func (j ServicesJSON) Error() error {
+	return j.err
+}
+
+// GetService -- returns the service with the given name (the bool is false if it doesn't exist)
+func (j ServicesJSON) GetService(name string) (ServiceEntry, bool) {
+	var rc, ok = j.Services[name]
+	rc.Name = name
+	return rc, ok
+}
+
+// IsChanged -- returns true if one of the setters has been called
+func (j ServicesJSON) IsChanged() bool { return j.isChanged }
+
+// ListServices -- returns all the services, sorted by name
+func (j ServicesJSON) ListServices() []ServiceEntry {
+	var names = make([]string, 0, len(j.Services))
+	for name := range j.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var rc = make([]ServiceEntry, 0, len(names))
+	for _, name := range names {
+		var entry, _ = j.GetService(name)
+		rc = append(rc, entry)
+	}
+	return rc
+}
+
+// RemoveService -- removes the given service (returns false if it didn't exist)
+func (j *ServicesJSON) RemoveService(name string) bool {
+	if _, ok := j.Services[name]; !ok {
+		return false
+	}
+	delete(j.Services, name)
+	j.isChanged = true
+	return true
+}
+
+// SetService -- creates/updates a service (don't forget to call .Write())
+func (j *ServicesJSON) SetService(entry ServiceEntry) error {
+	if entry.Name == "" {
+		return fmt.Errorf("missing service name")
+	}
+	if entry.Protocol == "" {
+		return fmt.Errorf("missing protocol for service '%s'", entry.Name)
+	}
+
+	if j.Services == nil {
+		j.Services = make(map[string]ServiceEntry)
+	}
+	j.Services[entry.Name] = entry
+	j.isChanged = true
+	return nil
+}
+
+// Write -- atomically update services.json
+func (j ServicesJSON) Write() error {
+	var data, err = json.MarshalIndent(j, "", "  ")
+	if err != nil {
+		logrus.WithError(err).Error("failed to marshal services.json data")
+		return err
+	}
+
+	return WriteFile(data, j.path, 0o644)
+}
+
+// LoadServices -- Read services.json from the given file path
+//
+// If the file doesn't exist, this returns the default services (i.e. 'ssh' pointing to
+// $SSH_ADDR or 127.0.0.1:22 - that's what `ondevice daemon` used to offer before services were configurable).
+//
+// Other errors will be stored in .Error() (and the returned ServicesJSON won't contain any services)
+func LoadServices(path string) ServicesJSON {
+	var rc = ServicesJSON{
+		path:     path,
+		Services: map[string]ServiceEntry{},
+	}
+
+	var data, err = ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		rc.Services = defaultServices()
+		return rc
+	} else if err != nil {
+		logrus.WithError(err).WithField("path", path).Error("failed to read services.json")
+		rc.err = err
+		return rc
+	}
+
+	if err = json.Unmarshal(data, &rc); err != nil {
+		logrus.WithError(err).WithField("path", path).Error("failed to parse services.json")
+		rc.Services = map[string]ServiceEntry{}
+		rc.err = err
+		return rc
+	}
+
+	if rc.Services == nil {
+		rc.Services = map[string]ServiceEntry{}
+	}
+	return rc
+}
+
+func defaultServices() map[string]ServiceEntry {
+	// SSH_ADDR is used by the docker image (and has been around long before services.json)
+	var addr = os.Getenv("SSH_ADDR")
+	if addr == "" {
+		addr = "127.0.0.1:22"
+	}
+
+	return map[string]ServiceEntry{
+		"ssh": {Protocol: "ssh", Options: map[string]string{"addr": addr}},
+	}
+}
@@ -0,0 +1,59 @@
+package internal
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// TestDefaultServices -- a missing services.json results in the default 'ssh' service
+func TestDefaultServices(t *testing.T) {
+	var assert = assert.New(t)
+	os.Setenv("SSH_ADDR", "ssh:2222")
+	defer os.Unsetenv("SSH_ADDR")
+
+	var services = LoadServices("/tmp/nonexisting/services.json")
+	assert.NoError(services.Error())
+	assert.Len(services.ListServices(), 1)
+
+	var ssh, ok = services.GetService("ssh")
+	assert.True(ok)
+	assert.Equal("ssh", ssh.Name)
+	assert.Equal("ssh", ssh.Protocol)
+	assert.Equal("ssh:2222", ssh.Option("addr", ""))
+}
+
+// TestWriteServices -- services.json roundtrip
+func TestWriteServices(t *testing.T) {
+	var assert = assert.New(t)
+	var dir, err = ioutil.TempDir("", "ondevice-test")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "services.json")
+	var services = LoadServices(path)
+	assert.True(services.RemoveService("ssh"))
+	assert.NoError(services.SetService(ServiceEntry{Name: "web", Protocol: "tcp", Options: map[string]string{"addr": "127.0.0.1:8080"}}))
+	assert.NoError(services.SetService(ServiceEntry{Name: "db", Protocol: "tcp", Options: map[string]string{"addr": "127.0.0.1:5432"}}))
+	assert.Error(services.SetService(ServiceEntry{Name: "broken"}))
+	assert.True(services.IsChanged())
+	assert.NoError(services.Write())
+
+	services = LoadServices(path)
+	assert.NoError(services.Error())
+	assert.False(services.IsChanged())
+
+	var list = services.ListServices()
+	assert.Len(list, 2)
+	assert.Equal("db", list[0].Name)
+	assert.Equal("web", list[1].Name)
+	assert.Equal("127.0.0.1:8080", list[1].Option("addr", ""))
+	assert.Equal("fallback", list[1].Option("missing", "fallback"))
+
+	_, ok := services.GetService("ssh")
+	assert.False(ok)
+	assert.False(services.RemoveService("ssh"))
+}
@@ -30,6 +30,71 @@ var KeyDeviceID = regKey(Key{
 	ro:           true,
 })
 
+// KeyDeviceRetryMin -- the minimum delay (in seconds) before 'ondevice daemon' tries to reconnect
+var KeyDeviceRetryMin = regKey(Key{
+	section: "device", key: "retry-min",
+	defaultValue: "10",
+	parser:       internal.IntParser{}.WithMin(1),
+})
+
+// KeyDeviceRetryMax -- the maximum delay (in seconds) before 'ondevice daemon' tries to reconnect
+//
+// (the delay grows with each failed attempt)
+var KeyDeviceRetryMax = regKey(Key{
+	section: "device", key: "retry-max",
+	defaultValue: "300",
+	parser:       internal.IntParser{}.WithMin(1),
+})
+
+// KeyDeviceRetryJitter -- randomizes reconnect delays by up to this percentage
+//
+// (to prevent devices from reconnecting in lockstep after an outage)
+var KeyDeviceRetryJitter = regKey(Key{
+	section: "device", key: "retry-jitter",
+	defaultValue: "50",
+	parser:       internal.IntParser{}.WithMin(0).WithMax(100),
+})
+
+// KeyDeviceMetricsAddr -- if set, 'ondevice daemon' serves Prometheus metrics on this TCP address (e.g. '127.0.0.1:9101')
+//
+// (regardless of this setting, metrics are always available at the control socket's /metrics endpoint)
+var KeyDeviceMetricsAddr = regKey(Key{
+	section: "device", key: "metrics-addr",
+	defaultValue: "",
+})
+
+// KeyDeviceRequireApproval -- if true, 'ondevice daemon' waits for a local user to approve incoming connections
+//
+// (see 'ondevice approve')
+var KeyDeviceRequireApproval = regKey(Key{
+	section: "device", key: "require-approval",
+	defaultValue: "false",
+	parser:       internal.BoolParser{},
+})
+
+// KeyDeviceApprovalTimeout -- the time (in seconds) the daemon waits for connections to be approved before rejecting them
+//
+// clients give up after 30 seconds, so higher values don't make much sense
+var KeyDeviceApprovalTimeout = regKey(Key{
+	section: "device", key: "approval-timeout",
+	defaultValue: "25",
+	parser:       internal.IntParser{}.WithMin(1),
+})
+
+// KeyDeviceAuditMaxSize -- the size (in kB) at which 'ondevice daemon' rotates its audit log (see path.audit_log)
+var KeyDeviceAuditMaxSize = regKey(Key{
+	section: "device", key: "audit-max-size",
+	defaultValue: "10240",
+	parser:       internal.IntParser{}.WithMin(1),
+})
+
+// KeyDeviceAuditBackups -- the number of rotated audit logs to keep (audit.log.1, audit.log.2, ...)
+var KeyDeviceAuditBackups = regKey(Key{
+	section: "device", key: "audit-backups",
+	defaultValue: "5",
+	parser:       internal.IntParser{}.WithMin(0),
+})
+
 // CommandRSYNC -- the path to the 'rsync' command
 var CommandRSYNC = regKey(Key{
 	section: "command", key: "rsync",
@@ -58,6 +123,13 @@ var CommandSSH = regKey(Key{
 	parser:       internal.CommandParser{},
 })
 
+// PathAuditLog -- the path to the daemon's connection audit log (JSON lines), relative to 'ondevice.conf'
+var PathAuditLog = regKey(Key{
+	section: "path", key: "audit_log",
+	defaultValue: "audit.log",
+	parser:       internal.PathParser{},
+})
+
 // PathAuthJSON -- the path to 'auth.json', relative to 'ondevice.conf'
 var PathAuthJSON = regKey(Key{
 	section: "path", key: "auth_json",
@@ -65,6 +137,13 @@ var PathAuthJSON = regKey(Key{
 	parser:       internal.PathParser{},
 })
 
+// PathGroupsJSON -- the path to 'groups.json' (your named device groups, see 'ondevice group'), relative to 'ondevice.conf'
+var PathGroupsJSON = regKey(Key{
+	section: "path", key: "groups_json",
+	defaultValue: "groups.json",
+	parser:       internal.PathParser{},
+})
+
 // PathKnownHosts -- the path to our 'known_hosts' file, relative to 'ondevice.conf'
 var PathKnownHosts = regKey(Key{
 	section: "path", key: "known_hosts",
@@ -81,6 +160,22 @@ var PathOndevicePID = regKey(Key{
 	parser:       internal.PathParser{AllowMultiple: true},
 })
 
+// PathSSHHostKey -- the host key of the built-in SSH server (see 'ondevice service'), relative to 'ondevice.conf'
+//
+// will be generated if it doesn't exist
+var PathSSHHostKey = regKey(Key{
+	section: "path", key: "ssh_host_key",
+	defaultValue: "ssh_host_key",
+	parser:       internal.PathParser{},
+})
+
+// PathServicesJSON -- the path to 'services.json' (the services 'ondevice daemon' offers), relative to 'ondevice.conf'
+var PathServicesJSON = regKey(Key{
+	section: "path", key: "services_json",
+	defaultValue: "services.json",
+	parser:       internal.PathParser{},
+})
+
 // PathOndeviceSock -- the path to 'ondevice.sock', relative to 'ondevice.conf'
 //
 // if you specify more than one, clients will try them in order. ondevice daemon will always use the first one
@@ -0,0 +1,57 @@
+package config
+
+import (
+	"github.com/ondevice/ondevice/config/internal"
+)
+
+// Service -- a service offered by `ondevice daemon` (name, protocol and protocol-specific options)
+type Service = internal.ServiceEntry
+
+// ServiceACL -- restricts who may connect to a service (users, IPs and time windows)
+type ServiceACL = internal.ServiceACL
+
+// ServiceConfig -- loads/stores the services offered by this device
+//
+// implemented by config.internal.ServicesJSON
+type ServiceConfig interface {
+	// Error -- returns errors that happened while loading services.json
+	//
+	// a missing services.json isn't an error (in that case the default 'ssh' service will be returned)
+	Error() error
+
+	// GetService -- returns the service with the given name (or false if not found)
+	GetService(name string) (Service, bool)
+
+	// IsChanged -- returns true once SetService() or RemoveService() has been called
+	IsChanged() bool
+
+	// ListServices -- returns all configured services (sorted by name)
+	ListServices() []Service
+
+	// RemoveService -- removes the given service, returns false if it didn't exist
+	//
+	// You need to call Write() to actually update services.json
+	RemoveService(name string) bool
+
+	// SetService -- adds or replaces a service
+	//
+	// You need to call Write() to actually update services.json
+	SetService(svc Service) error
+
+	// Write -- updates services.json
+	Write() error
+}
+
+// NewService -- creates a new Service definition
+func NewService(name string, protocol string, options map[string]string) Service {
+	return internal.ServiceEntry{
+		Name:     name,
+		Protocol: protocol,
+		Options:  options,
+	}
+}
+
+// LoadServices -- shorthand for MustLoad().LoadServices()
+func LoadServices() ServiceConfig {
+	return MustLoad().LoadServices()
+}
@@ -4,6 +4,7 @@ import (
 	"net/url"
 
 	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/daemon"
 	"github.com/sirupsen/logrus"
 )
 
@@ -14,6 +15,39 @@ func GetState() (DeviceState, error) {
 	return rc, err
 }
 
+// ListTunnels -- Query the ondevice daemon's active tunnels
+func ListTunnels() ([]daemon.TunnelInfo, error) {
+	var rc []daemon.TunnelInfo
+	err := request{endpoint: "/tunnels"}.Get().ReadJSON(&rc)
+	return rc, err
+}
+
+// KillTunnel -- Tell the ondevice daemon to close one of its active tunnels
+func KillTunnel(tunnelID string) error {
+	var resp = request{endpoint: "/tunnels/" + url.PathEscape(tunnelID)}.Do("DELETE")
+	defer resp.Close()
+	return resp.Error()
+}
+
+// ListPending -- Query the connection requests waiting for approval
+func ListPending() ([]daemon.PendingConnection, error) {
+	var rc []daemon.PendingConnection
+	err := request{endpoint: "/pending"}.Get().ReadJSON(&rc)
+	return rc, err
+}
+
+// ApproveConnection -- Tell the ondevice daemon to approve (or deny) a pending connection request
+func ApproveConnection(id string, approve bool) error {
+	var action = "deny"
+	if approve {
+		action = "approve"
+	}
+
+	var resp = request{endpoint: "/pending/" + url.PathEscape(id) + "/" + action}.PostForm(url.Values{})
+	defer resp.Close()
+	return resp.Error()
+}
+
 // Login -- Send device login credentials to the ondevice daemon
 //
 // Note: the daemon and client might share config/auth files. In that case it's important that they don't
@@ -33,3 +67,12 @@ func Login(auth config.Auth) error {
 
 	return resp.Error()
 }
+
+// UpdateServices -- Tell the ondevice daemon that services.json has been changed
+//
+// call this AFTER you've called ServiceConfig.Write()
+func UpdateServices() error {
+	var resp = request{endpoint: "/services"}.PostForm(url.Values{})
+	defer resp.Close()
+	return resp.Error()
+}
@@ -9,6 +9,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/ondevice/ondevice/api"
@@ -23,6 +24,10 @@ type ControlSocket struct {
 
 	URL    url.URL
 	server http.Server
+
+	// MetricsAddr -- if set, /metrics will also be served on this TCP address (host:port)
+	MetricsAddr   string
+	metricsServer http.Server
 }
 
 // NewSocket -- Creates a new ControlSocket instance
@@ -35,8 +40,18 @@ func NewSocket(d *daemon.Daemon, u url.URL) *ControlSocket {
 	var mux = new(http.ServeMux)
 	mux.HandleFunc("/state", rc.getStateHandler)
 	mux.HandleFunc("/login", rc.postLoginHandler)
+	mux.HandleFunc("/services", rc.postServicesHandler)
+	mux.HandleFunc("/tunnels", rc.getTunnelsHandler)
+	mux.HandleFunc("/tunnels/", rc.deleteTunnelHandler)
+	mux.HandleFunc("/metrics", rc.getMetricsHandler)
+	mux.HandleFunc("/pending", rc.getPendingHandler)
+	mux.HandleFunc("/pending/", rc.postPendingHandler)
 	rc.server.Handler = mux
 
+	var metricsMux = new(http.ServeMux)
+	metricsMux.HandleFunc("/metrics", rc.getMetricsHandler)
+	rc.metricsServer.Handler = metricsMux
+
 	return &rc
 }
 
@@ -57,12 +72,25 @@ func (c *ControlSocket) Start() {
 	}
 
 	go c.run(proto, path)
+
+	if c.MetricsAddr != "" {
+		c.metricsServer.Addr = c.MetricsAddr
+		go func() {
+			logrus.Info("serving metrics on ", c.MetricsAddr)
+			if err := c.metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logrus.WithError(err).Error("couldn't set up metrics listener")
+			}
+		}()
+	}
 }
 
 // Stop -- Stops the ControlSocket
 func (c *ControlSocket) Stop() error {
 	var ctx, cancelFn = context.WithTimeout(context.Background(), 5*time.Second)
 	var err = c.server.Shutdown(ctx)
+	if c.MetricsAddr != "" {
+		c.metricsServer.Shutdown(ctx)
+	}
 	if err != nil {
 		logrus.Error("failed to stop ControlSocket: ", err)
 	} else {
@@ -96,18 +124,25 @@ func (c *ControlSocket) run(protocol string, path string) {
 
 // getStateHandler -- implements GET /state
 func (c *ControlSocket) getStateHandler(w http.ResponseWriter, r *http.Request) {
-	devState := "offline"
-	if c.Daemon != nil && c.Daemon.IsOnline() {
-		devState = "online"
-	}
-
 	data := DeviceState{
 		Version: config.GetVersion(),
 		Device: map[string]string{
-			"state": devState,
+			"state": daemon.StateOffline,
 		},
 	}
 
+	if c.Daemon != nil {
+		var state = c.Daemon.State()
+		data.Device["state"] = state.State
+		if state.State == daemon.StateBackoff {
+			data.Device["retryAt"] = state.RetryAt.Format(time.RFC3339)
+		}
+		if state.LastError != "" {
+			data.Device["lastError"] = state.LastError
+			data.Device["lastErrorAt"] = state.LastErrorAt.Format(time.RFC3339)
+		}
+	}
+
 	data.Device["devId"] = config.MustLoad().GetString(config.KeyDeviceID)
 	_sendJSON(w, data)
 }
@@ -143,6 +178,104 @@ func (c *ControlSocket) postLoginHandler(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+// postServicesHandler -- implements POST /services (tells the daemon that services.json has changed)
+func (c *ControlSocket) postServicesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		_sendError(w, http.StatusMethodNotAllowed, "expected POST request")
+		return
+	}
+
+	logrus.Info("services changed, announcing them")
+	if c.Daemon != nil {
+		c.Daemon.AnnounceServices()
+	}
+}
+
+// getTunnelsHandler -- implements GET /tunnels (lists the daemon's active tunnels)
+func (c *ControlSocket) getTunnelsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		_sendError(w, http.StatusMethodNotAllowed, "expected GET request")
+		return
+	}
+
+	var data = []daemon.TunnelInfo{}
+	if c.Daemon != nil {
+		data = c.Daemon.ListTunnels()
+	}
+	_sendJSON(w, data)
+}
+
+// deleteTunnelHandler -- implements DELETE /tunnels/<id> (kills the given tunnel)
+func (c *ControlSocket) deleteTunnelHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		_sendError(w, http.StatusMethodNotAllowed, "expected DELETE request")
+		return
+	}
+
+	var tunnelID = strings.TrimPrefix(r.URL.Path, "/tunnels/")
+	if tunnelID == "" || strings.Contains(tunnelID, "/") {
+		_sendError(w, http.StatusBadRequest, "expected /tunnels/<id>")
+		return
+	}
+	if c.Daemon == nil {
+		_sendError(w, http.StatusNotFound, "tunnel not found")
+		return
+	}
+
+	if err := c.Daemon.KillTunnel(tunnelID); err != nil {
+		_sendError(w, err.Code(), err.Error())
+	}
+}
+
+// getPendingHandler -- implements GET /pending (lists the connection requests waiting for approval)
+func (c *ControlSocket) getPendingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		_sendError(w, http.StatusMethodNotAllowed, "expected GET request")
+		return
+	}
+
+	var data = []daemon.PendingConnection{}
+	if c.Daemon != nil {
+		data = c.Daemon.ListPending()
+	}
+	_sendJSON(w, data)
+}
+
+// postPendingHandler -- implements POST /pending/<id>/approve and POST /pending/<id>/deny
+func (c *ControlSocket) postPendingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		_sendError(w, http.StatusMethodNotAllowed, "expected POST request")
+		return
+	}
+
+	var parts = strings.Split(strings.TrimPrefix(r.URL.Path, "/pending/"), "/")
+	if len(parts) != 2 || parts[0] == "" || (parts[1] != "approve" && parts[1] != "deny") {
+		_sendError(w, http.StatusBadRequest, "expected /pending/<id>/approve or /pending/<id>/deny")
+		return
+	}
+	if c.Daemon == nil {
+		_sendError(w, http.StatusNotFound, "no pending connection with that ID")
+		return
+	}
+
+	if err := c.Daemon.ApproveConnection(parts[0], parts[1] == "approve"); err != nil {
+		_sendError(w, err.Code(), err.Error())
+	}
+}
+
+// getMetricsHandler -- implements GET /metrics (Prometheus text format)
+func (c *ControlSocket) getMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		_sendError(w, http.StatusMethodNotAllowed, "expected GET request")
+		return
+	}
+
+	w.Header().Set("Content-type", "text/plain; version=0.0.4")
+	if c.Daemon != nil {
+		c.Daemon.WriteMetrics(w)
+	}
+}
+
 func _sendError(w http.ResponseWriter, statusCode int, msg string) {
 	json.Marshal(struct {
 		ErrorCode int
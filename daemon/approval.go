@@ -0,0 +1,109 @@
+package daemon
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ondevice/ondevice/util"
+)
+
+// PendingConnection -- a connection request waiting for the device's user to approve it (see 'ondevice approve')
+type PendingConnection struct {
+	// ID -- the tunnel's ID
+	ID         string `json:"id"`
+	Service    string `json:"service"`
+	Protocol   string `json:"protocol"`
+	ClientUser string `json:"clientUser,omitempty"`
+	ClientIP   string `json:"clientIp,omitempty"`
+
+	RequestTs time.Time `json:"requestTs"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// approvalQueue -- keeps track of the connection requests waiting for approval
+type approvalQueue struct {
+	lock    sync.Mutex
+	pending map[string]*pendingRequest
+}
+
+type pendingRequest struct {
+	info   PendingConnection
+	result chan bool
+}
+
+// wait -- parks the given connection request until it's been approved/denied (or times out)
+//
+// returns a 403 error if the connection was denied (or nobody answered in time)
+func (q *approvalQueue) wait(info TunnelInfo, timeout time.Duration) util.APIError {
+	var now = time.Now()
+	var req = pendingRequest{
+		info: PendingConnection{
+			ID:         info.ID,
+			Service:    info.Service,
+			Protocol:   info.Protocol,
+			ClientUser: info.ClientUser,
+			ClientIP:   info.ClientIP,
+			RequestTs:  now,
+			ExpiresAt:  now.Add(timeout),
+		},
+		result: make(chan bool, 1),
+	}
+
+	q.lock.Lock()
+	if q.pending == nil {
+		q.pending = make(map[string]*pendingRequest)
+	}
+	q.pending[info.ID] = &req
+	q.lock.Unlock()
+
+	defer func() {
+		q.lock.Lock()
+		delete(q.pending, info.ID)
+		q.lock.Unlock()
+	}()
+
+	var timer = time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case approved := <-req.result:
+		if !approved {
+			return util.NewAPIError(util.ForbiddenError, "connection denied by the device's user")
+		}
+		return nil
+	case <-timer.C:
+		return util.NewAPIError(util.ForbiddenError, "connection wasn't approved in time")
+	}
+}
+
+// list -- returns the pending connection requests (oldest first)
+func (q *approvalQueue) list() []PendingConnection {
+	q.lock.Lock()
+	var rc = make([]PendingConnection, 0, len(q.pending))
+	for _, req := range q.pending {
+		rc = append(rc, req.info)
+	}
+	q.lock.Unlock()
+
+	sort.Slice(rc, func(i, j int) bool {
+		return rc[i].RequestTs.Before(rc[j].RequestTs)
+	})
+	return rc
+}
+
+// decide -- approves or denies the given pending connection request
+func (q *approvalQueue) decide(id string, approve bool) util.APIError {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var req, ok = q.pending[id]
+	if !ok {
+		return util.NewAPIError(util.NotFoundError, "no pending connection with ID: ", id)
+	}
+
+	// remove it right away (so that it can't be decided twice)
+	delete(q.pending, id)
+	req.result <- approve
+	return nil
+}
@@ -0,0 +1,40 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ondevice/ondevice/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApprovalQueue(t *testing.T) {
+	var q approvalQueue
+	var result = make(chan util.APIError, 1)
+
+	// approve
+	go func() { result <- q.wait(TunnelInfo{ID: "abc", Service: "ssh"}, time.Minute) }()
+	for len(q.list()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, "ssh", q.list()[0].Service)
+	assert.NoError(t, q.decide("abc", true))
+	assert.Nil(t, <-result)
+	assert.Empty(t, q.list())
+
+	// can't decide twice (or about unknown requests)
+	assert.Equal(t, util.NotFoundError, q.decide("abc", false).Code())
+
+	// deny
+	go func() { result <- q.wait(TunnelInfo{ID: "def"}, time.Minute) }()
+	for len(q.list()) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assert.NoError(t, q.decide("def", false))
+	assert.Equal(t, util.ForbiddenError, (<-result).Code())
+
+	// timeout
+	var err = q.wait(TunnelInfo{ID: "ghi"}, 10*time.Millisecond)
+	assert.Equal(t, util.ForbiddenError, err.Code())
+	assert.Empty(t, q.list())
+}
@@ -0,0 +1,169 @@
+package daemon
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/sirupsen/logrus"
+)
+
+// AuditEntry -- a record in the daemon's audit log (see config.PathAuditLog)
+//
+// Each connection attempt is recorded right away (Event: AuditConnect), accepted ones
+// get another entry once they've been closed (Event: AuditClose)
+type AuditEntry struct {
+	Ts         time.Time `json:"ts"`
+	Event      string    `json:"event,omitempty"` // empty for entries written by older versions (which only recorded the connection once it was closed)
+	TunnelID   string    `json:"tunnelId"`
+	Service    string    `json:"service"`
+	Protocol   string    `json:"protocol"`
+	ClientUser string    `json:"clientUser,omitempty"`
+	ClientIP   string    `json:"clientIp,omitempty"`
+
+	// Accepted -- false if the connection was rejected or failed (see ErrorCode and Reason)
+	Accepted  bool   `json:"accepted"`
+	ErrorCode int    `json:"errorCode,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+
+	// Duration -- the time the tunnel was open (in seconds, only set for AuditClose entries, as are the byte counts)
+	Duration     float64 `json:"duration"`
+	BytesRead    int64   `json:"bytesRead"`
+	BytesWritten int64   `json:"bytesWritten"`
+}
+
+// AuditEntry.Event values
+const (
+	// AuditConnect -- a connection has been accepted (or rejected)
+	AuditConnect = "connect"
+	// AuditClose -- an accepted connection has been closed
+	AuditClose = "close"
+)
+
+// auditLog -- append-only JSON lines log of connection attempts (rotated once it exceeds maxSize bytes)
+type auditLog struct {
+	lock    sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+}
+
+func newAuditLog(cfg config.Config) *auditLog {
+	var path = cfg.GetPath(config.PathAuditLog)
+	if path.Error() != nil || path.GetPath() == "" {
+		logrus.WithError(path.Error()).Error("invalid audit log path, not writing audit log")
+		return nil
+	}
+
+	return &auditLog{
+		path:    path.GetAbsolutePath(),
+		maxSize: int64(cfg.GetInt(config.KeyDeviceAuditMaxSize)) * 1024,
+		backups: cfg.GetInt(config.KeyDeviceAuditBackups),
+	}
+}
+
+// write -- appends the given entry to the audit log (rotating it if necessary)
+func (l *auditLog) write(entry AuditEntry) {
+	var data, err = json.Marshal(entry)
+	if err != nil {
+		logrus.WithError(err).Error("failed to encode audit log entry")
+		return
+	}
+	data = append(data, '\n')
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if info, err := os.Stat(l.path); err == nil && info.Size()+int64(len(data)) > l.maxSize {
+		l._rotate()
+	}
+
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		logrus.WithError(err).Error("failed to open audit log: ", l.path)
+		return
+	}
+	defer f.Close()
+
+	if _, err = f.Write(data); err != nil {
+		logrus.WithError(err).Error("failed to write audit log entry")
+	}
+}
+
+// _rotate -- renames audit.log to audit.log.1 (and audit.log.1 to audit.log.2, ...), dropping the oldest one
+func (l *auditLog) _rotate() {
+	if l.backups == 0 {
+		if err := os.Remove(l.path); err != nil {
+			logrus.WithError(err).Error("failed to truncate audit log")
+		}
+		return
+	}
+
+	os.Remove(_auditLogBackup(l.path, l.backups))
+	for i := l.backups - 1; i >= 1; i-- {
+		os.Rename(_auditLogBackup(l.path, i), _auditLogBackup(l.path, i+1))
+	}
+	if err := os.Rename(l.path, _auditLogBackup(l.path, 1)); err != nil {
+		logrus.WithError(err).Error("failed to rotate audit log")
+	}
+}
+
+// ReadAuditLog -- calls cb for each entry of the given audit log (and its rotated backups), oldest first
+//
+// stops early if cb returns false
+func ReadAuditLog(path string, cb func(AuditEntry) bool) error {
+	// find the oldest backup
+	var count = 0
+	for {
+		if _, err := os.Stat(_auditLogBackup(path, count+1)); err != nil {
+			break
+		}
+		count++
+	}
+
+	for i := count; i >= 0; i-- {
+		var filename = path
+		if i > 0 {
+			filename = _auditLogBackup(path, i)
+		}
+
+		if ok, err := _readAuditLogFile(filename, cb); err != nil {
+			if i == 0 && os.IsNotExist(err) {
+				break // the current log hasn't been created yet (e.g. right after rotating)
+			}
+			return err
+		} else if !ok {
+			break
+		}
+	}
+	return nil
+}
+
+func _readAuditLogFile(filename string, cb func(AuditEntry) bool) (bool, error) {
+	var f, err = os.Open(filename)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	var scanner = bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			logrus.WithError(err).Warningf("skipping malformed audit log entry in '%s'", filename)
+			continue
+		}
+		if !cb(entry) {
+			return false, nil
+		}
+	}
+	return true, scanner.Err()
+}
+
+func _auditLogBackup(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
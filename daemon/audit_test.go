@@ -0,0 +1,94 @@
+package daemon
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ondevice/ondevice/tunnel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditLog(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "ondevice-audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "audit.log")
+	var l = auditLog{path: path, maxSize: 400, backups: 2}
+
+	var ts = time.Date(2020, 5, 20, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		l.write(AuditEntry{Ts: ts.Add(time.Duration(i) * time.Minute), TunnelID: "t", Service: "ssh", Accepted: i%2 == 0})
+	}
+
+	// rotated (but only two backups were kept)
+	_, err = os.Stat(path + ".2")
+	assert.NoError(t, err)
+	_, err = os.Stat(path + ".3")
+	assert.True(t, os.IsNotExist(err))
+
+	var entries []AuditEntry
+	assert.NoError(t, ReadAuditLog(path, func(e AuditEntry) bool {
+		entries = append(entries, e)
+		return true
+	}))
+	assert.True(t, len(entries) > 0 && len(entries) < 10)
+	for i := 1; i < len(entries); i++ {
+		assert.True(t, entries[i-1].Ts.Before(entries[i].Ts))
+	}
+	assert.Equal(t, ts.Add(9*time.Minute), entries[len(entries)-1].Ts.UTC())
+
+	// stops early
+	var count = 0
+	assert.NoError(t, ReadAuditLog(path, func(e AuditEntry) bool {
+		count++
+		return false
+	}))
+	assert.Equal(t, 1, count)
+}
+
+func TestAuditTunnel(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "ondevice-audit")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "audit.log")
+	var d = deviceSocket{
+		activeTunnels: &tunnelRegistry{},
+		auditLog:      &auditLog{path: path, maxSize: 1024 * 1024},
+		metrics:       newMetrics(),
+	}
+
+	var readLog = func() []AuditEntry {
+		var rc []AuditEntry
+		assert.NoError(t, ReadAuditLog(path, func(e AuditEntry) bool {
+			rc = append(rc, e)
+			return true
+		}))
+		return rc
+	}
+
+	// accepted connections are logged right away
+	var info = TunnelInfo{ID: "t1", Service: "ssh", Protocol: "ssh", ClientUser: "demo", StartTs: time.Now()}
+	var handle = &tunnel.Tunnel{}
+	d._addTunnel(handle, info)
+	var entries = readLog()
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, AuditConnect, entries[0].Event)
+		assert.Equal(t, "t1", entries[0].TunnelID)
+		assert.True(t, entries[0].Accepted)
+	}
+
+	// ... and get a separate entry once they've been closed
+	d._removeTunnel(handle, info, nil)
+	entries = readLog()
+	if assert.Len(t, entries, 2) {
+		assert.Equal(t, AuditClose, entries[1].Event)
+		assert.Equal(t, "t1", entries[1].TunnelID)
+		assert.True(t, entries[1].Accepted)
+	}
+	assert.Empty(t, d.activeTunnels.list())
+}
@@ -0,0 +1,66 @@
+package daemon
+
+import (
+	"math/rand"
+	"time"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/util"
+)
+
+// backoffFactor -- the reconnect delay grows by this factor with each failed attempt
+const backoffFactor = 1.5
+
+// backoff -- reconnect policy (exponential backoff with jitter)
+type backoff struct {
+	min, max time.Duration
+	jitter   float64 // randomizes each delay by up to this fraction (0..1)
+
+	attempt int
+	random  func() float64 // returns a number in [0,1), replaced in tests
+}
+
+// newBackoff -- returns a backoff policy using the 'device.retry-*' config values
+func newBackoff(cfg config.Config) *backoff {
+	var rc = backoff{
+		min:    time.Duration(cfg.GetInt(config.KeyDeviceRetryMin)) * time.Second,
+		max:    time.Duration(cfg.GetInt(config.KeyDeviceRetryMax)) * time.Second,
+		jitter: float64(cfg.GetInt(config.KeyDeviceRetryJitter)) / 100,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())).Float64,
+	}
+	if rc.max < rc.min {
+		rc.max = rc.min
+	}
+	return &rc
+}
+
+// next -- returns how long to wait before the next attempt
+//
+// Delays grow exponentially from min to max and are shortened by a random amount
+// (up to jitter). If the server told us when to try again (e.g. when we've been rate
+// limited), we'll wait at least that long (again adding some jitter).
+func (b *backoff) next(err error) time.Duration {
+	var delay = b.min
+	for i := 0; i < b.attempt && delay < b.max; i++ {
+		delay = time.Duration(float64(delay) * backoffFactor)
+	}
+	if delay > b.max {
+		delay = b.max
+	}
+	b.attempt++
+
+	if retryAfter := util.RetryAfter(err); retryAfter > 0 {
+		return retryAfter + time.Duration(b.jitter*b.random()*float64(retryAfter))
+	} else if apiErr, ok := err.(util.APIError); ok && apiErr.Code() == util.TooManyRequestsError {
+		// rate limited, but we don't know for how long -> wait as long as we can
+		delay = b.max
+		return delay + time.Duration(b.jitter*b.random()*float64(delay))
+	}
+
+	return delay - time.Duration(b.jitter*b.random()*float64(delay))
+}
+
+// reset -- call this once we've successfully connected
+func (b *backoff) reset() {
+	b.attempt = 0
+}
@@ -0,0 +1,43 @@
+package daemon
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ondevice/ondevice/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackoff(t *testing.T) {
+	var random = 0.0
+	var b = backoff{
+		min:    10 * time.Second,
+		max:    60 * time.Second,
+		jitter: 0.5,
+		random: func() float64 { return random },
+	}
+	var err = util.NewAPIError(util.OtherError, "connection failed")
+
+	// grows exponentially (up to max)
+	assert.Equal(t, 10*time.Second, b.next(err))
+	assert.Equal(t, 15*time.Second, b.next(err))
+	assert.Equal(t, 22500*time.Millisecond, b.next(err))
+	for i := 0; i < 10; i++ {
+		b.next(err)
+	}
+	assert.Equal(t, 60*time.Second, b.next(err))
+
+	// jitter shortens the delay
+	random = 0.5
+	assert.Equal(t, 45*time.Second, b.next(err))
+
+	// ... back to min after a successful connection
+	b.reset()
+	random = 0
+	assert.Equal(t, 10*time.Second, b.next(err))
+
+	// rate limited -> wait at least as long as the server asks us to
+	random = 0.5
+	assert.Equal(t, 125*time.Second, b.next(util.NewRetryAfterError(util.TooManyRequestsError, 100*time.Second, "slow down")))
+	assert.Equal(t, 75*time.Second, b.next(util.NewAPIError(util.TooManyRequestsError, "slow down")))
+}
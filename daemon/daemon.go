@@ -1,12 +1,15 @@
 package daemon
 
 import (
+	"io"
+	"net/http"
 	"os"
 	"os/signal"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/ondevice/ondevice/config"
 	"github.com/ondevice/ondevice/util"
 	"github.com/sirupsen/logrus"
 )
@@ -25,14 +28,45 @@ type Daemon struct {
 	signalChan    chan os.Signal
 	firstSIGTERM  time.Time
 	lock          lockFile
-	activeTunnels sync.WaitGroup
+	activeTunnels tunnelRegistry
+	approvals     approvalQueue
+	auditLog      *auditLog
 	shutdown      bool
+	stopped       chan struct{} // closed by Close() (to interrupt the reconnect delay)
+	stopOnce      sync.Once
+
+	stateLock sync.Mutex
+	state     ConnectionState
+	metrics   *metrics
 
 	Control      ControlSocket
 	OnConnection func(tunnelID string, service string, protocol string)
 	OnError      func(error)
 }
 
+// ConnectionState -- describes the daemon's connection to the API server (see Daemon.State())
+type ConnectionState struct {
+	// State -- one of StateOffline, StateConnecting, StateOnline or StateBackoff
+	State string
+	// RetryAt -- (only set for StateBackoff) when we'll try to reconnect
+	RetryAt time.Time
+
+	// LastError -- the error that caused the last reconnect (empty if there hasn't been one)
+	LastError   string
+	LastErrorAt time.Time
+}
+
+const (
+	// StateOffline -- the daemon isn't running (or is shutting down)
+	StateOffline = "offline"
+	// StateConnecting -- we're connecting to the API server
+	StateConnecting = "connecting"
+	// StateOnline -- the device is online
+	StateOnline = "online"
+	// StateBackoff -- the connection failed, we'll retry at ConnectionState.RetryAt
+	StateBackoff = "backoff"
+)
+
 type pingMsg struct {
 	Type string `json:"_type"`
 	Ts   int    `json:"ts"`
@@ -42,6 +76,9 @@ type pingMsg struct {
 func NewDaemon() *Daemon {
 	return &Daemon{
 		signalChan: make(chan os.Signal, 1),
+		stopped:    make(chan struct{}),
+		state:      ConnectionState{State: StateOffline},
+		metrics:    newMetrics(),
 	}
 }
 
@@ -62,29 +99,45 @@ func (d *Daemon) Run() int {
 	go d.signalHandler()
 	signal.Notify(d.signalChan, syscall.SIGTERM, syscall.SIGINT)
 
-	// TODO implement a sane way to stop this infinite loop (at least SIGTERM, SIGINT or maybe a unix socket call)
-	retryDelay := 10 * time.Second
-	for !d.shutdown {
+	var cfg = config.MustLoad()
+	var policy = newBackoff(cfg)
+	d.auditLog = newAuditLog(cfg)
+	for attempt := 0; !d.shutdown; attempt++ {
 		var ws = new(deviceSocket)
 		ws.activeTunnels = &d.activeTunnels
+		ws.approvals = &d.approvals
+		ws.auditLog = d.auditLog
+		ws.metrics = d.metrics
+		if attempt > 0 {
+			d.metrics.onReconnect()
+		}
 
+		d._setState(StateConnecting, time.Time{})
 		if err := ws.connect(); err != nil {
-			retryDelay = d.waitBeforeRetry(retryDelay, err)
-		} else {
-			d.ws = ws
-			ws.Wait()
-
-			if !d.shutdown {
-				// connection was successful -> restart after 10sec
-				logrus.Warning("lost device connection, reconnecting in 10s")
-				retryDelay = 10
-				time.Sleep(retryDelay * time.Second)
-			}
+			d.waitBeforeRetry(policy, err)
+			continue
+		}
+
+		d.ws = ws
+		ws.Wait()
+		d.metrics.setOnline(false)
+		if d.shutdown {
+			break
 		}
+
+		if ws.wasOnline {
+			policy.reset()
+		}
+		var err = ws.lastError
+		if err == nil {
+			err = util.NewAPIError(util.OtherError, "lost device connection")
+		}
+		d.waitBeforeRetry(policy, err)
 	}
+	d._setState(StateOffline, time.Time{})
 
 	logrus.Info("Stopped ondevice daemon, waiting for remaining tunnels to close (if any...)")
-	d.activeTunnels.Wait()
+	d.activeTunnels.wait()
 
 	return 0
 }
@@ -92,6 +145,7 @@ func (d *Daemon) Run() int {
 // Close -- Gracefully stopping this ondevice daemon instance
 func (d *Daemon) Close() {
 	d.shutdown = true
+	d.stopOnce.Do(func() { close(d.stopped) })
 	if d.Control != nil {
 		d.Control.Stop()
 	}
@@ -99,11 +153,72 @@ func (d *Daemon) Close() {
 	d.lock.Unlock()
 }
 
+// AnnounceServices -- (re-)announces the services configured in services.json
+//
+// Called when services have been added or updated. Removed services won't be unannounced, but
+// connections to them will be rejected (and they'll be gone after the next reconnect)
+func (d *Daemon) AnnounceServices() {
+	if !d.IsOnline() {
+		logrus.Debug("not announcing services, device is offline")
+		return
+	}
+	d.ws.announceServices()
+}
+
 // IsOnline -- Returns true if this device is online right now
 func (d *Daemon) IsOnline() bool {
 	return d.ws != nil && d.ws.IsOnline
 }
 
+// ListTunnels -- returns the daemon's active tunnels (oldest first)
+func (d *Daemon) ListTunnels() []TunnelInfo {
+	return d.activeTunnels.list()
+}
+
+// KillTunnel -- closes the given active tunnel (telling the client why)
+func (d *Daemon) KillTunnel(tunnelID string) util.APIError {
+	var t = d.activeTunnels.get(tunnelID)
+	if t == nil {
+		return util.NewAPIError(util.NotFoundError, "tunnel not found: ", tunnelID)
+	}
+
+	logrus.Infof("killing tunnel '%s'", tunnelID)
+	t.CloseWithError(http.StatusGone, "tunnel closed by the device")
+	return nil
+}
+
+// ListPending -- returns the connection requests waiting for approval (oldest first, see config.KeyDeviceRequireApproval)
+func (d *Daemon) ListPending() []PendingConnection {
+	return d.approvals.list()
+}
+
+// ApproveConnection -- approves (or denies) the given pending connection request
+func (d *Daemon) ApproveConnection(id string, approve bool) util.APIError {
+	if approve {
+		logrus.Infof("connection '%s' approved", id)
+	} else {
+		logrus.Infof("connection '%s' denied", id)
+	}
+	return d.approvals.decide(id, approve)
+}
+
+// WriteMetrics -- writes the daemon's metrics in the Prometheus text format
+func (d *Daemon) WriteMetrics(w io.Writer) {
+	d.metrics.write(w, d.State().State, d.ListTunnels())
+}
+
+// State -- returns the current state of the connection to the API server
+func (d *Daemon) State() ConnectionState {
+	d.stateLock.Lock()
+	var rc = d.state
+	d.stateLock.Unlock()
+
+	if rc.State == StateConnecting && d.IsOnline() {
+		rc.State = StateOnline
+	}
+	return rc
+}
+
 func (d *Daemon) signalHandler() {
 	for true {
 		var sig, ok = <-d.signalChan
@@ -132,31 +247,38 @@ func (d *Daemon) signalHandler() {
 	logrus.Info("stopping to handle signals")
 }
 
-func (d *Daemon) waitBeforeRetry(retryDelay time.Duration, err util.APIError) time.Duration {
+func (d *Daemon) waitBeforeRetry(policy *backoff, err util.APIError) {
 	// only abort here if it's an authentication issue
 	if err.Code() == util.AuthenticationError {
 		logrus.WithError(err).Fatal("authentication failed")
 	}
 
-	// keep retryDelay between 10 and 120sec
-	if retryDelay > 120*time.Second {
-		retryDelay = 120 * time.Second
-	}
-	if retryDelay < 10*time.Second {
-		retryDelay = 10 * time.Second
-	}
-	// ... unless we've been rate-limited
-	if err.Code() == util.TooManyRequestsError {
-		retryDelay = 600 * time.Second
+	var delay = policy.next(err)
+	var retryAt = time.Now().Add(delay)
+
+	d.stateLock.Lock()
+	d.state = ConnectionState{
+		State:       StateBackoff,
+		RetryAt:     retryAt,
+		LastError:   err.Error(),
+		LastErrorAt: time.Now(),
 	}
+	d.stateLock.Unlock()
 
-	logrus.WithError(err).Errorf("device error - retrying in %ds", retryDelay/time.Second)
+	logrus.WithError(err).Errorf("device error - retrying in %s", delay.Round(time.Second))
 
-	// sleep to avoid flooding the servers
-	time.Sleep(retryDelay)
+	// sleep to avoid flooding the servers (but don't delay shutting down)
+	select {
+	case <-time.After(delay):
+	case <-d.stopped:
+	}
+}
 
-	// slowly increase retryDelay with each failed attempt
-	return time.Duration(float32(retryDelay) * 1.5)
+func (d *Daemon) _setState(state string, retryAt time.Time) {
+	d.stateLock.Lock()
+	d.state.State = state
+	d.state.RetryAt = retryAt
+	d.stateLock.Unlock()
 }
 
 func _contains(m *map[string]interface{}, key string) bool {
@@ -165,7 +287,14 @@ func _contains(m *map[string]interface{}, key string) bool {
 }
 
 func _getInt(m *map[string]interface{}, key string) int64 {
-	return (*m)[key].(int64)
+	// encoding/json decodes numbers as float64
+	switch val := (*m)[key].(type) {
+	case float64:
+		return int64(val)
+	case int64:
+		return val
+	}
+	return 0
 }
 
 func _getString(m *map[string]interface{}, key string) string {
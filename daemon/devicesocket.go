@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"net/http"
 	"runtime"
-	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -20,11 +19,16 @@ import (
 type deviceSocket struct {
 	tunnel.Connection
 
-	IsOnline bool
+	IsOnline  bool
+	wasOnline bool          // true once we've received the API server's 'hello'
+	lastError util.APIError // the last error the API server sent us
 
 	wdog          *util.Watchdog
 	lastPing      time.Time
-	activeTunnels *sync.WaitGroup
+	activeTunnels *tunnelRegistry
+	approvals     *approvalQueue
+	auditLog      *auditLog
+	metrics       *metrics
 }
 
 func (d *deviceSocket) announce(service string, protocol string) {
@@ -32,6 +36,23 @@ func (d *deviceSocket) announce(service string, protocol string) {
 	d.SendJSON(data)
 }
 
+// announceServices -- announce all the services configured in services.json
+func (d *deviceSocket) announceServices() {
+	var services = config.LoadServices()
+	if err := services.Error(); err != nil {
+		logrus.WithError(err).Error("failed to load services, not announcing any")
+		return
+	}
+
+	for _, svc := range services.ListServices() {
+		logrus.Debugf("announcing service '%s' (protocol: %s)", svc.Name, svc.Protocol)
+		d.announce(svc.Name, svc.Protocol)
+	}
+
+	// multiplexed tunnels can connect to any of the above
+	d.announce(tunnel.MuxService, tunnel.MuxService)
+}
+
 // connect -- Go online
 func (d *deviceSocket) connect(auths ...config.Auth) util.APIError {
 	var cfg, err = config.Load()
@@ -54,6 +75,7 @@ func (d *deviceSocket) connect(auths ...config.Auth) util.APIError {
 		return err
 	}
 
+	d.PongListeners = append(d.PongListeners, d.metrics.onPong)
 	d.wdog = util.NewWatchdog(180*time.Second, d.onTimeout)
 	return nil
 }
@@ -68,16 +90,168 @@ func (d *deviceSocket) onConnect(msg *map[string]interface{}) {
 
 	logrus.Infof("connection request for %s:%s from user %s@%s", protocol, svc, clientUser, clientIP)
 
-	handler := service.GetServiceHandler(svc, protocol)
+	var t = new(tunnel.Tunnel)
+	var info = TunnelInfo{
+		ID:         tunnelID,
+		Service:    svc,
+		Protocol:   protocol,
+		ClientUser: clientUser,
+		ClientIP:   clientIP,
+		StartTs:    time.Now(),
+	}
+
+	t.ErrorListeners = append(t.ErrorListeners, func(err util.APIError) {
+		logrus.WithError(err).Error("tunnel error")
+		d.metrics.onTunnelError(err.Code())
+	})
+
+	var client = service.Client{User: clientUser, IP: clientIP}
+	if svc == tunnel.MuxService && protocol == tunnel.MuxService {
+		// each of the mux tunnel's streams has to be approved on its own (see muxHooks())
+		d._addTunnel(t, info)
+		var err = service.RunMux(t, tunnelID, brokerURL, client, d.muxHooks(info))
+		d._removeTunnel(t, info, err)
+		return
+	}
+
+	s, accessErr := service.FindService(svc, protocol)
+	if accessErr == nil {
+		accessErr = service.CheckAccess(s, client)
+	}
+	if accessErr == nil {
+		// before connecting to the service (i.e. before dialing its socket, running its command, ...)
+		accessErr = d.awaitApproval(info)
+	}
+	if accessErr != nil {
+		d._reject(info, accessErr)
+		return
+	}
+
+	handler := service.GetProtocolHandler(s, client)
 	if handler == nil {
-		d.SendConnectionError(http.StatusNotFound, fmt.Sprintf("Couldn't find service: '%s'", svc), tunnelID)
 		logrus.Error("coudln't find protocol handler: ", protocol)
+		d._reject(info, util.NewAPIError(http.StatusNotFound, fmt.Sprintf("Couldn't find service: '%s'", svc)))
 		return
 	}
 
-	d.activeTunnels.Add(1)
-	service.Run(handler, tunnelID, brokerURL)
-	d.activeTunnels.Done()
+	d._addTunnel(t, info)
+	var err = service.Run(handler, t, tunnelID, brokerURL)
+	if err == nil {
+		t.Wait()
+	}
+	d._removeTunnel(t, info, err)
+}
+
+// awaitApproval -- if config.KeyDeviceRequireApproval is set, waits for the device's user to approve the connection
+func (d *deviceSocket) awaitApproval(info TunnelInfo) util.APIError {
+	var cfg = config.MustLoad()
+	if !cfg.GetBool(config.KeyDeviceRequireApproval) {
+		return nil
+	}
+
+	var timeout = time.Duration(cfg.GetInt(config.KeyDeviceApprovalTimeout)) * time.Second
+	logrus.Infof("waiting for connection '%s' to be approved (see 'ondevice approve')", info.ID)
+	var err = d.approvals.wait(info, timeout)
+	if err != nil {
+		logrus.WithError(err).Warningf("rejecting connection '%s'", info.ID)
+	}
+	return err
+}
+
+// muxHooks -- asks for approval of each of a mux tunnel's streams and records them (in the tunnel list, metrics and audit log)
+//
+// Note that the mux tunnel's own byte counters include the traffic of all of its streams
+func (d *deviceSocket) muxHooks(muxInfo TunnelInfo) service.MuxHooks {
+	var streamInfo = func(s *tunnel.Stream) TunnelInfo {
+		var info = muxInfo
+		info.ID = fmt.Sprintf("%s:%d", muxInfo.ID, s.ID) // no slashes (see the control socket's /tunnels/<id>)
+		info.Service = s.Service
+		info.Protocol = s.Protocol
+		info.StartTs = s.Stats().StartTs
+		return info
+	}
+
+	return service.MuxHooks{
+		Approve: func(s *tunnel.Stream) util.APIError {
+			return d.awaitApproval(streamInfo(s))
+		},
+		Opened: func(s *tunnel.Stream) {
+			d._addTunnel(s, streamInfo(s))
+		},
+		Closed: func(s *tunnel.Stream, err util.APIError) {
+			var info = streamInfo(s)
+			if err != nil {
+				// rejected streams never made it into activeTunnels
+				d.metrics.onTunnelError(err.Code())
+				d._auditConnect(info, err)
+				return
+			}
+			d._removeTunnel(s, info, nil)
+		},
+	}
+}
+
+func (d *deviceSocket) _addTunnel(t tunnelHandle, info TunnelInfo) {
+	d.activeTunnels.add(t, info)
+	d.metrics.onTunnelOpened(info.Service)
+	d._auditConnect(info, nil)
+}
+
+// _removeTunnel -- unregisters the tunnel once it's been closed (err is set if accepting it failed)
+func (d *deviceSocket) _removeTunnel(t tunnelHandle, info TunnelInfo, err error) {
+	var stats = t.Stats()
+	d.activeTunnels.remove(info.ID)
+	d.metrics.onTunnelClosed(info.Service, stats)
+	d._auditClose(info, err, stats)
+}
+
+// _reject -- tells the API server we won't accept the connection
+func (d *deviceSocket) _reject(info TunnelInfo, err util.APIError) {
+	d.SendConnectionError(err.Code(), err.Error(), info.ID)
+	d.metrics.onTunnelError(err.Code())
+	d._auditConnect(info, err)
+}
+
+// _auditConnect -- records a connection attempt in the audit log (err is nil if it's been accepted)
+func (d *deviceSocket) _auditConnect(info TunnelInfo, err error) {
+	d._audit(_newAuditEntry(AuditConnect, info, err))
+}
+
+// _auditClose -- records the end of an accepted connection in the audit log (err is set if accepting it failed)
+func (d *deviceSocket) _auditClose(info TunnelInfo, err error, stats tunnel.Stats) {
+	var entry = _newAuditEntry(AuditClose, info, err)
+	entry.BytesRead = stats.BytesRead
+	entry.BytesWritten = stats.BytesWritten
+	if !stats.StartTs.IsZero() {
+		entry.Duration = entry.Ts.Sub(stats.StartTs).Seconds()
+	}
+	d._audit(entry)
+}
+
+func (d *deviceSocket) _audit(entry AuditEntry) {
+	if d.auditLog != nil {
+		d.auditLog.write(entry)
+	}
+}
+
+func _newAuditEntry(event string, info TunnelInfo, err error) AuditEntry {
+	var rc = AuditEntry{
+		Ts:         time.Now(),
+		Event:      event,
+		TunnelID:   info.ID,
+		Service:    info.Service,
+		Protocol:   info.Protocol,
+		ClientUser: info.ClientUser,
+		ClientIP:   info.ClientIP,
+		Accepted:   err == nil,
+	}
+	if err != nil {
+		rc.Reason = err.Error()
+		if apiErr, ok := err.(util.APIError); ok {
+			rc.ErrorCode = apiErr.Code()
+		}
+	}
+	return rc
 }
 
 func (d *deviceSocket) onError(msg *map[string]interface{}) {
@@ -86,6 +260,8 @@ func (d *deviceSocket) onError(msg *map[string]interface{}) {
 	var codeName = tunnel.GetErrorCodeName(int(code))
 
 	d.IsOnline = false
+	d.metrics.setOnline(false)
+	d.lastError = util.NewAPIError(int(code), codeName, " - ", message)
 	logrus.Errorf("device ERROR: %s - %s ", codeName, message)
 }
 
@@ -103,6 +279,8 @@ func (d *deviceSocket) onHello(msg *map[string]interface{}) {
 
 	logrus.Infof("connection established, online as '%s'", devID)
 	d.IsOnline = true
+	d.wasOnline = true
+	d.metrics.setOnline(true)
 
 	// update config if changed
 	var cfg = config.MustLoad()
@@ -123,8 +301,7 @@ func (d *deviceSocket) onHello(msg *map[string]interface{}) {
 		cfg.Write()
 	}
 
-	// TODO announce configured services
-	d.announce("ssh", "ssh")
+	d.announceServices()
 }
 
 func (d *deviceSocket) onMessage(_type int, data []byte) {
@@ -170,6 +347,11 @@ func (d *deviceSocket) onPing(msg pingMsg) {
 	resp["_type"] = "pong"
 	resp["ts"] = msg.Ts
 	d.SendJSON(resp)
+
+	// measure the round trip time (see metrics)
+	if err := d.SendPing(); err != nil {
+		logrus.WithError(err).Debug("failed to send websocket ping")
+	}
 }
 
 func (d *deviceSocket) onTimeout() {
@@ -0,0 +1,164 @@
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ondevice/ondevice/tunnel"
+)
+
+// metrics -- the daemon's counters (see Daemon.WriteMetrics())
+type metrics struct {
+	lock sync.Mutex
+
+	reconnects  int64
+	onlineSince time.Time     // zero if we're offline
+	onlineTotal time.Duration // time spent online (not including the current connection)
+	pingRTT     time.Duration // the last ping round trip time we've measured
+
+	tunnels      map[string]int64 // total tunnels by service
+	tunnelErrors map[int]int64    // tunnel errors by code
+	bytesRead    map[string]int64 // bytes received by closed tunnels (by service)
+	bytesWritten map[string]int64 // bytes sent by closed tunnels (by service)
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		tunnels:      make(map[string]int64),
+		tunnelErrors: make(map[int]int64),
+		bytesRead:    make(map[string]int64),
+		bytesWritten: make(map[string]int64),
+	}
+}
+
+func (m *metrics) onReconnect() {
+	m.lock.Lock()
+	m.reconnects++
+	m.lock.Unlock()
+}
+
+func (m *metrics) setOnline(online bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if online && m.onlineSince.IsZero() {
+		m.onlineSince = time.Now()
+	} else if !online && !m.onlineSince.IsZero() {
+		m.onlineTotal += time.Since(m.onlineSince)
+		m.onlineSince = time.Time{}
+	}
+}
+
+func (m *metrics) onPong(rtt time.Duration) {
+	m.lock.Lock()
+	m.pingRTT = rtt
+	m.lock.Unlock()
+}
+
+func (m *metrics) onTunnelOpened(service string) {
+	m.lock.Lock()
+	m.tunnels[service]++
+	m.lock.Unlock()
+}
+
+func (m *metrics) onTunnelClosed(service string, stats tunnel.Stats) {
+	m.lock.Lock()
+	m.bytesRead[service] += stats.BytesRead
+	m.bytesWritten[service] += stats.BytesWritten
+	m.lock.Unlock()
+}
+
+func (m *metrics) onTunnelError(code int) {
+	m.lock.Lock()
+	m.tunnelErrors[code]++
+	m.lock.Unlock()
+}
+
+// write -- writes the metrics in the Prometheus text format
+//
+// state and active are the daemon's current connection state and tunnels
+func (m *metrics) write(w io.Writer, state string, active []TunnelInfo) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var online = m.onlineTotal
+	if !m.onlineSince.IsZero() {
+		online += time.Since(m.onlineSince)
+	}
+
+	// add the active tunnels' stats to the ones of the closed tunnels
+	var activeTunnels = map[string]int64{}
+	var bytesRead, bytesWritten = _copyCounters(m.bytesRead), _copyCounters(m.bytesWritten)
+	for _, t := range active {
+		activeTunnels[t.Service]++
+		bytesRead[t.Service] += t.BytesRead
+		bytesWritten[t.Service] += t.BytesWritten
+	}
+
+	var states = map[string]int64{}
+	for _, s := range []string{StateOffline, StateConnecting, StateOnline, StateBackoff} {
+		states[s] = 0
+	}
+	states[state] = 1
+
+	var errors = map[string]int64{}
+	for code, count := range m.tunnelErrors {
+		errors[strconv.Itoa(code)] = count
+	}
+
+	_writeMetric(w, "ondevice_connection_state", "gauge", "the daemon's connection state (1 for the current one)", "state", states)
+	_writeMetric(w, "ondevice_reconnects_total", "counter", "number of times the daemon has (re)connected to the API server", "", map[string]int64{"": m.reconnects})
+	_writeFloatMetric(w, "ondevice_online_seconds_total", "counter", "time the device has been online", online.Seconds())
+	if m.pingRTT > 0 {
+		_writeFloatMetric(w, "ondevice_ping_rtt_seconds", "gauge", "round trip time of the last ping to the API server", m.pingRTT.Seconds())
+	}
+	_writeMetric(w, "ondevice_tunnels_active", "gauge", "number of open tunnels", "service", activeTunnels)
+	_writeMetric(w, "ondevice_tunnels_total", "counter", "number of tunnels opened since the daemon was started", "service", m.tunnels)
+	_writeMetric(w, "ondevice_tunnel_read_bytes_total", "counter", "bytes received over tunnels", "service", bytesRead)
+	_writeMetric(w, "ondevice_tunnel_written_bytes_total", "counter", "bytes sent over tunnels", "service", bytesWritten)
+	_writeMetric(w, "ondevice_tunnel_errors_total", "counter", "tunnel errors (by error code)", "code", errors)
+}
+
+func _copyCounters(m map[string]int64) map[string]int64 {
+	var rc = make(map[string]int64, len(m))
+	for k, v := range m {
+		rc[k] = v
+	}
+	return rc
+}
+
+// _writeMetric -- writes a metric with one sample per label value (sorted, if label is empty there's only one sample)
+func _writeMetric(w io.Writer, name string, metricType string, help string, label string, values map[string]int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+
+	var keys = make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if label == "" {
+			fmt.Fprintf(w, "%s %d\n", name, values[k])
+		} else {
+			fmt.Fprintf(w, "%s{%s=\"%s\"} %d\n", name, label, _escapeLabelValue(k), values[k])
+		}
+	}
+}
+
+// _escapeLabelValue -- escapes backslashes, double quotes and newlines (the only escapes the Prometheus text format knows)
+func _escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func _writeFloatMetric(w io.Writer, name string, metricType string, help string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	fmt.Fprintf(w, "%s %s\n", name, strconv.FormatFloat(value, 'g', -1, 64))
+}
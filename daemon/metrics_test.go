@@ -0,0 +1,42 @@
+package daemon
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/ondevice/ondevice/tunnel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	var m = newMetrics()
+	m.onReconnect()
+	m.onPong(25 * time.Millisecond)
+	m.onTunnelOpened("ssh")
+	m.onTunnelOpened("ssh")
+	m.onTunnelClosed("ssh", tunnel.Stats{BytesRead: 100, BytesWritten: 200})
+	m.onTunnelError(404)
+
+	var buff bytes.Buffer
+	m.write(&buff, StateOnline, []TunnelInfo{{ID: "abc", Service: "ssh", BytesRead: 10, BytesWritten: 20}})
+	var out = buff.String()
+
+	assert.Contains(t, out, "# TYPE ondevice_reconnects_total counter\nondevice_reconnects_total 1\n")
+	assert.Contains(t, out, `ondevice_connection_state{state="online"} 1`)
+	assert.Contains(t, out, `ondevice_connection_state{state="backoff"} 0`)
+	assert.Contains(t, out, "ondevice_ping_rtt_seconds 0.025\n")
+	assert.Contains(t, out, `ondevice_tunnels_active{service="ssh"} 1`)
+	assert.Contains(t, out, `ondevice_tunnels_total{service="ssh"} 2`)
+	assert.Contains(t, out, `ondevice_tunnel_read_bytes_total{service="ssh"} 110`)
+	assert.Contains(t, out, `ondevice_tunnel_written_bytes_total{service="ssh"} 220`)
+	assert.Contains(t, out, `ondevice_tunnel_errors_total{code="404"} 1`)
+}
+
+func TestMetricsLabelEscaping(t *testing.T) {
+	var buff bytes.Buffer
+	_writeMetric(&buff, "test", "counter", "help", "service", map[string]int64{
+		"a\\b\"c\nd\té": 1,
+	})
+	assert.Contains(t, buff.String(), `test{service="a\\b\"c\nd`+"\té\"} 1\n")
+}
@@ -0,0 +1,101 @@
+package daemon
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ondevice/ondevice/tunnel"
+)
+
+// TunnelInfo -- describes one of the daemon's active tunnels (see Daemon.ListTunnels())
+type TunnelInfo struct {
+	ID         string `json:"id"`
+	Service    string `json:"service"`
+	Protocol   string `json:"protocol"`
+	ClientUser string `json:"clientUser,omitempty"`
+	ClientIP   string `json:"clientIp,omitempty"`
+
+	StartTs      time.Time `json:"startTs"`
+	BytesRead    int64     `json:"bytesRead"`
+	BytesWritten int64     `json:"bytesWritten"`
+}
+
+// tunnelRegistry -- keeps track of the daemon's active tunnels
+type tunnelRegistry struct {
+	lock    sync.Mutex
+	tunnels map[string]*activeTunnel
+	wg      sync.WaitGroup
+}
+
+// tunnelHandle -- what the registry needs to know about a tunnel (implemented by tunnel.Tunnel and tunnel.Stream)
+type tunnelHandle interface {
+	CloseWithError(code int, msg string)
+	Stats() tunnel.Stats
+}
+
+type activeTunnel struct {
+	info   TunnelInfo
+	tunnel tunnelHandle
+}
+
+// add -- registers a new tunnel or mux stream (call remove() once it's been closed)
+func (r *tunnelRegistry) add(t tunnelHandle, info TunnelInfo) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.tunnels == nil {
+		r.tunnels = make(map[string]*activeTunnel)
+	}
+	r.tunnels[info.ID] = &activeTunnel{info: info, tunnel: t}
+	r.wg.Add(1)
+}
+
+// list -- returns info on all the active tunnels (oldest first)
+func (r *tunnelRegistry) list() []TunnelInfo {
+	r.lock.Lock()
+	var rc = make([]TunnelInfo, 0, len(r.tunnels))
+	for _, t := range r.tunnels {
+		var info = t.info
+		var stats = t.tunnel.Stats()
+		if !stats.StartTs.IsZero() {
+			info.StartTs = stats.StartTs
+		}
+		info.BytesRead = stats.BytesRead
+		info.BytesWritten = stats.BytesWritten
+		rc = append(rc, info)
+	}
+	r.lock.Unlock()
+
+	sort.Slice(rc, func(i, j int) bool {
+		return rc[i].StartTs.Before(rc[j].StartTs)
+	})
+	return rc
+}
+
+// get -- returns the given active tunnel (or nil if not found)
+func (r *tunnelRegistry) get(tunnelID string) tunnelHandle {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if t, ok := r.tunnels[tunnelID]; ok {
+		return t.tunnel
+	}
+	return nil
+}
+
+// remove -- unregisters the given tunnel
+func (r *tunnelRegistry) remove(tunnelID string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if _, ok := r.tunnels[tunnelID]; ok {
+		delete(r.tunnels, tunnelID)
+		r.wg.Done()
+	}
+}
+
+// wait -- waits for all the active tunnels to close
+func (r *tunnelRegistry) wait() {
+	r.wg.Wait()
+}
@@ -0,0 +1,138 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var numberRe = regexp.MustCompile(`^[-+]?(\d+\.?\d*|\.\d+)([eE][-+]?\d+)?$`)
+
+// versionRe -- semantic versions, e.g. 1.2.3, v2.0, 1.0.0-rc.1+build5 or 'ondevice v0.5.1'
+// (groups: 'v' prefix, numbers, prerelease, product name)
+var versionRe = regexp.MustCompile(`^(?:([A-Za-z][\w\-]*) )?(v?)(\d+(?:\.\d+)*)(?:-([0-9A-Za-z.\-]+))?(?:\+[0-9A-Za-z.\-]+)?$`)
+
+// durationRe -- a single component of a duration (Go's time.ParseDuration() units, plus 'd' and 'w')
+var durationRe = regexp.MustCompile(`(\d+(?:\.\d+)?)(ns|us|µs|ms|s|m|h|d|w)`)
+
+// compareValues -- returns -1, 0 or 1 if a is less than, equal to or greater than b
+//
+// Values are compared numerically if both of them are numbers, as semantic versions if both of
+// them are versions (and at least one of them has two dots, a 'v' prefix or a prerelease suffix,
+// so '2.3' and '2.10' are still compared as numbers) and as strings otherwise.
+// Versions may be prefixed with a product name (like on:version's 'ondevice v0.5.1'), which
+// has to match if both of them have one.
+func compareValues(a string, b string) int {
+	if numberRe.MatchString(a) && numberRe.MatchString(b) {
+		var x, _ = strconv.ParseFloat(a, 64)
+		var y, _ = strconv.ParseFloat(b, 64)
+		return _compareFloat(x, y)
+	}
+
+	if va, vb := versionRe.FindStringSubmatch(a), versionRe.FindStringSubmatch(b); va != nil && vb != nil && (_isVersion(va) || _isVersion(vb)) && (va[1] == "" || vb[1] == "" || va[1] == vb[1]) {
+		return _compareVersions(va, vb)
+	}
+
+	return strings.Compare(a, b)
+}
+
+// _isVersion -- returns true if the versionRe match can't be mistaken for a number
+func _isVersion(groups []string) bool {
+	return groups[2] != "" || strings.Count(groups[3], ".") >= 2 || groups[4] != ""
+}
+
+// _compareVersions -- compares two versionRe matches (following the semver precedence rules, build metadata is ignored)
+func _compareVersions(a []string, b []string) int {
+	var x, y = strings.Split(a[3], "."), strings.Split(b[3], ".")
+	for i := 0; i < len(x) || i < len(y); i++ {
+		var m, n int
+		if i < len(x) {
+			m, _ = strconv.Atoi(x[i])
+		}
+		if i < len(y) {
+			n, _ = strconv.Atoi(y[i])
+		}
+		if m != n {
+			return _compareInt(m, n)
+		}
+	}
+
+	// prereleases come before the release itself
+	var preA, preB = a[4], b[4]
+	if preA == "" || preB == "" {
+		return -_compareInt(len(preA), len(preB))
+	}
+
+	var partsA, partsB = strings.Split(preA, "."), strings.Split(preB, ".")
+	for i := 0; i < len(partsA) && i < len(partsB); i++ {
+		var m, errA = strconv.Atoi(partsA[i])
+		var n, errB = strconv.Atoi(partsB[i])
+		if errA == nil && errB == nil {
+			if m != n {
+				return _compareInt(m, n)
+			}
+		} else if errA == nil {
+			return -1 // numeric identifiers come first
+		} else if errB == nil {
+			return 1
+		} else if rc := strings.Compare(partsA[i], partsB[i]); rc != 0 {
+			return rc
+		}
+	}
+	return _compareInt(len(partsA), len(partsB))
+}
+
+// parseDuration -- like time.ParseDuration(), but also supports days ('d') and weeks ('w'), e.g. '2h', '1d12h' or '2w'
+func parseDuration(value string) (time.Duration, error) {
+	var matches = durationRe.FindAllStringSubmatchIndex(value, -1)
+	var rc time.Duration
+	var pos = 0
+	for _, m := range matches {
+		if m[0] != pos {
+			break
+		}
+		pos = m[1]
+
+		var count, _ = strconv.ParseFloat(value[m[2]:m[3]], 64)
+		var unit time.Duration
+		switch value[m[4]:m[5]] {
+		case "ns":
+			unit = time.Nanosecond
+		case "us", "µs":
+			unit = time.Microsecond
+		case "ms":
+			unit = time.Millisecond
+		case "s":
+			unit = time.Second
+		case "m":
+			unit = time.Minute
+		case "h":
+			unit = time.Hour
+		case "d":
+			unit = 24 * time.Hour
+		case "w":
+			unit = 7 * 24 * time.Hour
+		}
+		rc += time.Duration(count * float64(unit))
+	}
+
+	if len(matches) == 0 || pos != len(value) {
+		return 0, fmt.Errorf("malformed duration (expected something like '30m', '2h' or '7d'): '%s'", value)
+	}
+	return rc, nil
+}
+
+func _compareFloat(a float64, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+func _compareInt(a int, b int) int {
+	return _compareFloat(float64(a), float64(b))
+}
@@ -0,0 +1,242 @@
+package filter
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/ondevice/ondevice/api"
+	"github.com/ondevice/ondevice/util"
+)
+
+// Expr -- a parsed filter expression (see Parse())
+type Expr interface {
+	// Match -- returns true if the device matches the expression
+	Match(dev api.Device) (bool, error)
+}
+
+// now -- returns the current time (replaced by tests)
+var now = time.Now
+
+type trueExpr struct{}
+
+func (trueExpr) Match(dev api.Device) (bool, error) { return true, nil }
+
+type andExpr struct{ left, right Expr }
+
+func (e andExpr) Match(dev api.Device) (bool, error) {
+	if ok, err := e.left.Match(dev); err != nil || !ok {
+		return false, err
+	}
+	return e.right.Match(dev)
+}
+
+type orExpr struct{ left, right Expr }
+
+func (e orExpr) Match(dev api.Device) (bool, error) {
+	if ok, err := e.left.Match(dev); err != nil || ok {
+		return ok, err
+	}
+	return e.right.Match(dev)
+}
+
+type notExpr struct{ inner Expr }
+
+func (e notExpr) Match(dev api.Device) (bool, error) {
+	var ok, err = e.inner.Match(dev)
+	return !ok && err == nil, err
+}
+
+// existsExpr -- true if the property is set (and not empty)
+type existsExpr struct{ key string }
+
+func (e existsExpr) Match(dev api.Device) (bool, error) {
+	var value, ok = getProperty(dev, e.key)
+	if list, isList := value.([]interface{}); isList {
+		return len(list) > 0, nil
+	}
+	return ok && value != nil && value != "", nil
+}
+
+// devicesExpr -- matches a static list of (qualified or unqualified) devIDs (i.e. groups without filter)
+type devicesExpr map[string]bool
+
+func (e devicesExpr) Match(dev api.Device) (bool, error) {
+	return e[dev.ID] || e[dev.UnqualifiedID()], nil
+}
+
+// compareExpr -- '<key><op><value>'
+type compareExpr struct {
+	key, op, value string
+	re             *regexp.Regexp // for '=~' and '!~'
+}
+
+func newCompareExpr(key string, op string, value string) (Expr, error) {
+	var rc = compareExpr{key: key, op: op, value: value}
+	if op == "=~" || op == "!~" {
+		var err error
+		if rc.re, err = regexp.Compile(value); err != nil {
+			return nil, fmt.Errorf("Malformed regular expression: '%s' (%s)", value, err.Error())
+		}
+	}
+	return rc, nil
+}
+
+func (e compareExpr) Match(dev api.Device) (bool, error) {
+	var values, err = getStringValues(dev, e.key)
+	if err != nil {
+		return false, err
+	}
+
+	// lists match if any of their values does ('!=' and '!~' if none of them does)
+	var op, negate = e.op, false
+	switch op {
+	case "!=":
+		op, negate = "=", true
+	case "!~":
+		op, negate = "=~", true
+	}
+
+	for _, value := range values {
+		var ok bool
+		if op == "=~" {
+			ok = e.re.MatchString(value)
+		} else {
+			ok = _checkResult(op, compareValues(value, e.value))
+		}
+		if ok {
+			return !negate, nil
+		}
+	}
+	return negate, nil
+}
+
+// inExpr -- '<key> in (<values>...)' (for lists: true if any of their values is in the given ones)
+type inExpr struct {
+	key    string
+	values []string
+}
+
+func (e inExpr) Match(dev api.Device) (bool, error) {
+	var values, err = getStringValues(dev, e.key)
+	if err != nil {
+		return false, err
+	}
+	for _, value := range values {
+		for _, v := range e.values {
+			if compareValues(value, v) == 0 {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// ageExpr -- 'age(<key>)<op><duration>', compares the time since a timestamp property with the given duration
+//
+// the property can be an RFC 3339 timestamp, a date (YYYY-MM-DD) or a number (milliseconds since the epoch).
+// Devices where it's missing (or malformed) don't match
+type ageExpr struct {
+	key      string
+	op       string
+	duration time.Duration
+}
+
+func (e ageExpr) Match(dev api.Device) (bool, error) {
+	var value, _ = getProperty(dev, e.key)
+
+	var ts time.Time
+	switch v := value.(type) {
+	case float64:
+		ts = util.MsecToTs(int64(v))
+	case string:
+		var err error
+		if ts, err = time.Parse(time.RFC3339, v); err != nil {
+			if ts, err = time.Parse("2006-01-02", v); err != nil {
+				return false, nil
+			}
+		}
+	default:
+		return false, nil
+	}
+
+	var age = now().Sub(ts)
+	return _checkResult(e.op, _compareFloat(float64(age), float64(e.duration))), nil
+}
+
+// _checkResult -- returns true if the result of compareValues() satisfies the operator
+func _checkResult(op string, cmp int) bool {
+	switch op {
+	case "=", "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<", "<<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">", ">>":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	}
+	return false
+}
+
+// getStringValues -- returns the property's value(s) as strings
+//
+// Lists return each of their values, objects (and nested lists) are JSON encoded.
+// Missing values, nil and empty lists are treated as the empty string
+func getStringValues(dev api.Device, key string) ([]string, error) {
+	var value, _ = getProperty(dev, key)
+
+	// For now we'll simply treat nil/nonexisting as the empty string, e.g.:
+	// - nil == ""
+	// - nil < "hello"
+	// - nil != "world"
+	// TODO think about nil values
+	if list, ok := value.([]interface{}); ok {
+		if len(list) == 0 {
+			return []string{""}, nil
+		}
+
+		var rc = make([]string, 0, len(list))
+		for _, item := range list {
+			var s, err = _toString(key, item)
+			if err != nil {
+				return nil, err
+			}
+			rc = append(rc, s)
+		}
+		return rc, nil
+	}
+
+	var s, err = _toString(key, value)
+	if err != nil {
+		return nil, err
+	}
+	return []string{s}, nil
+}
+
+// _toString -- returns the string representation of a (JSON) property value
+func _toString(key string, value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	}
+
+	var data, err = json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("Unsupported property type: key=%s, type=%s (%s)", key, reflect.TypeOf(value), err.Error())
+	}
+	return string(data), nil
+}
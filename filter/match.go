@@ -1,10 +1,6 @@
 package filter
 
 import (
-	"fmt"
-	"reflect"
-	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
@@ -13,54 +9,47 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// operator examples
-// "--with="
-
-// list of supported operators and their implementations
-var matchOperators = map[string]func(string, string) bool{
-	"==": operatorEQ,
-	"=":  operatorEQ,
-	"!=": operatorNE,
-	"<=": operatorLE,
-	"<":  operatorLT,
-	"<<": operatorLT,
-	">=": operatorGE,
-	">":  operatorGT,
-	">>": operatorGT,
-}
-
-// results in 3 groups:
-// - property name
-// - operator (optional)
-// - value (optional)
-var re = regexp.MustCompile("^([a-zA-Z0-9_.\\-:]+)(?:([=!<>]{1,2})(.*))?$")
-
 // Matches -- Returns true if the given expression is true for the device (and its properties)
 //
-// expr has one of the following formats:
+// see Parse() for the expression syntax, e.g.:
 // - <propertyName>
 // - <propertyName><operator><value>
+// - (location=berlin or location=vienna) and fooVersion<2.3.4
 func Matches(dev api.Device, expr string) (bool, error) {
-	var groups = re.FindStringSubmatch(expr)
-	var key string
-	var op func(string, string) bool
-	var expectedValue string
+	var e, err = Parse(expr)
+	if err != nil {
+		return false, err
+	}
+	return e.Match(dev)
+}
 
-	if len(groups) == 0 {
-		return false, fmt.Errorf("Malformed expression: '%s'", expr)
+// MatchesAll -- Returns true if all of the given expressions are true for the device (see Matches())
+//
+// Use ParseAll() instead when matching more than one device (to parse the expressions only once)
+func MatchesAll(dev api.Device, exprs []string) (bool, error) {
+	var e, err = ParseAll(exprs)
+	if err != nil {
+		return false, err
 	}
-	if groups[2] != "" {
-		var ok bool
-		if op, ok = matchOperators[groups[2]]; !ok {
-			return false, fmt.Errorf("Unsupported match operator: '%s'", groups[2])
-		}
-		key = groups[1]
-		expectedValue = groups[3]
-	} else {
-		key = groups[1]
+	return e.Match(dev)
+}
+
+// MustMatch -- Wrapper around Matches() panicking on error
+func MustMatch(dev api.Device, expr string) bool {
+	var rc, err = Matches(dev, expr)
+	if err != nil {
+		logrus.WithError(err).Fatalf("error matching device properties (expr: '%s')", expr)
 	}
+	return rc
+}
 
+// getProperty -- returns the given device property (or one of the special 'on:' properties)
+func getProperty(dev api.Device, key string) (interface{}, bool) {
 	var value, ok = dev.Props[key]
+	if !ok && strings.Contains(key, ".") {
+		// object properties, e.g. 'config.mode' for {"config": {"mode": "..."}}
+		value, ok = _getNestedProperty(dev.Props, key)
+	}
 
 	// handle special properties ('!ok' allows the server to override them explicitly)
 	if !ok && strings.HasPrefix(key, "on:") {
@@ -91,64 +80,26 @@ func Matches(dev api.Device, expr string) (bool, error) {
 		}
 	}
 
-	if op == nil {
-		// "exists"-query
-		return ok && value != nil && value != "", nil
-	}
-
-	// For now we'll simply treat nil/nonexisting as the empty string, e.g.:
-	// - nil == ""
-	// - nil < "hello"
-	// - nil != "world"
-	// TODO think about nil values
-	if value == nil {
-		value = ""
-	}
-
-	// convert non-string values to string (to make sure we won't choke on them)
-	var strVal string
-	if strVal, ok = value.(string); ok {
-	} else if val, ok := value.(bool); ok {
-		strVal = strconv.FormatBool(val)
-	} else if val, ok := value.(float64); ok {
-		strVal = strconv.FormatFloat(val, 'f', -1, 64)
-	} else {
-		// TODO add support for extra types
-		return false, fmt.Errorf("Unsupported property type: key=%s, type=%s)", key, reflect.TypeOf(value))
-	}
-
-	return op(strVal, expectedValue), nil
-}
-
-// MustMatch -- Wrapper around Matches() panicking on error
-func MustMatch(dev api.Device, expr string) bool {
-	var rc, err = Matches(dev, expr)
-	if err != nil {
-		logrus.WithError(err).Fatalf("error matching device properties (expr: '%s')", expr)
-	}
-	return rc
-}
-
-func operatorEQ(a string, b string) bool {
-	return a == b
-}
-
-func operatorGE(a string, b string) bool {
-	return a >= b
-}
-
-func operatorGT(a string, b string) bool {
-	return a > b
-}
-
-func operatorLE(a string, b string) bool {
-	return a <= b
+	return value, ok
 }
 
-func operatorLT(a string, b string) bool {
-	return a < b
-}
+// _getNestedProperty -- resolves dot-separated paths into object properties (keys containing dots take precedence)
+func _getNestedProperty(obj map[string]interface{}, path string) (interface{}, bool) {
+	for i := strings.Index(path, "."); i >= 0; {
+		if child, ok := obj[path[:i]].(map[string]interface{}); ok {
+			var rest = path[i+1:]
+			if value, ok := child[rest]; ok {
+				return value, true
+			} else if value, ok := _getNestedProperty(child, rest); ok {
+				return value, true
+			}
+		}
 
-func operatorNE(a string, b string) bool {
-	return a != b
+		var next = strings.Index(path[i+1:], ".")
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return nil, false
 }
@@ -9,8 +9,6 @@ import (
 )
 
 func TestMatches(t *testing.T) {
-	// TODO test path traversal (foo.bar==bak)
-	// TODO test non-string values
 	var dev = api.Device{
 		Props: map[string]interface{}{
 			"hello":     "world",
@@ -49,17 +47,17 @@ func TestMatches(t *testing.T) {
 	assert.False(t, MustMatch(dev, "answer!=42"))
 	assert.True(t, MustMatch(dev, "hello==world"))
 
-	// comparison operators (we're doing string comparison)
+	// comparison operators (numbers are compared numerically, everything else as strings)
 	assert.False(t, MustMatch(dev, "answer<<42"))
 	assert.True(t, MustMatch(dev, "answer<=42"))
 	assert.True(t, MustMatch(dev, "answer<43"))
 	assert.True(t, MustMatch(dev, "answer<<43"))
-	assert.True(t, MustMatch(dev, "answer<5"))
-	assert.False(t, MustMatch(dev, "answer< 43")) // is compared to " 43" (with starting space char)
+	assert.False(t, MustMatch(dev, "answer<5"))
+	assert.True(t, MustMatch(dev, "answer< 43"))  // whitespace between tokens is ignored
 	assert.True(t, MustMatch(dev, "hello>World")) // values are compared case sensitively
 
-	assert.True(t, MustMatch(dev, "answer>>345"))
-	assert.True(t, MustMatch(dev, "answer>=345"))
+	assert.False(t, MustMatch(dev, "answer>>345"))
+	assert.False(t, MustMatch(dev, "answer>=345"))
 	assert.True(t, MustMatch(dev, "answer>41"))
 	assert.False(t, MustMatch(dev, "answer>42"))
 	assert.False(t, MustMatch(dev, "answer>43"))
@@ -110,7 +108,7 @@ func TestSpecial(t *testing.T) {
 	// on:createdAt:
 	assert.True(t, MustMatch(dev, "on:createdAt=2018-01-15T16:55:31Z"))
 	assert.True(t, MustMatch(dev, "on:createdAt>=2018")) // created this year
-	assert.True(t, MustMatch(dev, "on:createdAt>2018"))  // we're still doing simple string comparison
+	assert.True(t, MustMatch(dev, "on:createdAt>2018"))  // timestamps are compared as strings
 
 	// on:stateTs
 	assert.True(t, MustMatch(dev, "on:stateTs=2018-02-05T17:37:05Z"))
@@ -127,6 +125,8 @@ func TestSpecial(t *testing.T) {
 	// other special properties
 	assert.True(t, MustMatch(dev, "on:name!="))
 	assert.True(t, MustMatch(dev, "on:version>=0.1"))
+	assert.True(t, MustMatch(dev, "on:version<0.1.10"))
+	assert.True(t, MustMatch(dev, "on:version=ondevice v0.1.2"))
 	assert.True(t, MustMatch(dev, "on:foo=server-defined special property"))
 
 	// unknown special property
@@ -154,32 +154,77 @@ func TestTypes(t *testing.T) {
 	assert.True(t, MustMatch(dev, "null="))
 	assert.False(t, MustMatch(dev, "null"))
 	assert.True(t, MustMatch(dev, "smallInt=123"))
-	assert.True(t, MustMatch(dev, "smallInt<23")) // string comparison
+	assert.False(t, MustMatch(dev, "smallInt<23")) // numeric comparison
 	assert.True(t, MustMatch(dev, "bigInt=119879128371981"))
-	assert.True(t, MustMatch(dev, "bigInt<2"))
+	assert.True(t, MustMatch(dev, "bigInt>2"))
 	assert.True(t, MustMatch(dev, "float1=192"))
 	assert.True(t, MustMatch(dev, "float2=192.1"))
 
-	// we can't handle arrays though
+	// lists match if any of their values does
 	assert.True(t, MustMatch(dev, "intArray")) // simple 'exists' expression should work
+	assert.True(t, MustMatch(dev, "intArray=3"))
+	assert.False(t, MustMatch(dev, "intArray=4"))
+	assert.True(t, MustMatch(dev, "intArray!=4"))
+	assert.False(t, MustMatch(dev, "intArray!=2"))
+	assert.True(t, MustMatch(dev, "intArray>2"))
+	assert.True(t, MustMatch(dev, "intArray in (4, 2)"))
+	assert.False(t, MustMatch(dev, "intArray="))
+	assert.True(t, MustMatch(dev, "intArray!="))
+
+	// dicts are compared as JSON (and their values can be accessed using dots)
+	assert.True(t, MustMatch(dev, "dict")) // simple 'exists' expression should work
+	assert.True(t, MustMatch(dev, `dict='{"answer":42}'`))
+	assert.False(t, MustMatch(dev, "dict="))
+	assert.True(t, MustMatch(dev, "dict.answer=42"))
+	assert.True(t, MustMatch(dev, "dict.answer>=40"))
+	assert.False(t, MustMatch(dev, "dict.question"))
+	assert.True(t, MustMatch(dev, "bool=true"))
+}
 
-	var _, err = Matches(dev, "intArray=123")
-	assert.Error(t, err)
-	_, err = Matches(dev, "intArray!=")
-	assert.Error(t, err)
-	_, err = Matches(dev, "intArray=")
-	assert.Error(t, err)
+func TestNestedValues(t *testing.T) {
+	var dev = api.Device{}
+	assert.NoError(t, json.Unmarshal([]byte(`
+		{
+			"tags": ["prod", "berlin"],
+			"empty": [],
+			"net.mode": "dhcp",
+			"net": {"ip": "10.0.0.1", "wifi": {"ssid": "lab"}, "mode": "static"},
+			"hw": {"disks": [{"size": 32}]}
+		}
+	`), &dev.Props))
 
-	// same goes for dicts
-	assert.True(t, MustMatch(dev, "dict")) // simple 'exists' expression should work
+	assert.True(t, MustMatch(dev, "tags=prod"))
+	assert.True(t, MustMatch(dev, "tags=~^ber"))
+	assert.False(t, MustMatch(dev, "tags!~^ber"))
+	assert.True(t, MustMatch(dev, "tags not in (dev, test)"))
+	assert.False(t, MustMatch(dev, "empty"))
+	assert.True(t, MustMatch(dev, "empty="))
 
-	_, err = Matches(dev, "dict=123")
-	assert.Error(t, err)
-	_, err = Matches(dev, "dict!=")
-	assert.Error(t, err)
-	_, err = Matches(dev, "dict=")
-	assert.Error(t, err)
+	assert.True(t, MustMatch(dev, "net.ip=10.0.0.1"))
+	assert.True(t, MustMatch(dev, "net.wifi.ssid=lab"))
+	assert.True(t, MustMatch(dev, "net.mode=dhcp")) // keys containing dots take precedence
+	assert.True(t, MustMatch(dev, `hw.disks='{"size":32}'`))
+	assert.False(t, MustMatch(dev, "net.ip.foo"))
+}
+
+func TestMatchesAll(t *testing.T) {
+	var dev = api.Device{
+		ID:    "demo.q5dkpm",
+		Props: map[string]interface{}{"location": "berlin", "fooVersion": "2.3.1"},
+	}
+
+	var ok, err = MatchesAll(dev, nil)
+	assert.NoError(t, err)
+	assert.True(t, ok, "no filters -> match")
 
-	// TODO: object traversal
-	//assert.True(t, MustMatch(dev, "dict.answer=42"))
+	ok, err = MatchesAll(dev, []string{"location=berlin", "fooVersion<2.3.4"})
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	ok, err = MatchesAll(dev, []string{"location=berlin", "fooVersion>2.3.4"})
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	_, err = MatchesAll(dev, []string{"location=berlin", "!!"})
+	assert.Error(t, err)
 }
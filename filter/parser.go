@@ -0,0 +1,416 @@
+package filter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ondevice/ondevice/config"
+)
+
+// Filter expression grammar:
+//
+//	expr    := and { ('or' | '||') and }
+//	and     := unary { ('and' | '&&') unary }
+//	unary   := ('not' | '!') unary | '(' expr ')' | '@' group | term
+//	term    := key [ op value ]                      -- key (existence check) or comparison
+//	         | key ['not'] 'in' '(' value { ',' value } ')'
+//	         | 'age' '(' key ')' op duration         -- time since a timestamp property
+//	op      := '=' | '==' | '!=' | '<' | '<<' | '<=' | '>' | '>>' | '>=' | '=~' | '!~'
+//
+// Values are either bare words or quoted ('...' or "...", use them for values containing
+// whitespace, parentheses, operator characters or keywords). Keywords are case insensitive.
+// '@name' matches the devices of the given group (see Groups).
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokWord
+	tokString
+	tokOp
+	tokLParen
+	tokRParen
+	tokComma
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	typ  tokenType
+	text string
+	pos  int
+}
+
+// keyRe -- valid property names
+var keyRe = regexp.MustCompile(`^[a-zA-Z0-9_.\-:]+$`)
+
+// legacyRe -- the original (single term) syntax: '<key>[<op><value>]' (where value is everything after op)
+//
+// results in 3 groups: property name, operator (optional), value (optional)
+var legacyRe = regexp.MustCompile("^([a-zA-Z0-9_.\\-:]+)(?:([=!<>]{1,2})(.*))?$")
+
+// compoundRe -- values using parentheses or logical operators won't fall back to the legacy syntax
+//
+// (a typo in a compound expression should fail instead of silently matching something else,
+// e.g. 'location!=berlin and (arch=x86' would otherwise compare location with "berlin and (arch=x86")
+var compoundRe = regexp.MustCompile(`(?i)[()]|&&|\|\||\b(and|or|not)\b`)
+
+// comparison operators
+var operators = map[string]bool{
+	"==": true, "=": true, "!=": true,
+	"<=": true, "<": true, "<<": true,
+	">=": true, ">": true, ">>": true,
+	"=~": true, "!~": true,
+}
+
+const opChars = "=!<>~"
+
+// wordDelimiters -- characters ending bare words (and values)
+const wordDelimiters = " \t\r\n(),'\"&|" + opChars
+
+// Groups -- looks up the device groups referenced as '@name' (implemented by config.GroupConfig)
+type Groups interface {
+	GetGroup(name string) (config.Group, bool)
+}
+
+// Parse -- parses a filter expression
+//
+// For backwards compatibility, expressions that can't be parsed but match the original
+// '<key><op><value>' syntax (e.g. 'name=My Device') are treated as a single comparison
+// (unless the value uses any of the new syntax, see compoundRe).
+// Without groups, expressions referencing '@name' fail to parse
+func Parse(expr string, groups ...Groups) (Expr, error) {
+	var p = parser{seen: map[string]bool{}}
+	if len(groups) > 0 {
+		p.groups = groups[0]
+	}
+	return p.parse(expr)
+}
+
+// ParseAll -- parses each of the expressions (combining them with 'and')
+//
+// Returns an expression matching every device if exprs is empty
+func ParseAll(exprs []string, groups ...Groups) (Expr, error) {
+	var p parser
+	if len(groups) > 0 {
+		p.groups = groups[0]
+	}
+	return p.parseAll(exprs)
+}
+
+// parseAll -- implements ParseAll() (and parses filter groups)
+func (p parser) parseAll(exprs []string) (Expr, error) {
+	var rc Expr = trueExpr{}
+	for i, e := range exprs {
+		var parsed, err = p.parse(e)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			rc = parsed
+		} else {
+			rc = andExpr{rc, parsed}
+		}
+	}
+	return rc, nil
+}
+
+// tokenize -- splits expr into tokens (the last one being tokEOF)
+func tokenize(expr string) ([]token, error) {
+	var rc []token
+	var i = 0
+	for i < len(expr) {
+		var c = expr[i]
+		var start = i
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+			continue
+		case c == '(':
+			rc = append(rc, token{tokLParen, "(", start})
+			i++
+		case c == ')':
+			rc = append(rc, token{tokRParen, ")", start})
+			i++
+		case c == ',':
+			rc = append(rc, token{tokComma, ",", start})
+			i++
+		case strings.HasPrefix(expr[i:], "&&"):
+			rc = append(rc, token{tokAnd, "&&", start})
+			i += 2
+		case strings.HasPrefix(expr[i:], "||"):
+			rc = append(rc, token{tokOr, "||", start})
+			i += 2
+		case c == '\'' || c == '"':
+			var value strings.Builder
+			for i++; i < len(expr) && expr[i] != c; i++ {
+				if expr[i] == '\\' && i+1 < len(expr) {
+					i++
+				}
+				value.WriteByte(expr[i])
+			}
+			if i >= len(expr) {
+				return nil, fmt.Errorf("Malformed expression: unterminated string: '%s'", expr)
+			}
+			i++
+			rc = append(rc, token{tokString, value.String(), start})
+		case strings.IndexByte(opChars, c) >= 0:
+			for i < len(expr) && strings.IndexByte(opChars, expr[i]) >= 0 {
+				i++
+			}
+			var op = expr[start:i]
+			if op == "!" {
+				rc = append(rc, token{tokNot, op, start})
+			} else if operators[op] {
+				rc = append(rc, token{tokOp, op, start})
+			} else {
+				return nil, fmt.Errorf("Unsupported match operator: '%s'", op)
+			}
+		default:
+			for i < len(expr) && strings.IndexByte(wordDelimiters, expr[i]) < 0 {
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("Malformed expression: unexpected '%c' in '%s'", c, expr)
+			}
+			rc = append(rc, _keywordToken(expr[start:i], start))
+		}
+	}
+
+	return append(rc, token{tokEOF, "end of expression", len(expr)}), nil
+}
+
+func _keywordToken(word string, pos int) token {
+	switch strings.ToLower(word) {
+	case "and":
+		return token{tokAnd, word, pos}
+	case "or":
+		return token{tokOr, word, pos}
+	case "not":
+		return token{tokNot, word, pos}
+	}
+	return token{tokWord, word, pos}
+}
+
+// parser -- recursive descent parser for filter expressions
+type parser struct {
+	expr   string
+	tokens []token
+	pos    int
+
+	groups Groups
+	seen   map[string]bool // the groups we're currently parsing (to detect cycles)
+}
+
+// parse -- parses expr (falling back to the legacy syntax, see Parse())
+func (p parser) parse(expr string) (Expr, error) {
+	var tokens, err = tokenize(expr)
+	if err == nil {
+		p.expr, p.tokens, p.pos = expr, tokens, 0
+
+		var rc Expr
+		if rc, err = p.parseOr(); err == nil {
+			if tok := p.peek(); tok.typ != tokEOF {
+				err = p.errorf(tok, "unexpected '%s'", tok.text)
+			} else {
+				return rc, nil
+			}
+		}
+	}
+
+	if groups := legacyRe.FindStringSubmatch(expr); groups != nil && (groups[2] == "" || operators[groups[2]]) && !compoundRe.MatchString(groups[3]) {
+		if groups[2] == "" {
+			return existsExpr{key: groups[1]}, nil
+		}
+		return newCompareExpr(groups[1], groups[2], groups[3])
+	}
+	return nil, err
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	var rc = p.tokens[p.pos]
+	if rc.typ != tokEOF {
+		p.pos++
+	}
+	return rc
+}
+
+func (p *parser) errorf(tok token, msg string, args ...interface{}) error {
+	return fmt.Errorf("Malformed expression: %s (at position %d of '%s')", fmt.Sprintf(msg, args...), tok.pos+1, p.expr)
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	var rc, err = p.parseAnd()
+	for err == nil && p.peek().typ == tokOr {
+		p.next()
+		var right Expr
+		if right, err = p.parseAnd(); err == nil {
+			rc = orExpr{rc, right}
+		}
+	}
+	return rc, err
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	var rc, err = p.parseUnary()
+	for err == nil && p.peek().typ == tokAnd {
+		p.next()
+		var right Expr
+		if right, err = p.parseUnary(); err == nil {
+			rc = andExpr{rc, right}
+		}
+	}
+	return rc, err
+}
+
+func (p *parser) parseUnary() (Expr, error) {
+	var tok = p.next()
+	switch tok.typ {
+	case tokNot:
+		var inner, err = p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{inner}, nil
+	case tokLParen:
+		var inner, err = p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.typ != tokRParen {
+			return nil, p.errorf(closing, "expected ')', got '%s'", closing.text)
+		}
+		return inner, nil
+	case tokWord:
+		if strings.HasPrefix(tok.text, "@") {
+			return p.parseGroup(tok)
+		} else if strings.ToLower(tok.text) == "age" && p.peek().typ == tokLParen {
+			return p.parseAge()
+		}
+		return p.parseTerm(tok)
+	}
+
+	return nil, p.errorf(tok, "unexpected '%s'", tok.text)
+}
+
+// parseTerm -- parses whatever follows the property name
+func (p *parser) parseTerm(key token) (Expr, error) {
+	if !keyRe.MatchString(key.text) {
+		return nil, p.errorf(key, "invalid property name '%s'", key.text)
+	}
+
+	var tok = p.peek()
+	switch {
+	case tok.typ == tokOp:
+		p.next()
+		return newCompareExpr(key.text, tok.text, p.parseValue())
+	case tok.typ == tokWord && strings.ToLower(tok.text) == "in":
+		p.next()
+		return p.parseIn(key.text, false)
+	case tok.typ == tokNot && p.tokens[p.pos+1].typ == tokWord && strings.ToLower(p.tokens[p.pos+1].text) == "in":
+		p.pos += 2
+		return p.parseIn(key.text, true)
+	}
+
+	return existsExpr{key: key.text}, nil
+}
+
+// parseValue -- returns the value following an operator (or "" if there's none, e.g. 'foo=' or 'foo= and bar')
+func (p *parser) parseValue() string {
+	if tok := p.peek(); tok.typ == tokWord || tok.typ == tokString {
+		p.next()
+		return tok.text
+	}
+	return ""
+}
+
+func (p *parser) parseIn(key string, negate bool) (Expr, error) {
+	if tok := p.next(); tok.typ != tokLParen {
+		return nil, p.errorf(tok, "expected '(' after 'in', got '%s'", tok.text)
+	}
+
+	var rc = inExpr{key: key}
+	for {
+		var tok = p.next()
+		if tok.typ != tokWord && tok.typ != tokString {
+			return nil, p.errorf(tok, "expected a value, got '%s'", tok.text)
+		}
+		rc.values = append(rc.values, tok.text)
+
+		if tok = p.next(); tok.typ == tokRParen {
+			break
+		} else if tok.typ != tokComma {
+			return nil, p.errorf(tok, "expected ',' or ')', got '%s'", tok.text)
+		}
+	}
+
+	if negate {
+		return notExpr{rc}, nil
+	}
+	return rc, nil
+}
+
+// parseAge -- parses 'age(<key>) <op> <duration>'
+func (p *parser) parseAge() (Expr, error) {
+	p.next() // '('
+	var key = p.next()
+	if key.typ != tokWord || !keyRe.MatchString(key.text) {
+		return nil, p.errorf(key, "expected a property name, got '%s'", key.text)
+	}
+	if tok := p.next(); tok.typ != tokRParen {
+		return nil, p.errorf(tok, "expected ')', got '%s'", tok.text)
+	}
+
+	var op = p.next()
+	if op.typ != tokOp || op.text == "=~" || op.text == "!~" {
+		return nil, p.errorf(op, "expected a comparison operator after 'age(%s)', got '%s'", key.text, op.text)
+	}
+	var value = p.peek()
+	var d, err = parseDuration(p.parseValue())
+	if err != nil {
+		return nil, p.errorf(value, "%s", err.Error())
+	}
+
+	return ageExpr{key: key.text, op: op.text, duration: d}, nil
+}
+
+// parseGroup -- resolves '@name' (parsing the group's filter expression or matching its list of devices)
+func (p *parser) parseGroup(tok token) (Expr, error) {
+	var name = tok.text[1:]
+	var group config.Group
+	var ok bool
+	if p.groups != nil {
+		group, ok = p.groups.GetGroup(name)
+	}
+	if !ok {
+		return nil, p.errorf(tok, "unknown device group '@%s'", name)
+	}
+
+	if len(group.Filters) == 0 {
+		var rc = devicesExpr{}
+		for _, devID := range group.Devices {
+			rc[devID] = true
+		}
+		return rc, nil
+	}
+
+	if p.seen[name] {
+		return nil, p.errorf(tok, "device group '@%s' references itself", name)
+	}
+	var seen = map[string]bool{name: true}
+	for k := range p.seen {
+		seen[k] = true
+	}
+
+	var rc, err = parser{groups: p.groups, seen: seen}.parseAll(group.Filters)
+	if err != nil {
+		return nil, fmt.Errorf("device group '@%s': %s", name, err.Error())
+	}
+	return rc, nil
+}
@@ -0,0 +1,180 @@
+package filter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ondevice/ondevice/api"
+	"github.com/ondevice/ondevice/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpressions(t *testing.T) {
+	var dev = api.Device{
+		ID:    "demo.q5dkpm",
+		Name:  "My Raspberry PI",
+		State: "online",
+		Props: map[string]interface{}{
+			"location":   "berlin",
+			"fooVersion": "2.3.10",
+			"cpus":       float64(4),
+			"tags":       "prod",
+		},
+	}
+
+	// and/or/not, parentheses
+	assert.True(t, MustMatch(dev, "location=berlin and cpus>2"))
+	assert.True(t, MustMatch(dev, "location=berlin && cpus>2"))
+	assert.False(t, MustMatch(dev, "location=vienna or cpus<2"))
+	assert.True(t, MustMatch(dev, "location=vienna || cpus>=4"))
+	assert.True(t, MustMatch(dev, "not location=vienna"))
+	assert.True(t, MustMatch(dev, "!missing"))
+	assert.True(t, MustMatch(dev, "(location=vienna or location=berlin) and on:state=online"))
+	assert.False(t, MustMatch(dev, "location=vienna or location=berlin and on:state=offline")) // 'and' binds tighter
+	assert.True(t, MustMatch(dev, "NOT (location = vienna) AND tags"))
+
+	// numbers and versions
+	assert.True(t, MustMatch(dev, "cpus>=4"))
+	assert.True(t, MustMatch(dev, "cpus=4.0"))
+	assert.True(t, MustMatch(dev, "fooVersion>2.3.9"))       // semver
+	assert.True(t, MustMatch(dev, "fooVersion<v2.10"))       // 'v' prefix -> version
+	assert.True(t, MustMatch(dev, "fooVersion>=2.3.10-rc1")) // prereleases come first
+	assert.True(t, MustMatch(dev, "fooVersion<3"))
+
+	// regular expressions
+	assert.True(t, MustMatch(dev, "on:name=~'^My .* PI$'"))
+	assert.True(t, MustMatch(dev, "on:id!~^test\\."))
+	assert.False(t, MustMatch(dev, "location=~^vie"))
+
+	// in (...)
+	assert.True(t, MustMatch(dev, "location in (vienna, berlin)"))
+	assert.False(t, MustMatch(dev, "location not in (vienna, berlin)"))
+	assert.True(t, MustMatch(dev, "cpus in (2, 4.0, 'eight')"))
+
+	// quoted values (and the legacy syntax)
+	assert.True(t, MustMatch(dev, "on:name='My Raspberry PI' and location=berlin"))
+	assert.True(t, MustMatch(dev, "on:name=My Raspberry PI"))
+	assert.True(t, MustMatch(dev, "missing= and location=berlin"))
+	assert.True(t, MustMatch(dev, `location="berlin"`))
+
+	// errors
+	// (malformed compound expressions mustn't fall back to the legacy syntax)
+	for _, expr := range []string{"", "(location=berlin", "(a and b))", "location in berlin", "location in (berlin",
+		"and or", "location or", "(on:name=~'(')", "'unterminated", "a & b", "(location=>berlin)",
+		"location=berlin) or x", "location!=berlin and (arch=x86", "location!=berlin and", "location=berlin or or x",
+		"location=berlin && (", "location=berlin || not", "location!=a AND NOT (b"} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestAge(t *testing.T) {
+	now = func() time.Time { return time.Date(2018, 2, 5, 20, 0, 0, 0, time.UTC) }
+	defer func() { now = time.Now }()
+
+	var stateTs int64 = 1517852225000 // 2018-02-05T17:37:05Z
+	var dev = api.Device{
+		State:     "offline",
+		StateTs:   &stateTs,
+		CreatedAt: 1516035331000, // 2018-01-15T16:55:31Z
+		Props: map[string]interface{}{
+			"lastBackup": "2018-02-01",
+			"lastSeen":   float64(1517860800000), // 2018-02-05T20:00:00Z
+		},
+	}
+
+	// "offline for more than 2 hours"
+	assert.True(t, MustMatch(dev, "on:state=offline and age(on:stateTs)>2h"))
+	assert.False(t, MustMatch(dev, "age(on:stateTs)>2h30m"))
+	assert.True(t, MustMatch(dev, "age(on:createdAt)>=3w"))
+	assert.True(t, MustMatch(dev, "age(lastBackup) > 4d"))
+	assert.True(t, MustMatch(dev, "age(lastSeen)<1m"))
+	assert.False(t, MustMatch(dev, "age(missing)<1m"))
+	assert.True(t, MustMatch(dev, "not age(missing)<1m"))
+
+	dev.StateTs = nil
+	assert.False(t, MustMatch(dev, "age(on:stateTs)>2h"))
+
+	for _, expr := range []string{"age(on:stateTs)>2x", "age(on:stateTs)=~2h", "age on:stateTs>2h", "age(on:stateTs)"} {
+		_, err := Parse(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+func TestCompareValues(t *testing.T) {
+	assert.Equal(t, -1, compareValues("99", "234"))
+	assert.Equal(t, 0, compareValues("1e3", "1000"))
+	assert.Equal(t, 1, compareValues("2.3", "2.10")) // two-component versions are treated like numbers
+	assert.Equal(t, -1, compareValues("v2.3", "v2.10"))
+	assert.Equal(t, -1, compareValues("1.0.0-alpha", "1.0.0-alpha.1"))
+	assert.Equal(t, -1, compareValues("1.0.0-alpha.1", "1.0.0-beta"))
+	assert.Equal(t, -1, compareValues("1.0.0-rc.1", "1.0.0"))
+	assert.Equal(t, 0, compareValues("1.2.3+build5", "1.2.3"))
+	assert.Equal(t, -1, compareValues("abc", "abd"))
+	assert.Equal(t, -1, compareValues("ondevice v0.5.1", "0.6"))
+	assert.Equal(t, 1, compareValues("ondevice v0.10.0", "ondevice v0.9.3"))
+	assert.Equal(t, 1, compareValues("ondevice v0.5.1", "foo v0.6.0")) // different products -> string comparison
+	assert.Equal(t, 1, compareValues("Device 3", "12"))
+
+	d, err := parseDuration("1d12h")
+	assert.NoError(t, err)
+	assert.Equal(t, 36*time.Hour, d)
+	_, err = parseDuration("12")
+	assert.Error(t, err)
+}
+
+// testGroups -- implements Groups
+type testGroups map[string]config.Group
+
+func (g testGroups) GetGroup(name string) (config.Group, bool) {
+	var rc, ok = g[name]
+	rc.Name = name
+	return rc, ok
+}
+
+func TestGroups(t *testing.T) {
+	var groups = testGroups{
+		"berlin":  {Filters: []string{"location=berlin"}},
+		"prod-eu": {Filters: []string{"(@berlin or location=vienna) and env=prod"}},
+		"db":      {Devices: []string{"db1", "demo.db2"}},
+		"loop1":   {Filters: []string{"@loop2 or a"}},
+		"loop2":   {Filters: []string{"@loop1"}},
+		"broken":  {Filters: []string{"(location=berlin"}},
+		// each filter's parsed on its own (so the legacy syntax still works)
+		"legacy": {Filters: []string{"name=My Device", "env=prod"}},
+	}
+	var dev = api.Device{
+		ID:    "demo.db1",
+		Props: map[string]interface{}{"location": "berlin", "env": "prod", "name": "My Device"},
+	}
+
+	var matches = func(expr string) bool {
+		var e, err = Parse(expr, groups)
+		if !assert.NoError(t, err, expr) {
+			return false
+		}
+		ok, err := e.Match(dev)
+		assert.NoError(t, err, expr)
+		return ok
+	}
+
+	assert.True(t, matches("@berlin"))
+	assert.True(t, matches("@prod-eu"))
+	assert.True(t, matches("@legacy"))
+	assert.True(t, matches("@db and not @prod-eu or @db"))
+	assert.False(t, matches("@prod-eu and not @db"))
+
+	dev.ID = "demo.db2"
+	assert.True(t, matches("@db"))
+	dev.ID = "other.db2"
+	assert.False(t, matches("@db"))
+
+	for _, expr := range []string{"@unknown", "@loop1", "@broken", "@"} {
+		_, err := Parse(expr, groups)
+		assert.Error(t, err, expr)
+	}
+
+	// without groups
+	_, err := Parse("@berlin")
+	assert.Error(t, err)
+}
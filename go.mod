@@ -12,8 +12,8 @@ require (
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/pflag v1.0.5 // indirect
 	github.com/stretchr/testify v1.5.1
-	golang.org/x/crypto v0.0.0-20200429183012-4b2356b1ed79 // indirect
-	golang.org/x/sys v0.0.0-20200509044756-6aff5f38e54f // indirect
+	golang.org/x/crypto v0.0.0-20200429183012-4b2356b1ed79
+	golang.org/x/sys v0.0.0-20200509044756-6aff5f38e54f
 	gopkg.in/ini.v1 v1.55.0
 	gopkg.in/yaml.v2 v2.2.8 // indirect
 )
@@ -0,0 +1,66 @@
+// Package ondevice -- Go client for the ondevice.io API
+//
+// Unlike the CLI's internal packages, everything in here is configured explicitly
+// (credentials, API server and http.Client), takes a context.Context and returns
+// errors instead of exiting the process. Example:
+//
+//	client, err := ondevice.NewClient(config.NewAuth("user", "apiKey"), "", nil)
+//	devices, err := client.ListDevices(ctx, "online", false)
+//	conn, err := client.Connect(ctx, "myDev", "ssh", "ssh")
+package ondevice
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ondevice/ondevice/api"
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/tunnel"
+)
+
+// Device -- state info for a specific device
+type Device = api.Device
+
+// Event -- an ondevice.io account event
+type Event = api.Event
+
+// EventListener -- filter options for Client.Events()
+type EventListener = api.EventListener
+
+// Error -- error response we got from the API server (use errors.As() to check for it)
+type Error = api.Error
+
+// ErrMissingAuth -- NewClient() has been called without credentials
+var ErrMissingAuth = api.ErrMissingAuth
+
+// Client -- ondevice.io API client (safe for concurrent use)
+//
+// Provides ListDevices(), ListProperties(), SetProperties(), RemoveProperties(),
+// DeleteDevice(), GetKeyInfo() and Events() (see api.Client) as well as Connect()
+type Client struct {
+	*api.Client
+}
+
+// NewClient -- creates a Client using the given credentials
+//
+// If apiServer isn't empty, it overrides the credentials' API server URL.
+// If httpClient is nil, http.DefaultClient will be used (tunnels don't use httpClient)
+func NewClient(auth config.Auth, apiServer string, httpClient *http.Client) (*Client, error) {
+	var c, err = api.NewClient(auth, apiServer, httpClient)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{Client: c}, nil
+}
+
+// Connect -- opens a tunnel to one of your device's services
+//
+// The returned net.Conn supports half-close (CloseWrite()) and deadlines.
+// ctx only affects connecting, use Close() to close the tunnel later on.
+func (c *Client) Connect(ctx context.Context, devID string, service string, protocol string) (*tunnel.Conn, error) {
+	var conn, err = tunnel.DialContext(ctx, devID, service, protocol, c.Auth())
+	if err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
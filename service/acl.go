@@ -0,0 +1,230 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/util"
+	"github.com/sirupsen/logrus"
+)
+
+// Client -- identifies the client requesting a tunnel (as reported by the API server)
+type Client struct {
+	User string
+	IP   string
+}
+
+// CheckAccess -- returns a 403 APIError if the service's ACL doesn't allow the client to connect right now
+//
+// svc should come from FindService() (and be the one that's passed on to GetProtocolHandler())
+func CheckAccess(svc config.Service, client Client) util.APIError {
+	if err := checkACL(svc.ACL, client, time.Now()); err != nil {
+		logrus.WithError(err).Warningf("denied access to service '%s' for %s@%s", svc.Name, client.User, client.IP)
+		return util.NewAPIError(util.ForbiddenError, "Access denied: ", err)
+	}
+	return nil
+}
+
+// ValidateACL -- returns an error if the ACL contains malformed IPs or time windows
+func ValidateACL(acl *config.ServiceACL) error {
+	if acl == nil {
+		return nil
+	}
+	for _, ip := range acl.IPs {
+		if _, err := parseIPRange(ip); err != nil {
+			return err
+		}
+	}
+	for _, t := range acl.Times {
+		if _, err := parseTimeWindow(t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkACL -- returns an error if the client doesn't match the ACL
+func checkACL(acl *config.ServiceACL, client Client, now time.Time) error {
+	if acl.IsEmpty() {
+		return nil
+	}
+
+	if len(acl.Users) > 0 && !_contains(acl.Users, client.User) {
+		return fmt.Errorf("user '%s' isn't allowed", client.User)
+	}
+
+	if len(acl.IPs) > 0 {
+		var ip = net.ParseIP(client.IP)
+		var allowed = false
+		for _, r := range acl.IPs {
+			if ipNet, err := parseIPRange(r); err != nil {
+				logrus.WithError(err).Error("ignoring malformed ACL entry")
+			} else if ip != nil && ipNet.Contains(ip) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("IP '%s' isn't allowed", client.IP)
+		}
+	}
+
+	if len(acl.Times) > 0 {
+		var allowed = false
+		for _, t := range acl.Times {
+			if w, err := parseTimeWindow(t); err != nil {
+				logrus.WithError(err).Error("ignoring malformed ACL entry")
+			} else if w.contains(now) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("not allowed at this time")
+		}
+	}
+
+	return nil
+}
+
+// parseIPRange -- parses CIDR ranges or single IP addresses
+func parseIPRange(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		var ip = net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("malformed IP address: '%s'", value)
+		}
+		var bits = 8 * len(ip)
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	var _, rc, err = net.ParseCIDR(value)
+	if err != nil {
+		return nil, fmt.Errorf("malformed CIDR range: '%s'", value)
+	}
+	return rc, nil
+}
+
+// timeWindow -- weekdays and time of day during which a service may be used
+//
+// format: '[days] [HH:MM-HH:MM]', e.g. 'Mon-Fri 08:00-18:00', 'Sat,Sun' or '22:00-06:00'
+// (windows ending before they start span midnight)
+type timeWindow struct {
+	days     [7]bool // indexed by time.Weekday
+	from, to int     // minutes since midnight
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+func parseTimeWindow(value string) (timeWindow, error) {
+	var rc = timeWindow{from: 0, to: 24 * 60}
+	var fields = strings.Fields(value)
+	if len(fields) == 0 || len(fields) > 2 {
+		return rc, fmt.Errorf("malformed time window: '%s'", value)
+	}
+
+	var days, hours = "", ""
+	if len(fields) == 2 {
+		days, hours = fields[0], fields[1]
+	} else if strings.Contains(fields[0], ":") {
+		hours = fields[0]
+	} else {
+		days = fields[0]
+	}
+
+	if days == "" {
+		for i := range rc.days {
+			rc.days[i] = true
+		}
+	} else {
+		for _, part := range strings.Split(days, ",") {
+			var bounds = strings.SplitN(part, "-", 2)
+			var first, err = _parseWeekday(bounds[0])
+			if err != nil {
+				return rc, err
+			}
+			var last = first
+			if len(bounds) == 2 {
+				if last, err = _parseWeekday(bounds[1]); err != nil {
+					return rc, err
+				}
+			}
+			for d := first; ; d = (d + 1) % 7 {
+				rc.days[d] = true
+				if d == last {
+					break
+				}
+			}
+		}
+	}
+
+	if hours != "" {
+		var bounds = strings.SplitN(hours, "-", 2)
+		if len(bounds) != 2 {
+			return rc, fmt.Errorf("malformed time range (expected HH:MM-HH:MM): '%s'", hours)
+		}
+		var err error
+		if rc.from, err = _parseTimeOfDay(bounds[0]); err != nil {
+			return rc, err
+		}
+		if rc.to, err = _parseTimeOfDay(bounds[1]); err != nil {
+			return rc, err
+		}
+	}
+
+	return rc, nil
+}
+
+// contains -- returns true if t is within the time window
+func (w timeWindow) contains(t time.Time) bool {
+	var day = t.Weekday()
+	var minute = t.Hour()*60 + t.Minute()
+
+	if w.from <= w.to {
+		return w.days[day] && minute >= w.from && minute < w.to
+	}
+
+	// spans midnight (the part after midnight belongs to the previous day)
+	var prevDay = (day + 6) % 7
+	return (w.days[day] && minute >= w.from) || (w.days[prevDay] && minute < w.to)
+}
+
+func _parseWeekday(value string) (time.Weekday, error) {
+	var lower = strings.ToLower(value)
+	for i, name := range weekdays {
+		// accept both 'Mon' and 'Monday'
+		if lower == name || lower == strings.ToLower(time.Weekday(i).String()) {
+			return time.Weekday(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown weekday: '%s'", value)
+}
+
+func _parseTimeOfDay(value string) (int, error) {
+	var parts = strings.SplitN(value, ":", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("malformed time (expected HH:MM): '%s'", value)
+	}
+	var hours, err1 = strconv.Atoi(parts[0])
+	var minutes, err2 = strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || hours < 0 || minutes < 0 || minutes > 59 || hours*60+minutes > 24*60 {
+		return 0, fmt.Errorf("malformed time (expected HH:MM): '%s'", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+func _contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
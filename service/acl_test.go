@@ -0,0 +1,84 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/util"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestACL(t *testing.T) {
+	// 2020-05-20 was a Wednesday
+	var now = time.Date(2020, 5, 20, 12, 0, 0, 0, time.UTC)
+	var client = Client{User: "alice", IP: "203.0.113.17"}
+
+	// no ACL -> everyone's allowed
+	assert.NoError(t, checkACL(nil, client, now))
+	assert.NoError(t, checkACL(&config.ServiceACL{}, client, now))
+
+	// users
+	assert.NoError(t, checkACL(&config.ServiceACL{Users: []string{"bob", "alice"}}, client, now))
+	assert.Error(t, checkACL(&config.ServiceACL{Users: []string{"bob"}}, client, now))
+
+	// IPs and CIDR ranges
+	assert.NoError(t, checkACL(&config.ServiceACL{IPs: []string{"203.0.113.17"}}, client, now))
+	assert.NoError(t, checkACL(&config.ServiceACL{IPs: []string{"10.0.0.0/8", "203.0.113.0/24"}}, client, now))
+	assert.Error(t, checkACL(&config.ServiceACL{IPs: []string{"10.0.0.0/8"}}, client, now))
+	assert.Error(t, checkACL(&config.ServiceACL{IPs: []string{"10.0.0.0/8"}}, Client{User: "alice"}, now))
+
+	// all the rules have to match
+	assert.Error(t, checkACL(&config.ServiceACL{Users: []string{"alice"}, IPs: []string{"10.0.0.0/8"}}, client, now))
+
+	// time windows
+	assert.NoError(t, checkACL(&config.ServiceACL{Times: []string{"Mon-Fri 08:00-18:00"}}, client, now))
+	assert.Error(t, checkACL(&config.ServiceACL{Times: []string{"Sat,Sun"}}, client, now))
+	assert.NoError(t, checkACL(&config.ServiceACL{Times: []string{"Sat,Sun", "Wednesday"}}, client, now))
+
+	// CheckAccess() uses the ACL of the service it's given
+	assert.Nil(t, CheckAccess(config.Service{Name: "ssh"}, client))
+	if err := CheckAccess(config.Service{Name: "ssh", ACL: &config.ServiceACL{Users: []string{"bob"}}}, client); assert.NotNil(t, err) {
+		assert.Equal(t, util.ForbiddenError, err.Code())
+	}
+}
+
+func TestTimeWindow(t *testing.T) {
+	var at = func(day int, hour int, minute int) time.Time {
+		// 2020-05-17 was a Sunday
+		return time.Date(2020, 5, 17+day, hour, minute, 0, 0, time.UTC)
+	}
+
+	var w, err = parseTimeWindow("Mon-Fri 08:00-18:00")
+	assert.NoError(t, err)
+	assert.True(t, w.contains(at(1, 8, 0)))
+	assert.True(t, w.contains(at(5, 17, 59)))
+	assert.False(t, w.contains(at(5, 18, 0)))
+	assert.False(t, w.contains(at(1, 7, 59)))
+	assert.False(t, w.contains(at(6, 12, 0)))
+
+	// day ranges may wrap around the end of the week
+	w, err = parseTimeWindow("Fri-Mon")
+	assert.NoError(t, err)
+	assert.True(t, w.contains(at(0, 0, 0)))
+	assert.True(t, w.contains(at(1, 23, 59)))
+	assert.False(t, w.contains(at(2, 12, 0)))
+
+	// windows ending before they start span midnight
+	w, err = parseTimeWindow("Fri 22:00-06:00")
+	assert.NoError(t, err)
+	assert.True(t, w.contains(at(5, 23, 0)))
+	assert.True(t, w.contains(at(6, 5, 59)))
+	assert.False(t, w.contains(at(5, 5, 0)))
+	assert.False(t, w.contains(at(6, 23, 0)))
+
+	// malformed input
+	for _, value := range []string{"", "Mon Tue 08:00-18:00", "Someday", "08:00", "8-18", "25:00-26:00", "08:60-09:00"} {
+		_, err = parseTimeWindow(value)
+		assert.Error(t, err, value)
+	}
+
+	assert.Error(t, ValidateACL(&config.ServiceACL{IPs: []string{"10.0.0.300"}}))
+	assert.Error(t, ValidateACL(&config.ServiceACL{IPs: []string{"10.0.0.0/33"}}))
+	assert.NoError(t, ValidateACL(&config.ServiceACL{IPs: []string{"::1", "fd00::/8"}, Times: []string{"22:00-06:00"}}))
+}
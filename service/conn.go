@@ -0,0 +1,59 @@
+package service
+
+import (
+	"net"
+	"time"
+
+	"github.com/ondevice/ondevice/tunnel"
+)
+
+// handlerConn -- net.Conn for ProtocolHandlers passing the tunnel to servers (e.g. SSHServerHandler)
+//
+// the handler feeds the tunnel's data to it using feed() and closeWrite(). Reads are backed by net.Pipe()
+// (which supports read deadlines, net/http relies on them), writes go straight to the tunnel
+type handlerConn struct {
+	base   *ProtocolHandlerBase
+	reader net.Conn
+	writer net.Conn
+}
+
+func newHandlerConn(base *ProtocolHandlerBase) *handlerConn {
+	var rc = handlerConn{base: base}
+	rc.reader, rc.writer = net.Pipe()
+	return &rc
+}
+
+// feed -- passes data received over the tunnel to Read() (blocks until it's all been read)
+func (c *handlerConn) feed(data []byte) error {
+	_, err := c.writer.Write(data)
+	return err
+}
+
+// closeWrite -- Read() will return io.EOF (once all the data's been read)
+func (c *handlerConn) closeWrite() {
+	c.writer.Close()
+}
+
+// abort -- makes Read() fail (e.g. once the tunnel's been closed)
+func (c *handlerConn) abort() {
+	c.reader.Close()
+}
+
+func (c *handlerConn) Read(p []byte) (int, error)  { return c.reader.Read(p) }
+func (c *handlerConn) Write(p []byte) (int, error) { return c.base.tunnel.Write(p) }
+
+// Close -- stops reading (the handler's expected to close the tunnel once it's done)
+func (c *handlerConn) Close() error {
+	return c.reader.Close()
+}
+
+func (c *handlerConn) LocalAddr() net.Addr { return tunnel.Addr{} }
+
+// RemoteAddr -- returns the client's IP address (port 0)
+func (c *handlerConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.ParseIP(c.base.client.IP)}
+}
+
+func (c *handlerConn) SetDeadline(t time.Time) error      { return c.reader.SetReadDeadline(t) }
+func (c *handlerConn) SetReadDeadline(t time.Time) error  { return c.reader.SetReadDeadline(t) }
+func (c *handlerConn) SetWriteDeadline(t time.Time) error { return nil }
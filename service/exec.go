@@ -0,0 +1,139 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ExecHandler -- protocol handler spawning a command for each tunnel (connected to it using stdin/stdout)
+type ExecHandler struct {
+	ProtocolHandlerBase
+
+	args   []string
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout io.ReadCloser
+	stderr *io.PipeWriter
+
+	lock     sync.Mutex
+	isClosed bool
+}
+
+// NewExecHandler -- Create new ExecHandler
+//
+// the command is either a JSON array (e.g. `["nc", "-U", "/tmp/admin.sock"]`) or a string to be run by /bin/sh
+func NewExecHandler(command string) (ProtocolHandler, error) {
+	var args []string
+	if strings.HasPrefix(command, "[") {
+		if err := json.Unmarshal([]byte(command), &args); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON command: %s", err.Error())
+		}
+		if len(args) == 0 {
+			return nil, fmt.Errorf("empty command")
+		}
+	} else {
+		args = []string{"/bin/sh", "-c", command}
+	}
+
+	return &ExecHandler{args: args}, nil
+}
+
+// Close -- kill the process and its children (if they're still running) and close the tunnel
+func (e *ExecHandler) Close() {
+	e.lock.Lock()
+	if e.isClosed {
+		e.lock.Unlock()
+		return
+	}
+	e.isClosed = true
+	e.lock.Unlock()
+
+	logrus.Debug("ExecHandler.Close()")
+	e.stdin.Close()
+	killProcess(e.cmd) // fails if the process has already exited
+	if e.tunnel != nil {
+		e.tunnel.Close()
+	}
+}
+
+func (e *ExecHandler) connect() error {
+	var err error
+	e.cmd = exec.Command(e.args[0], e.args[1:]...)
+	setProcessGroup(e.cmd)
+	if e.stdin, err = e.cmd.StdinPipe(); err != nil {
+		return err
+	}
+	if e.stdout, err = e.cmd.StdoutPipe(); err != nil {
+		return err
+	}
+
+	// log whatever the command writes to stderr
+	e.stderr = logrus.WithField("cmd", e.args[0]).WriterLevel(logrus.WarnLevel)
+	e.cmd.Stderr = e.stderr
+
+	if err = e.cmd.Start(); err != nil {
+		e.stderr.Close()
+		return err
+	}
+	logrus.Debugf("ExecHandler: started '%s' (pid %d)", strings.Join(e.args, " "), e.cmd.Process.Pid)
+	return nil
+}
+
+func (e *ExecHandler) onData(data []byte) {
+	if _, err := e.stdin.Write(data); err != nil {
+		logrus.WithError(err).Error("ExecHandler: failed to write to stdin")
+		e.Close()
+	}
+}
+
+// onEOF -- the client won't send any more data -> close the command's stdin
+func (e *ExecHandler) onEOF() {
+	logrus.Debug("ExecHandler.onEOF()")
+	e.stdin.Close()
+}
+
+func (e *ExecHandler) receive() {
+	buff := make([]byte, 8100)
+
+	var eof = false
+	for {
+		count, err := e.stdout.Read(buff)
+		if count > 0 {
+			// blocks if the client can't keep up
+			if _, err := e.tunnel.Write(buff[:count]); err != nil {
+				logrus.WithError(err).Debug("ExecHandler: failed to write to tunnel")
+				break
+			}
+		}
+		if err == io.EOF {
+			e.tunnel.SendEOF()
+			eof = true
+			break
+		} else if err != nil {
+			logrus.WithError(err).Error("ExecHandler: failed to read stdout")
+			break
+		}
+	}
+
+	if !eof {
+		// don't wait for the process to exit on its own (it might be stuck writing to stdout)
+		e.Close()
+	}
+	if err := e.cmd.Wait(); err != nil {
+		logrus.WithError(err).Infof("ExecHandler: '%s' failed", e.args[0])
+	}
+	e.stderr.Close()
+
+	logrus.Debug("ExecHandler: done receiving")
+	e.Close()
+}
+
+func (e *ExecHandler) self() *ProtocolHandlerBase {
+	return &e.ProtocolHandlerBase
+}
@@ -0,0 +1,16 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package service
+
+import (
+	"os/exec"
+)
+
+// setProcessGroup -- process groups aren't supported here
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcess -- kills the command (but not its child processes)
+func killProcess(cmd *exec.Cmd) error {
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testEndpoint -- tunnel.Endpoint implementation collecting whatever the handler sends
+type testEndpoint struct {
+	lock   sync.Mutex
+	data   bytes.Buffer
+	eof    bool
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newTestEndpoint() *testEndpoint {
+	return &testEndpoint{closed: make(chan struct{})}
+}
+
+func (e *testEndpoint) Write(p []byte) (int, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.data.Write(p)
+}
+
+func (e *testEndpoint) SendEOF() {
+	e.lock.Lock()
+	e.eof = true
+	e.lock.Unlock()
+}
+
+func (e *testEndpoint) Close() {
+	e.once.Do(func() { close(e.closed) })
+}
+
+func TestExecHandler(t *testing.T) {
+	var h, err = NewExecHandler(`["tr", "a-z", "A-Z"]`)
+	assert.NoError(t, err)
+
+	var endpoint = newTestEndpoint()
+	h.self().tunnel = endpoint
+	assert.NoError(t, h.connect())
+
+	go h.receive()
+	h.onData([]byte("hello "))
+	h.onData([]byte("world"))
+	h.onEOF()
+
+	// tr exits once stdin's closed -> EOF + tunnel closed
+	<-endpoint.closed
+	assert.Equal(t, "HELLO WORLD", endpoint.data.String())
+	assert.True(t, endpoint.eof)
+
+	// shell commands
+	h, err = NewExecHandler("echo foo | tr o 0")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/bin/sh", "-c", "echo foo | tr o 0"}, h.(*ExecHandler).args)
+
+	_, err = NewExecHandler(`["nc", `)
+	assert.Error(t, err)
+	_, err = NewExecHandler(`[]`)
+	assert.Error(t, err)
+}
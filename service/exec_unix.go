@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package service
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup -- runs the command in its own process group (so killProcess() gets its child processes as well)
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// killProcess -- kills the command's process group (e.g. whatever '/bin/sh -c' has started)
+func killProcess(cmd *exec.Cmd) error {
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
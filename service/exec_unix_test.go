@@ -0,0 +1,47 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package service
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecHandlerKillsChildren(t *testing.T) {
+	// the backgrounded sleep keeps stdout open (and would outlive its shell if we only killed that)
+	var h, err = NewExecHandler("sleep 60 & echo started; wait")
+	assert.NoError(t, err)
+
+	var endpoint = newTestEndpoint()
+	h.self().tunnel = endpoint
+	assert.NoError(t, h.connect())
+
+	var done = make(chan struct{})
+	go func() {
+		h.receive()
+		close(done)
+	}()
+
+	for i := 0; ; i++ {
+		endpoint.lock.Lock()
+		var started = strings.Contains(endpoint.data.String(), "started")
+		endpoint.lock.Unlock()
+		if started {
+			break
+		} else if !assert.True(t, i < 100, "command didn't start") {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	CloseHandler(h)
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Error("ExecHandler still receiving (child process wasn't killed)")
+	}
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+
+	"github.com/ondevice/ondevice/tunnel"
+	"github.com/sirupsen/logrus"
+)
+
+// HTTPHandler -- reverse proxy, parses the HTTP requests coming in over the tunnel and passes them on to an upstream server
+//
+// Rewrites the Host header (to match the upstream URL) and sets the X-Forwarded-* and X-Ondevice-User headers
+// (the latter to the user that opened the tunnel)
+type HTTPHandler struct {
+	ProtocolHandlerBase
+
+	upstream *url.URL
+	conn     *handlerConn
+	server   *http.Server
+}
+
+// NewHTTPHandler -- Create new HTTPHandler (upstream has to be a http:// or https:// URL)
+func NewHTTPHandler(upstream string) (ProtocolHandler, error) {
+	var u, err = url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid 'url' option: %s", err.Error())
+	} else if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid 'url' option (expected http:// or https://): '%s'", upstream)
+	} else if u.Host == "" {
+		return nil, fmt.Errorf("invalid 'url' option (missing host): '%s'", upstream)
+	}
+
+	rc := new(HTTPHandler)
+	rc.upstream = u
+	return rc, nil
+}
+
+// Close -- stops serving requests (e.g. once the tunnel's been closed)
+func (h *HTTPHandler) Close() {
+	h.conn.abort()
+}
+
+func (h *HTTPHandler) connect() error {
+	h.conn = newHandlerConn(&h.ProtocolHandlerBase)
+
+	var proxy = httputil.NewSingleHostReverseProxy(h.upstream)
+	var director = proxy.Director
+	proxy.Director = func(req *http.Request) {
+		var origHost = req.Host
+		director(req)
+		h.rewriteRequest(req, origHost)
+	}
+	proxy.ModifyResponse = h.rewriteResponse
+	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
+		logrus.WithError(err).Errorf("HTTPHandler: failed to proxy request to '%s'", h.upstream)
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	h.server = &http.Server{Handler: proxy}
+	return nil
+}
+
+// rewriteRequest -- sets the Host, X-Forwarded-* and X-Ondevice-User headers
+func (h *HTTPHandler) rewriteRequest(req *http.Request, origHost string) {
+	req.Host = h.upstream.Host
+
+	// the ReverseProxy will add the client's IP
+	req.Header.Del("X-Forwarded-For")
+	req.Header.Set("X-Forwarded-Host", origHost)
+	req.Header.Set("X-Forwarded-Proto", "http")
+
+	// don't let clients pick their own user name
+	req.Header.Del("X-Ondevice-User")
+	if h.client.User != "" {
+		req.Header.Set("X-Ondevice-User", h.client.User)
+	}
+}
+
+// rewriteResponse -- makes redirects to the upstream server relative (so they'll work on the client side)
+func (h *HTTPHandler) rewriteResponse(resp *http.Response) error {
+	var location = resp.Header.Get("Location")
+	if location == "" {
+		return nil
+	}
+
+	if u, err := url.Parse(location); err == nil && u.IsAbs() && u.Host == h.upstream.Host {
+		resp.Header.Set("Location", u.RequestURI())
+	}
+	return nil
+}
+
+func (h *HTTPHandler) onData(data []byte) {
+	// blocks until the HTTP server has read everything
+	if err := h.conn.feed(data); err != nil {
+		logrus.WithError(err).Debug("HTTPHandler: dropping data")
+	}
+}
+
+func (h *HTTPHandler) onEOF() {
+	logrus.Debug("HTTPHandler.onEOF()")
+	h.conn.closeWrite()
+}
+
+func (h *HTTPHandler) receive() {
+	var l = newSingleConnListener(h.conn)
+	h.server.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed || state == http.StateHijacked {
+			l.Close()
+		}
+	}
+
+	if err := h.server.Serve(l); err != nil && err != errListenerClosed {
+		logrus.WithError(err).Error("HTTPHandler error")
+	}
+
+	logrus.Debug("HTTPHandler: done receiving")
+	h.tunnel.Close()
+}
+
+func (h *HTTPHandler) self() *ProtocolHandlerBase {
+	return &h.ProtocolHandlerBase
+}
+
+// errListenerClosed -- returned by singleConnListener.Accept() once the connection's done
+var errListenerClosed = fmt.Errorf("listener closed")
+
+// singleConnListener -- net.Listener returning conn once (and blocking until Close() is called after that)
+type singleConnListener struct {
+	conn net.Conn
+
+	lock   sync.Mutex
+	done   chan struct{}
+	closed bool
+}
+
+func newSingleConnListener(conn net.Conn) *singleConnListener {
+	return &singleConnListener{conn: conn, done: make(chan struct{})}
+}
+
+func (l *singleConnListener) Accept() (net.Conn, error) {
+	l.lock.Lock()
+	var conn = l.conn
+	l.conn = nil
+	l.lock.Unlock()
+
+	if conn != nil {
+		return conn, nil
+	}
+	<-l.done
+	return nil, errListenerClosed
+}
+
+func (l *singleConnListener) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.closed {
+		l.closed = true
+		close(l.done)
+	}
+	return nil
+}
+
+func (l *singleConnListener) Addr() net.Addr {
+	return tunnel.Addr{}
+}
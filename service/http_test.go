@@ -0,0 +1,58 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPHandler(t *testing.T) {
+	var upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Location", "http://"+req.Host+"/login?next=%2F")
+		w.Header().Set("X-Seen-Host", req.Host)
+		w.Header().Set("X-Seen-Forwarded-Host", req.Header.Get("X-Forwarded-Host"))
+		w.Header().Set("X-Seen-Forwarded-For", req.Header.Get("X-Forwarded-For"))
+		w.Header().Set("X-Seen-User", req.Header.Get("X-Ondevice-User"))
+		w.WriteHeader(http.StatusFound)
+		w.Write([]byte(req.URL.Path))
+	}))
+	defer upstream.Close()
+
+	var h, err = NewHTTPHandler(upstream.URL)
+	assert.NoError(t, err)
+
+	var endpoint = newTestEndpoint()
+	h.self().tunnel = endpoint
+	h.self().client = Client{User: "alice", IP: "192.0.2.1"}
+	assert.NoError(t, h.connect())
+
+	go h.receive()
+	h.onData([]byte("GET /hello HTTP/1.1\r\nHost: localhost:1234\r\nX-Ondevice-User: mallory\r\nX-Forwarded-For: 10.0.0.1\r\nConnection: close\r\n\r\n"))
+
+	// the server closes the connection after responding
+	<-endpoint.closed
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(endpoint.data.Bytes())), nil)
+	if !assert.NoError(t, err) {
+		return
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+
+	assert.Equal(t, http.StatusFound, resp.StatusCode)
+	assert.Equal(t, "/hello", string(body))
+	assert.Equal(t, upstream.Listener.Addr().String(), resp.Header.Get("X-Seen-Host"))
+	assert.Equal(t, "localhost:1234", resp.Header.Get("X-Seen-Forwarded-Host"))
+	assert.Equal(t, "192.0.2.1", resp.Header.Get("X-Seen-Forwarded-For"))
+	assert.Equal(t, "alice", resp.Header.Get("X-Seen-User"))
+	assert.Equal(t, "/login?next=%2F", resp.Header.Get("Location"))
+
+	// invalid upstream URLs
+	_, err = NewHTTPHandler("ftp://localhost/")
+	assert.Error(t, err)
+	_, err = NewHTTPHandler("localhost:8080")
+	assert.Error(t, err)
+}
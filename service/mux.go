@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/tunnel"
+	"github.com/ondevice/ondevice/util"
+	"github.com/sirupsen/logrus"
+)
+
+// MuxHooks -- lets the caller keep track of the streams of a mux tunnel (all of them are optional)
+type MuxHooks struct {
+	// Approve -- called for each stream that passed the ACL check (before connecting to the service), returning an error rejects it
+	Approve func(s *tunnel.Stream) util.APIError
+
+	// Opened -- called once a stream's been connected to its service
+	Opened func(s *tunnel.Stream)
+
+	// Closed -- called once a stream is done (err is set if it's been rejected)
+	Closed func(s *tunnel.Stream, err util.APIError)
+}
+
+// RunMux -- Accept a multiplexed tunnel and connect each of its streams to the requested service
+//
+// t should be a fresh Tunnel instance, each stream is checked against its service's ACL
+// (see CheckAccess()) and hooks.Approve. Blocks until the tunnel has been closed
+func RunMux(t *tunnel.Tunnel, tunnelID string, brokerURL string, client Client, hooks MuxHooks) error {
+	m := tunnel.NewMux(t)
+	m.OnStream = func(s *tunnel.Stream) util.APIError {
+		var svc, err = FindService(s.Service, s.Protocol)
+		if err == nil {
+			err = CheckAccess(svc, client)
+		}
+		if err == nil && hooks.Approve != nil {
+			err = hooks.Approve(s)
+		}
+		if err == nil {
+			err = onMuxStream(s, svc, client, hooks)
+		}
+		if err != nil && hooks.Closed != nil {
+			hooks.Closed(s, err)
+		}
+		return err
+	}
+
+	if err := tunnel.Accept(t, tunnelID, brokerURL); err != nil {
+		logrus.WithError(err).Error("accepting mux tunnel failed: ")
+		return err
+	}
+	t.Wait()
+	return nil
+}
+
+// onMuxStream -- connects a new mux stream to the ProtocolHandler of the requested service
+func onMuxStream(s *tunnel.Stream, svc config.Service, client Client, hooks MuxHooks) util.APIError {
+	logrus.Infof("mux stream request for %s:%s", s.Protocol, s.Service)
+
+	p := GetProtocolHandler(svc, client)
+	if p == nil {
+		return util.NewAPIError(util.NotFoundError, fmt.Sprintf("Couldn't find service: '%s'", s.Service))
+	}
+	p.self().tunnel = s
+
+	if hooks.Opened != nil {
+		hooks.Opened(s)
+	}
+	go func() {
+		s.Wait()
+		CloseHandler(p)
+		if hooks.Closed != nil {
+			hooks.Closed(s, nil)
+		}
+	}()
+
+	// feed the stream's data to the handler (Stream.Read() blocks until there's data)
+	go func() {
+		buff := make([]byte, 8100)
+		for {
+			count, err := s.Read(buff)
+			if count > 0 {
+				p.onData(buff[:count])
+			}
+			if err != nil {
+				p.onEOF()
+				break
+			}
+		}
+	}()
+	go p.receive()
+
+	return nil
+}
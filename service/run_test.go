@@ -0,0 +1,151 @@
+package service
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/tunnel"
+	"github.com/stretchr/testify/assert"
+)
+
+// testBroker -- relays the messages between a single client and device (see tunnel.Connect() and tunnel.Accept())
+func testBroker(t *testing.T) *httptest.Server {
+	var upgrader websocket.Upgrader
+	var sides = make(chan *websocket.Conn, 2)
+
+	var relay = func(from *websocket.Conn, to *websocket.Conn) {
+		for {
+			var msgType, msg, err = from.ReadMessage()
+			if err != nil {
+				to.Close()
+				return
+			}
+			if err = to.WriteMessage(msgType, msg); err != nil {
+				from.Close()
+				return
+			}
+		}
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ws, err = upgrader.Upgrade(w, r, nil)
+		if !assert.NoError(t, err) {
+			return
+		}
+		if r.URL.Path != "/v1.1/accept/websocket" {
+			sides <- ws
+			return
+		}
+
+		// the client connects first
+		var client = <-sides
+		for _, c := range []*websocket.Conn{client, ws} {
+			c.WriteMessage(websocket.BinaryMessage, []byte("meta:connected"))
+		}
+		go relay(client, ws)
+		go relay(ws, client)
+	}))
+}
+
+// testConfig -- sets up an ondevice.conf (and auth.json with device credentials) in a temporary directory
+func testConfig(t *testing.T) (cleanup func()) {
+	var dir, err = ioutil.TempDir("", "ondevice-test")
+	assert.NoError(t, err)
+
+	var auth = []byte(`{"Device": {"User": "test", "Auth": "deviceKey"}}`)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "ondevice.conf"), nil, 0o644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "auth.json"), auth, 0o600))
+	config.Init(filepath.Join(dir, "ondevice.conf"))
+
+	return func() { os.RemoveAll(dir) }
+}
+
+// runTunnel -- connects to the given handler through testBroker(), sends data and returns what comes back (once len(data) bytes have been received)
+func runTunnel(t *testing.T, p ProtocolHandler, data []byte) []byte {
+	var broker = testBroker(t)
+	defer broker.Close()
+
+	var clientTunnel tunnel.Tunnel
+	var conn = tunnel.NewConn(&clientTunnel, "dev", "svc")
+	var connected = make(chan error, 1)
+	go func() {
+		connected <- tunnel.Connect(&clientTunnel, "dev", "svc", "proto", config.NewAuth("user", "key").WithAPIServer(broker.URL))
+	}()
+
+	var deviceTunnel tunnel.Tunnel
+	go Run(p, &deviceTunnel, "tunnelID", broker.URL)
+	if err := <-connected; !assert.Nil(t, err) {
+		return nil
+	}
+	defer conn.Close()
+
+	// write and read at the same time (the handler sends data back while we're still sending)
+	go func() {
+		for offset := 0; offset < len(data); offset += 8100 {
+			var end = offset + 8100
+			if end > len(data) {
+				end = len(data)
+			}
+			if _, err := conn.Write(data[offset:end]); err != nil {
+				return
+			}
+		}
+	}()
+
+	var rc = make([]byte, len(data))
+	conn.SetReadDeadline(time.Now().Add(20 * time.Second))
+	var n, err = io.ReadFull(conn, rc)
+	assert.NoError(t, err)
+	return rc[:n]
+}
+
+func TestRunFlowControl(t *testing.T) {
+	defer testConfig(t)()
+
+	// both ways have to exceed the flow control window a few times
+	var data = make([]byte, 3*512*1024+123)
+	rand.Read(data)
+
+	t.Run("echo", func(t *testing.T) {
+		var received = runTunnel(t, NewEchoHandler(), data)
+		assert.True(t, bytes.Equal(data, received), "received %d bytes", len(received))
+	})
+
+	t.Run("tcp", func(t *testing.T) {
+		var l, err = net.Listen("tcp", "127.0.0.1:0")
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer l.Close()
+		go func() {
+			for {
+				var c, err = l.Accept()
+				if err != nil {
+					return
+				}
+				go func() {
+					io.Copy(c, c)
+					c.Close()
+				}()
+			}
+		}()
+
+		var p = NewTCPHandler(l.Addr().String())
+		if !assert.NoError(t, p.connect()) {
+			return
+		}
+		var received = runTunnel(t, p, data)
+		assert.True(t, bytes.Equal(data, received), "received %d bytes", len(received))
+	})
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/sirupsen/logrus"
+)
+
+// serialConfig -- serial port settings (see NewSerialHandler())
+type serialConfig struct {
+	Path     string
+	Baud     int
+	DataBits int
+	Parity   string // 'none', 'even' or 'odd'
+	StopBits int
+}
+
+// SerialHandler -- protocol handler connecting to a serial port (e.g. a router's or PLC's console)
+//
+// The port is locked exclusively while the tunnel's open (so two clients won't talk over each other)
+type SerialHandler struct {
+	ProtocolHandlerBase
+
+	cfg  serialConfig
+	port *os.File
+
+	lock     sync.Mutex
+	isClosed bool
+}
+
+// NewSerialHandler -- Create new SerialHandler
+//
+// options: path=<device> (required), baud=<rate> (default: 115200), data_bits=5..8 (default: 8),
+// parity=none|even|odd (default: none), stop_bits=1|2 (default: 1)
+func NewSerialHandler(svc config.Service) (ProtocolHandler, error) {
+	var cfg = serialConfig{Path: svc.Option("path", ""), Parity: svc.Option("parity", "none")}
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("missing 'path' option for serial service")
+	}
+
+	var err error
+	if cfg.Baud, err = _intOption(svc, "baud", 115200); err != nil {
+		return nil, err
+	}
+	if cfg.DataBits, err = _intOption(svc, "data_bits", 8); err != nil {
+		return nil, err
+	} else if cfg.DataBits < 5 || cfg.DataBits > 8 {
+		return nil, fmt.Errorf("invalid 'data_bits' option (expected 5-8): %d", cfg.DataBits)
+	}
+	if cfg.StopBits, err = _intOption(svc, "stop_bits", 1); err != nil {
+		return nil, err
+	} else if cfg.StopBits != 1 && cfg.StopBits != 2 {
+		return nil, fmt.Errorf("invalid 'stop_bits' option (expected 1 or 2): %d", cfg.StopBits)
+	}
+	if cfg.Parity != "none" && cfg.Parity != "even" && cfg.Parity != "odd" {
+		return nil, fmt.Errorf("invalid 'parity' option (expected none, even or odd): '%s'", cfg.Parity)
+	}
+
+	if err = checkSerialConfig(cfg); err != nil {
+		return nil, err
+	}
+
+	return &SerialHandler{cfg: cfg}, nil
+}
+
+// Close -- Close the serial port (releasing the lock) and the tunnel
+func (s *SerialHandler) Close() {
+	s.lock.Lock()
+	if s.isClosed {
+		s.lock.Unlock()
+		return
+	}
+	s.isClosed = true
+	s.lock.Unlock()
+
+	logrus.Debug("SerialHandler.Close()")
+	s.port.Close()
+	if s.tunnel != nil {
+		s.tunnel.Close()
+	}
+}
+
+func (s *SerialHandler) connect() error {
+	var err error
+	s.port, err = openSerial(s.cfg)
+	return err
+}
+
+func (s *SerialHandler) onData(data []byte) {
+	if _, err := s.port.Write(data); err != nil {
+		logrus.WithError(err).Error("SerialHandler: failed to write to serial port")
+		s.Close()
+	}
+}
+
+func (s *SerialHandler) onEOF() {
+	// serial ports can't be half-closed
+	logrus.Debug("SerialHandler.onEOF()")
+	s.Close()
+}
+
+func (s *SerialHandler) receive() {
+	buff := make([]byte, 8100)
+
+	for {
+		count, err := s.port.Read(buff)
+		if err != nil {
+			logrus.WithError(err).Debug("SerialHandler: stopped reading from serial port")
+			break
+		}
+
+		// blocks if the client can't keep up
+		if _, err = s.tunnel.Write(buff[:count]); err != nil {
+			logrus.WithError(err).Debug("SerialHandler: failed to write to tunnel")
+			break
+		}
+	}
+
+	logrus.Debug("SerialHandler: done receiving")
+	s.Close()
+}
+
+func (s *SerialHandler) self() *ProtocolHandlerBase {
+	return &s.ProtocolHandlerBase
+}
+
+func _intOption(svc config.Service, key string, defaultValue int) (int, error) {
+	var value = svc.Option(key, "")
+	if value == "" {
+		return defaultValue, nil
+	}
+	rc, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid '%s' option (expected a number): '%s'", key, value)
+	}
+	return rc, nil
+}
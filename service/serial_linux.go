@@ -0,0 +1,106 @@
+//go:build linux
+// +build linux
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// serialBaudRates -- the baud rates termios supports
+var serialBaudRates = map[int]uint32{
+	50: unix.B50, 75: unix.B75, 110: unix.B110, 134: unix.B134, 150: unix.B150, 200: unix.B200,
+	300: unix.B300, 600: unix.B600, 1200: unix.B1200, 1800: unix.B1800, 2400: unix.B2400,
+	4800: unix.B4800, 9600: unix.B9600, 19200: unix.B19200, 38400: unix.B38400, 57600: unix.B57600,
+	115200: unix.B115200, 230400: unix.B230400, 460800: unix.B460800, 500000: unix.B500000,
+	576000: unix.B576000, 921600: unix.B921600, 1000000: unix.B1000000, 1152000: unix.B1152000,
+	1500000: unix.B1500000, 2000000: unix.B2000000, 2500000: unix.B2500000, 3000000: unix.B3000000,
+	3500000: unix.B3500000, 4000000: unix.B4000000,
+}
+
+var serialDataBits = map[int]uint32{5: unix.CS5, 6: unix.CS6, 7: unix.CS7, 8: unix.CS8}
+
+// checkSerialConfig -- returns an error if the port settings aren't supported
+func checkSerialConfig(cfg serialConfig) error {
+	if _, ok := serialBaudRates[cfg.Baud]; !ok {
+		return fmt.Errorf("unsupported baud rate: %d", cfg.Baud)
+	}
+	return nil
+}
+
+// openSerial -- opens and locks the serial port, then sets it to raw mode (using the given settings)
+func openSerial(cfg serialConfig) (*os.File, error) {
+	// O_NONBLOCK: don't wait for the carrier (_setTermios() sets CLOCAL)
+	var f, err = os.OpenFile(cfg.Path, os.O_RDWR|syscall.O_NOCTTY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	// (using SyscallConn() instead of Fd(), which would put the file into blocking mode, so Close() couldn't interrupt Read())
+	rawConn, err := f.SyscallConn()
+	if err == nil {
+		if ctrlErr := rawConn.Control(func(fd uintptr) { err = _setupSerial(int(fd), cfg) }); ctrlErr != nil {
+			err = ctrlErr
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// _setupSerial -- locks the port, then applies the settings
+func _setupSerial(fd int, cfg serialConfig) error {
+	if err := unix.Flock(fd, unix.LOCK_EX|unix.LOCK_NB); err == unix.EWOULDBLOCK {
+		return fmt.Errorf("serial port '%s' is in use", cfg.Path)
+	} else if err != nil {
+		return fmt.Errorf("failed to lock serial port '%s': %s", cfg.Path, err.Error())
+	}
+
+	// TIOCEXCL: make other (non-root) processes' open() calls fail while we're using the port
+	var err = unix.IoctlSetInt(fd, unix.TIOCEXCL, 0)
+	if err == nil {
+		err = _setTermios(fd, cfg)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to set up serial port '%s': %s", cfg.Path, err.Error())
+	}
+	return nil
+}
+
+// _setTermios -- puts the port into raw mode (like cfmakeraw()) and applies cfg
+func _setTermios(fd int, cfg serialConfig) error {
+	var t, err = unix.IoctlGetTermios(fd, unix.TCGETS)
+	if err != nil {
+		return err
+	}
+
+	var baud = serialBaudRates[cfg.Baud]
+	t.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON | unix.IXOFF
+	t.Oflag &^= unix.OPOST
+	t.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	t.Cflag &^= unix.CSIZE | unix.PARENB | unix.PARODD | unix.CSTOPB | unix.CBAUD | unix.CRTSCTS
+	t.Cflag |= unix.CREAD | unix.CLOCAL | serialDataBits[cfg.DataBits] | baud
+
+	switch cfg.Parity {
+	case "even":
+		t.Cflag |= unix.PARENB
+	case "odd":
+		t.Cflag |= unix.PARENB | unix.PARODD
+	}
+	if cfg.StopBits == 2 {
+		t.Cflag |= unix.CSTOPB
+	}
+
+	t.Ispeed, t.Ospeed = baud, baud
+	t.Cc[unix.VMIN] = 1
+	t.Cc[unix.VTIME] = 0
+
+	return unix.IoctlSetTermios(fd, unix.TCSETS, t)
+}
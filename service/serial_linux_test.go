@@ -0,0 +1,94 @@
+package service
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/sys/unix"
+)
+
+// testPty -- opens a pseudo terminal pair (the slave end stands in for a serial port)
+func testPty(t *testing.T) (*os.File, string) {
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		t.Skip("no PTY support: ", err)
+	}
+	var fd = int(ptmx.Fd())
+	assert.NoError(t, unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0))
+	n, err := unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	assert.NoError(t, err)
+	return ptmx, fmt.Sprintf("/dev/pts/%d", n)
+}
+
+func TestSerialHandler(t *testing.T) {
+	var ptmx, path = testPty(t)
+	defer ptmx.Close()
+
+	var svc = config.NewService("console", "serial", map[string]string{"path": path, "baud": "9600", "parity": "even"})
+	var h, err = NewSerialHandler(svc)
+	assert.NoError(t, err)
+	var endpoint = newTestEndpoint()
+	h.self().tunnel = endpoint
+	if !assert.NoError(t, h.connect()) {
+		return
+	}
+	go h.receive()
+
+	// the settings have been applied (PTYs ignore parity though)
+	var termios *unix.Termios
+	rawConn, _ := h.(*SerialHandler).port.SyscallConn()
+	rawConn.Control(func(fd uintptr) { termios, err = unix.IoctlGetTermios(int(fd), unix.TCGETS) })
+	if assert.NoError(t, err) {
+		assert.Equal(t, uint32(unix.B9600), termios.Cflag&unix.CBAUD)
+		assert.Equal(t, uint32(0), termios.Lflag&(unix.ECHO|unix.ICANON))
+	}
+
+	// the port's locked
+	var other, _ = NewSerialHandler(svc)
+	assert.Error(t, other.connect())
+
+	// tunnel -> port
+	h.onData([]byte("hello\n"))
+	var buff = make([]byte, 100)
+	count, err := ptmx.Read(buff)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello\n", string(buff[:count]), "raw mode: no CRLF translation")
+
+	// port -> tunnel
+	ptmx.Write([]byte("login: "))
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		endpoint.lock.Lock()
+		var data = endpoint.data.String()
+		endpoint.lock.Unlock()
+		if data == "login: " {
+			break
+		}
+	}
+	endpoint.lock.Lock()
+	assert.Equal(t, "login: ", endpoint.data.String())
+	endpoint.lock.Unlock()
+
+	// EOF closes the port (releasing the lock)
+	h.onEOF()
+	<-endpoint.closed
+	other, _ = NewSerialHandler(svc)
+	assert.NoError(t, other.connect())
+	other.(*SerialHandler).Close()
+
+	// invalid settings
+	for _, options := range []map[string]string{
+		{},
+		{"path": path, "baud": "12345"},
+		{"path": path, "data_bits": "9"},
+		{"path": path, "stop_bits": "3"},
+		{"path": path, "parity": "mark"},
+	} {
+		_, err = NewSerialHandler(config.NewService("console", "serial", options))
+		assert.Error(t, err, options)
+	}
+}
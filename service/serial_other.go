@@ -0,0 +1,19 @@
+//go:build !linux
+// +build !linux
+
+package service
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+// checkSerialConfig -- serial ports are only supported on linux (for now)
+func checkSerialConfig(cfg serialConfig) error {
+	return fmt.Errorf("serial ports aren't supported on %s", runtime.GOOS)
+}
+
+func openSerial(cfg serialConfig) (*os.File, error) {
+	return nil, checkSerialConfig(cfg)
+}
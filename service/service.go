@@ -1,15 +1,22 @@
 package service
 
 import (
-	"os"
+	"fmt"
+	"net/http"
+	"strconv"
 
+	"github.com/mitchellh/go-homedir"
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/service/sshd"
 	"github.com/ondevice/ondevice/tunnel"
+	"github.com/ondevice/ondevice/util"
 	"github.com/sirupsen/logrus"
 )
 
 // ProtocolHandlerBase -- ProtocolHandler base struct
 type ProtocolHandlerBase struct {
-	tunnel *tunnel.Tunnel
+	tunnel tunnel.Endpoint
+	client Client
 }
 
 // ProtocolHandler -- ProtocolHandler interface
@@ -23,61 +30,168 @@ type ProtocolHandler interface {
 	onEOF()
 }
 
-// GetProtocolHandler -- Get
-func GetProtocolHandler(name string) ProtocolHandler {
-	var rc ProtocolHandler
-	switch name {
+// GetProtocolHandler -- Get the ProtocolHandler for the given service definition (and the client connecting to it)
+func GetProtocolHandler(svc config.Service, client Client) ProtocolHandler {
+	rc, err := newProtocolHandler(svc)
+	if err != nil {
+		logrus.WithError(err).Errorf("invalid service: '%s'", svc.Name)
+		return nil
+	}
+	rc.self().client = client
+
+	if err = rc.connect(); err != nil {
+		logrus.Error("GetProtocolHandler error: ", err)
+		return nil
+	}
+
+	return rc
+}
+
+// Validate -- returns an error if the given service definition can't be used (e.g. unsupported protocol or missing options)
+func Validate(svc config.Service) error {
+	if svc.Name == tunnel.MuxService {
+		return fmt.Errorf("'%s' is a reserved service name", svc.Name)
+	}
+	if err := ValidateACL(svc.ACL); err != nil {
+		return err
+	}
+	_, err := newProtocolHandler(svc)
+	return err
+}
+
+// newProtocolHandler -- creates (but doesn't connect) the ProtocolHandler for the given service
+func newProtocolHandler(svc config.Service) (ProtocolHandler, error) {
+	switch svc.Protocol {
 	case "echo":
-		rc = NewEchoHandler()
-	case "ssh":
-		// TODO This is only a temporary (and undocumented) way to get ssh working
-		//   in the docker image. As soon as we have proper support for services,
-		//   this will be removed (and the docker image will translate the SSH_ADDR
-		//   variable to a matching `ondevice service ...` call)
-		//   so don't rely on it working (except for the docker image of course)!
-		var addr = os.Getenv("SSH_ADDR")
+		return NewEchoHandler(), nil
+	case "ssh", "tcp":
+		if svc.Protocol == "ssh" && svc.Option("builtin", "") != "" {
+			if h, err := newSSHServerHandler(svc); h != nil || err != nil {
+				return h, err
+			}
+		}
+		var addr = svc.Option("addr", "")
 		if addr == "" {
-			addr = "127.0.0.1:22"
+			return nil, fmt.Errorf("missing 'addr' option for %s service", svc.Protocol)
 		}
-		rc = NewTCPHandler(addr)
-	default:
-		logrus.Errorf("unsupported protocol: '%s'", name)
-		return nil
+		return NewTCPHandler(addr), nil
+	case "udp":
+		var addr = svc.Option("addr", "")
+		if addr == "" {
+			return nil, fmt.Errorf("missing 'addr' option for %s service", svc.Protocol)
+		}
+		return NewUDPHandler(addr)
+	case "unix":
+		var path = svc.Option("path", "")
+		if path == "" {
+			return nil, fmt.Errorf("missing 'path' option for %s service", svc.Protocol)
+		}
+		return NewUnixHandler(path), nil
+	case "serial":
+		return NewSerialHandler(svc)
+	case "exec":
+		var cmd = svc.Option("cmd", "")
+		if cmd == "" {
+			return nil, fmt.Errorf("missing 'cmd' option for %s service", svc.Protocol)
+		}
+		return NewExecHandler(cmd)
+	case "http":
+		var upstream = svc.Option("url", "")
+		if upstream == "" {
+			return nil, fmt.Errorf("missing 'url' option for %s service", svc.Protocol)
+		}
+		return NewHTTPHandler(upstream)
+	case "socks":
+		var allow = svc.Option("allow", "")
+		if allow == "" {
+			return nil, fmt.Errorf("missing 'allow' option for %s service", svc.Protocol)
+		}
+		return NewSOCKSHandler(allow)
+	}
+
+	return nil, fmt.Errorf("unsupported protocol: '%s'", svc.Protocol)
+}
+
+// newSSHServerHandler -- creates the built-in SSH server's ProtocolHandler
+//
+// options: builtin=true, authorized_keys=<path> (default: ~/.ssh/authorized_keys), shell=<path>
+//
+// returns nil (without error) if builtin is false
+func newSSHServerHandler(svc config.Service) (ProtocolHandler, error) {
+	if builtin, err := strconv.ParseBool(svc.Option("builtin", "")); err != nil {
+		return nil, fmt.Errorf("invalid 'builtin' option (expected true or false): '%s'", svc.Option("builtin", ""))
+	} else if !builtin {
+		return nil, nil
 	}
 
-	err := rc.connect()
+	authorizedKeys, err := homedir.Expand(svc.Option("authorized_keys", "~/.ssh/authorized_keys"))
 	if err != nil {
-		logrus.Error("GetProtocolHandler error: ", err)
-		return nil
+		return nil, err
 	}
 
-	p := rc.self()
-	p.tunnel = new(tunnel.Tunnel)
-	p.tunnel.DataListeners = append(p.tunnel.DataListeners, rc.onData)
-	p.tunnel.EOFListeners = append(p.tunnel.EOFListeners, rc.onEOF)
+	var hostKey = config.MustLoad().GetPath(config.PathSSHHostKey)
+	if err = hostKey.Error(); err != nil {
+		return nil, err
+	}
 
-	return rc
+	return NewSSHServerHandler(sshd.Server{
+		HostKeyPath:        hostKey.GetAbsolutePath(),
+		AuthorizedKeysPath: authorizedKeys,
+		Shell:              svc.Option("shell", ""),
+	}), nil
 }
 
-// GetServiceHandler -- Get the ProtocolHandler for a given service
-func GetServiceHandler(svc string, protocol string) ProtocolHandler {
-	// TODO implement actual services
-	if svc != protocol {
-		logrus.Errorf("protocol/service mismatch: svc=%s, protocol=%s", svc, protocol)
-		return nil
+// FindService -- looks up the given service in services.json
+//
+// services.json is re-read each time (so changes take effect for new tunnels immediately).
+// Returns a 404 APIError if there's no such service (or it's using a different protocol)
+// and a 500 APIError if services.json couldn't be loaded
+func FindService(svc string, protocol string) (config.Service, util.APIError) {
+	var services = config.LoadServices()
+	if err := services.Error(); err != nil {
+		logrus.WithError(err).Error("failed to load services")
+		return config.Service{}, util.NewAPIError(http.StatusInternalServerError, "Failed to load services")
 	}
 
-	return GetProtocolHandler(protocol)
+	var s, ok = services.GetService(svc)
+	if !ok {
+		logrus.Errorf("service not found: '%s'", svc)
+		return s, util.NewAPIError(util.NotFoundError, fmt.Sprintf("Couldn't find service: '%s'", svc))
+	}
+	if s.Protocol != protocol {
+		logrus.Errorf("protocol/service mismatch: svc=%s, protocol=%s (expected: %s)", svc, protocol, s.Protocol)
+		return s, util.NewAPIError(util.NotFoundError, fmt.Sprintf("Couldn't find service: '%s'", svc))
+	}
+	return s, nil
 }
 
 // Run -- Start the tunnel handler (synchronously)
-func Run(p ProtocolHandler, tunnelID string, brokerURL string) {
-	data := p.self()
+//
+// t should be a fresh Tunnel instance. Returns an error if accepting the tunnel failed
+func Run(p ProtocolHandler, t *tunnel.Tunnel, tunnelID string, brokerURL string) error {
+	t.DataListeners = append(t.DataListeners, p.onData)
+	t.EOFListeners = append(t.EOFListeners, p.onEOF)
+	if c, ok := p.(interface{ Close() }); ok {
+		// e.g. close TCPHandler's socket (interrupting receive()) if the tunnel's been closed on our end
+		t.CloseListeners = append(t.CloseListeners, c.Close)
+	}
+	p.self().tunnel = t
 
-	err := tunnel.Accept(data.tunnel, tunnelID, brokerURL)
+	err := tunnel.Accept(t, tunnelID, brokerURL)
 	if err != nil {
 		logrus.WithError(err).Error("accepting tunnel failed: ")
-	} else {
-		p.receive()
+		// the tunnel never got connected, only clean up the handler's side
+		p.self().tunnel = nil
+		CloseHandler(p)
+		return err
+	}
+	p.receive()
+	return nil
+}
+
+// CloseHandler -- closes the given ProtocolHandler (if it needs closing, e.g. TCPHandler's socket)
+func CloseHandler(p ProtocolHandler) {
+	if c, ok := p.(interface{ Close() }); ok {
+		c.Close()
 	}
 }
@@ -0,0 +1,353 @@
+package service
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SOCKS5 constants (RFC 1928)
+const (
+	socksVersion        = 5
+	socksMethodNoAuth   = 0
+	socksMethodNone     = 0xff
+	socksCmdConnect     = 1
+	socksAtypIPv4       = 1
+	socksAtypDomain     = 3
+	socksAtypIPv6       = 4
+	socksRepSuccess     = 0
+	socksRepFailure     = 1
+	socksRepNotAllowed  = 2
+	socksRepUnreachable = 4
+	socksRepRefused     = 5
+	socksRepBadCommand  = 7
+	socksRepBadAddrType = 8
+)
+
+// socksDialTimeout -- how long we'll try to connect to the destination
+const socksDialTimeout = 10 * time.Second
+
+// SOCKSHandler -- SOCKS5 proxy (CONNECT only), lets clients reach hosts on the device's network
+//
+// The tunnel's already authenticated, so clients aren't asked for credentials. Destinations have to match
+// the service's allow-list (see parseSOCKSRule())
+type SOCKSHandler struct {
+	ProtocolHandlerBase
+
+	rules []socksRule
+	conn  *handlerConn
+
+	lock     sync.Mutex
+	upstream net.Conn
+	isClosed bool
+}
+
+// NewSOCKSHandler -- Create new SOCKSHandler (allow is a comma separated list of destinations, e.g. '192.168.1.0/24,*.lan:80')
+func NewSOCKSHandler(allow string) (ProtocolHandler, error) {
+	rc := new(SOCKSHandler)
+	for _, value := range strings.Split(allow, ",") {
+		if value = strings.TrimSpace(value); value == "" {
+			continue
+		}
+		var rule, err = parseSOCKSRule(value)
+		if err != nil {
+			return nil, err
+		}
+		rc.rules = append(rc.rules, rule)
+	}
+	if len(rc.rules) == 0 {
+		return nil, fmt.Errorf("empty 'allow' option (use allow='*' to allow all destinations)")
+	}
+
+	return rc, nil
+}
+
+// Close -- closes the connection to the destination (and stops reading from the tunnel)
+func (h *SOCKSHandler) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.isClosed {
+		return
+	}
+	logrus.Debug("SOCKSHandler.Close()")
+	h.isClosed = true
+	h.conn.abort()
+	if h.upstream != nil {
+		h.upstream.Close()
+	}
+}
+
+func (h *SOCKSHandler) connect() error {
+	h.conn = newHandlerConn(&h.ProtocolHandlerBase)
+	return nil
+}
+
+func (h *SOCKSHandler) onData(data []byte) {
+	// blocks until it's been read (by handshake() or the upstream io.Copy())
+	if err := h.conn.feed(data); err != nil {
+		logrus.WithError(err).Debug("SOCKSHandler: dropping data")
+	}
+}
+
+func (h *SOCKSHandler) onEOF() {
+	logrus.Debug("SOCKSHandler.onEOF()")
+	h.conn.closeWrite()
+}
+
+func (h *SOCKSHandler) receive() {
+	defer h.tunnel.Close()
+	defer h.Close()
+
+	upstream, err := h.handshake()
+	if err != nil {
+		logrus.WithError(err).Error("SOCKSHandler: request failed")
+		return
+	}
+
+	h.lock.Lock()
+	if h.isClosed {
+		h.lock.Unlock()
+		upstream.Close()
+		return
+	}
+	h.upstream = upstream
+	h.lock.Unlock()
+
+	var done = make(chan struct{})
+	go func() {
+		io.Copy(upstream, h.conn)
+		if tcpConn, ok := upstream.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+		close(done)
+	}()
+
+	if _, err = io.Copy(h.conn, upstream); err != nil {
+		logrus.WithError(err).Debug("SOCKSHandler: connection error")
+		return
+	}
+	h.tunnel.SendEOF()
+	<-done
+
+	logrus.Debug("SOCKSHandler: done receiving")
+}
+
+// handshake -- negotiates the (lack of) authentication, reads the CONNECT request and connects to its destination
+func (h *SOCKSHandler) handshake() (net.Conn, error) {
+	// greeting: VER NMETHODS METHODS...
+	var header [2]byte
+	if _, err := io.ReadFull(h.conn, header[:]); err != nil {
+		return nil, err
+	} else if header[0] != socksVersion {
+		return nil, fmt.Errorf("unsupported SOCKS version: %d", header[0])
+	}
+	var methods = make([]byte, header[1])
+	if _, err := io.ReadFull(h.conn, methods); err != nil {
+		return nil, err
+	}
+	if bytes.IndexByte(methods, socksMethodNoAuth) < 0 {
+		h.conn.Write([]byte{socksVersion, socksMethodNone})
+		return nil, fmt.Errorf("client doesn't support unauthenticated SOCKS connections")
+	}
+	if _, err := h.conn.Write([]byte{socksVersion, socksMethodNoAuth}); err != nil {
+		return nil, err
+	}
+
+	// request: VER CMD RSV ATYP DST.ADDR DST.PORT
+	var req [4]byte
+	if _, err := io.ReadFull(h.conn, req[:]); err != nil {
+		return nil, err
+	} else if req[0] != socksVersion {
+		return nil, fmt.Errorf("unsupported SOCKS version: %d", req[0])
+	}
+
+	var name string
+	var ip net.IP
+	switch req[3] {
+	case socksAtypIPv4, socksAtypIPv6:
+		ip = make(net.IP, net.IPv4len)
+		if req[3] == socksAtypIPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(h.conn, ip); err != nil {
+			return nil, err
+		}
+	case socksAtypDomain:
+		var length [1]byte
+		if _, err := io.ReadFull(h.conn, length[:]); err != nil {
+			return nil, err
+		}
+		var buff = make([]byte, length[0])
+		if _, err := io.ReadFull(h.conn, buff); err != nil {
+			return nil, err
+		}
+		name = string(buff)
+	default:
+		h.reply(socksRepBadAddrType, nil)
+		return nil, fmt.Errorf("unsupported SOCKS address type: %d", req[3])
+	}
+
+	var portBuff [2]byte
+	if _, err := io.ReadFull(h.conn, portBuff[:]); err != nil {
+		return nil, err
+	}
+	var port = int(binary.BigEndian.Uint16(portBuff[:]))
+
+	if req[1] != socksCmdConnect {
+		h.reply(socksRepBadCommand, nil)
+		return nil, fmt.Errorf("unsupported SOCKS command: %d", req[1])
+	}
+
+	upstream, code, err := h.dial(name, ip, port)
+	if err != nil {
+		h.reply(code, nil)
+		return nil, err
+	}
+	if err = h.reply(socksRepSuccess, upstream.LocalAddr()); err != nil {
+		upstream.Close()
+		return nil, err
+	}
+
+	return upstream, nil
+}
+
+// dial -- connects to the first of the destination's IP addresses the allow-list permits
+//
+// returns the SOCKS reply code to send on error
+func (h *SOCKSHandler) dial(name string, ip net.IP, port int) (net.Conn, byte, error) {
+	var dest = net.JoinHostPort(name, strconv.Itoa(port))
+	var ips = []net.IP{ip}
+	if name != "" {
+		var err error
+		if ips, err = net.LookupIP(name); err != nil {
+			return nil, socksRepUnreachable, fmt.Errorf("failed to resolve '%s': %s", name, err.Error())
+		}
+	} else {
+		dest = net.JoinHostPort(ip.String(), strconv.Itoa(port))
+	}
+
+	var allowed = false
+	var err error
+	for _, addr := range ips {
+		if !h.isAllowed(strings.ToLower(name), addr, port) {
+			continue
+		}
+		allowed = true
+
+		var conn net.Conn
+		if conn, err = net.DialTimeout("tcp", net.JoinHostPort(addr.String(), strconv.Itoa(port)), socksDialTimeout); err == nil {
+			logrus.Infof("SOCKSHandler: connected to %s (%s)", dest, conn.RemoteAddr())
+			return conn, socksRepSuccess, nil
+		}
+	}
+
+	if !allowed {
+		return nil, socksRepNotAllowed, fmt.Errorf("destination not allowed: '%s'", dest)
+	}
+	var code byte = socksRepUnreachable
+	if opErr, ok := err.(*net.OpError); ok && strings.Contains(opErr.Err.Error(), "refused") {
+		code = socksRepRefused
+	}
+	return nil, code, fmt.Errorf("failed to connect to '%s': %s", dest, err.Error())
+}
+
+// isAllowed -- returns true if one of the rules matches the given destination
+func (h *SOCKSHandler) isAllowed(name string, ip net.IP, port int) bool {
+	for _, r := range h.rules {
+		if r.matches(name, ip, port) {
+			return true
+		}
+	}
+	return false
+}
+
+// reply -- sends a SOCKS reply (addr is the address we're connecting from, may be nil)
+func (h *SOCKSHandler) reply(code byte, addr net.Addr) error {
+	var ip = net.IPv4zero.To4()
+	var port = 0
+	if tcpAddr, ok := addr.(*net.TCPAddr); ok {
+		ip, port = tcpAddr.IP, tcpAddr.Port
+	}
+
+	var msg = []byte{socksVersion, code, 0, socksAtypIPv4}
+	if ip4 := ip.To4(); ip4 != nil {
+		msg = append(msg, ip4...)
+	} else {
+		msg[3] = socksAtypIPv6
+		msg = append(msg, ip.To16()...)
+	}
+	msg = append(msg, byte(port>>8), byte(port))
+
+	_, err := h.conn.Write(msg)
+	return err
+}
+
+func (h *SOCKSHandler) self() *ProtocolHandlerBase {
+	return &h.ProtocolHandlerBase
+}
+
+// socksRule -- allow-list entry of a SOCKSHandler
+type socksRule struct {
+	ipNet *net.IPNet // nil for host name patterns
+	host  string     // '*', a host name or a '*.domain' wildcard (lower case)
+	port  int        // 0 means any port
+}
+
+// parseSOCKSRule -- parses '<dest>[:<port>]' where dest is '*', an IP address, a CIDR range, a host name
+// or a wildcard like '*.lan' (IPv6 addresses with a port need brackets, e.g. '[fd00::1]:80')
+//
+// Host names are matched against the name the client asked for, IPs and ranges against the resolved address
+func parseSOCKSRule(value string) (socksRule, error) {
+	var rc socksRule
+	var host = value
+	if h, port, err := net.SplitHostPort(value); err == nil {
+		if rc.port, err = strconv.Atoi(port); err != nil || rc.port < 1 || rc.port > 65535 {
+			return rc, fmt.Errorf("malformed port in allow-list entry: '%s'", value)
+		}
+		host = h
+	}
+
+	if host == "" || strings.ContainsAny(host, " \t") {
+		return rc, fmt.Errorf("malformed allow-list entry: '%s'", value)
+	}
+
+	if strings.Contains(host, "/") || net.ParseIP(host) != nil {
+		var err error
+		if rc.ipNet, err = parseIPRange(host); err != nil {
+			return rc, err
+		}
+		return rc, nil
+	}
+
+	if strings.Contains(host, "*") && host != "*" && (!strings.HasPrefix(host, "*.") || strings.Count(host, "*") > 1) {
+		return rc, fmt.Errorf("malformed wildcard in allow-list entry (expected '*.domain'): '%s'", value)
+	}
+	rc.host = strings.ToLower(host)
+	return rc, nil
+}
+
+// matches -- returns true if the rule allows connecting to ip:port (name is the host name the client asked for, if any)
+func (r socksRule) matches(name string, ip net.IP, port int) bool {
+	if r.port != 0 && r.port != port {
+		return false
+	}
+
+	if r.ipNet != nil {
+		return r.ipNet.Contains(ip)
+	} else if r.host == "*" {
+		return true
+	} else if name == "" {
+		return false
+	} else if strings.HasPrefix(r.host, "*.") {
+		return strings.HasSuffix(name, r.host[1:])
+	}
+	return name == r.host
+}
@@ -0,0 +1,87 @@
+package service
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSOCKSRules(t *testing.T) {
+	var h, err = NewSOCKSHandler("192.168.1.0/24, *.lan:80,printer, [fd00::1]:22")
+	assert.NoError(t, err)
+	var s = h.(*SOCKSHandler)
+
+	assert.True(t, s.isAllowed("", net.ParseIP("192.168.1.10"), 22))
+	assert.False(t, s.isAllowed("", net.ParseIP("192.168.2.10"), 22))
+	assert.True(t, s.isAllowed("nas.lan", net.ParseIP("10.0.0.1"), 80))
+	assert.False(t, s.isAllowed("nas.lan", net.ParseIP("10.0.0.1"), 443))
+	assert.False(t, s.isAllowed("lan", net.ParseIP("10.0.0.1"), 80))
+	assert.True(t, s.isAllowed("printer", net.ParseIP("10.0.0.2"), 631))
+	assert.False(t, s.isAllowed("", net.ParseIP("10.0.0.2"), 631))
+	assert.True(t, s.isAllowed("", net.ParseIP("fd00::1"), 22))
+	assert.False(t, s.isAllowed("", net.ParseIP("fd00::1"), 80))
+
+	h, err = NewSOCKSHandler("*")
+	assert.NoError(t, err)
+	assert.True(t, h.(*SOCKSHandler).isAllowed("", net.ParseIP("8.8.8.8"), 53))
+
+	for _, allow := range []string{"", " , ", "10.0.0.0/33", "host:99999", "foo*.lan", "*.*.lan"} {
+		_, err = NewSOCKSHandler(allow)
+		assert.Error(t, err, allow)
+	}
+}
+
+func TestSOCKSHandler(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer l.Close()
+
+	// echoes whatever it receives (until the client half-closes the connection)
+	go func() {
+		var conn, err = l.Accept()
+		if err != nil {
+			return
+		}
+		var data, _ = ioutil.ReadAll(conn)
+		conn.Write(data)
+		conn.Close()
+	}()
+
+	var h, _ = NewSOCKSHandler("127.0.0.1")
+	var endpoint = newTestEndpoint()
+	h.self().tunnel = endpoint
+	assert.NoError(t, h.connect())
+	go h.receive()
+
+	var port = make([]byte, 2)
+	binary.BigEndian.PutUint16(port, uint16(l.Addr().(*net.TCPAddr).Port))
+	h.onData([]byte{5, 1, 0})                                   // greeting
+	h.onData(append([]byte{5, 1, 0, 1, 127, 0, 0, 1}, port...)) // CONNECT 127.0.0.1
+	h.onData([]byte("hello"))
+	h.onEOF()
+
+	<-endpoint.closed
+	var data = endpoint.data.Bytes()
+	if assert.Len(t, data, 2+10+5) {
+		assert.Equal(t, []byte{5, 0}, data[:2])
+		assert.Equal(t, []byte{5, 0, 0, 1, 127, 0, 0, 1}, data[2:10])
+		assert.Equal(t, "hello", string(data[12:]))
+	}
+	assert.True(t, endpoint.eof)
+
+	// destinations that aren't allowed
+	h, _ = NewSOCKSHandler("10.0.0.0/8")
+	endpoint = newTestEndpoint()
+	h.self().tunnel = endpoint
+	assert.NoError(t, h.connect())
+	go h.receive()
+
+	h.onData([]byte{5, 1, 0})
+	h.onData(append([]byte{5, 1, 0, 1, 127, 0, 0, 1}, port...))
+
+	<-endpoint.closed
+	assert.Equal(t, []byte{5, 0, 5, socksRepNotAllowed}, endpoint.data.Bytes()[:4])
+}
@@ -0,0 +1,206 @@
+package sshd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// directTCPIPMsg -- payload of 'direct-tcpip' channel requests (RFC 4254, section 7.2)
+type directTCPIPMsg struct {
+	DestAddr string
+	DestPort uint32
+	OrigAddr string
+	OrigPort uint32
+}
+
+// tcpipForwardMsg -- payload of 'tcpip-forward' and 'cancel-tcpip-forward' requests (RFC 4254, section 7.1)
+type tcpipForwardMsg struct {
+	BindAddr string
+	BindPort uint32
+}
+
+// forwardedTCPIPMsg -- payload of the 'forwarded-tcpip' channels we open for remote forwards
+type forwardedTCPIPMsg struct {
+	Addr       string
+	Port       uint32
+	OriginAddr string
+	OriginPort uint32
+}
+
+// handleDirectTCPIP -- local port forwarding (ssh -L)
+func handleDirectTCPIP(newChannel ssh.NewChannel) {
+	var msg directTCPIPMsg
+	if err := ssh.Unmarshal(newChannel.ExtraData(), &msg); err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, "malformed direct-tcpip request")
+		return
+	}
+
+	var addr = net.JoinHostPort(msg.DestAddr, strconv.Itoa(int(msg.DestPort)))
+	logrus.Debugf("sshd: forwarding connection to %s", addr)
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		newChannel.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	_proxy(channel, conn)
+}
+
+// remoteForwards -- keeps track of a connection's remote port forwards (ssh -R)
+type remoteForwards struct {
+	conn *ssh.ServerConn
+
+	lock      sync.Mutex
+	listeners map[string]net.Listener
+}
+
+func newRemoteForwards(conn *ssh.ServerConn) *remoteForwards {
+	return &remoteForwards{
+		conn:      conn,
+		listeners: make(map[string]net.Listener),
+	}
+}
+
+// handleRequests -- handles the connection's global requests
+func (f *remoteForwards) handleRequests(reqs <-chan *ssh.Request) {
+	for req := range reqs {
+		switch req.Type {
+		case "tcpip-forward":
+			var msg tcpipForwardMsg
+			if err := ssh.Unmarshal(req.Payload, &msg); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			if port, err := f.listen(msg); err != nil {
+				logrus.WithError(err).Error("sshd: remote forwarding failed")
+				req.Reply(false, nil)
+			} else if msg.BindPort == 0 {
+				req.Reply(true, ssh.Marshal(struct{ Port uint32 }{port}))
+			} else {
+				req.Reply(true, nil)
+			}
+		case "cancel-tcpip-forward":
+			var msg tcpipForwardMsg
+			if err := ssh.Unmarshal(req.Payload, &msg); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(f.close(msg), nil)
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+// listen -- starts listening on the given address (returns the port we're listening on)
+func (f *remoteForwards) listen(msg tcpipForwardMsg) (uint32, error) {
+	var l, err = net.Listen("tcp", net.JoinHostPort(msg.BindAddr, strconv.Itoa(int(msg.BindPort))))
+	if err != nil {
+		return 0, err
+	}
+	var port = uint32(l.Addr().(*net.TCPAddr).Port)
+
+	f.lock.Lock()
+	f.listeners[_forwardKey(msg.BindAddr, port)] = l
+	f.lock.Unlock()
+
+	logrus.Debugf("sshd: forwarding connections to %s", l.Addr())
+	go func() {
+		for {
+			var conn, err = l.Accept()
+			if err != nil {
+				return // listener closed
+			}
+			go f.forward(conn, msg.BindAddr, port)
+		}
+	}()
+	return port, nil
+}
+
+// forward -- opens a 'forwarded-tcpip' channel for an incoming connection
+func (f *remoteForwards) forward(conn net.Conn, bindAddr string, port uint32) {
+	var origin = conn.RemoteAddr().(*net.TCPAddr)
+	var payload = ssh.Marshal(forwardedTCPIPMsg{
+		Addr:       bindAddr,
+		Port:       port,
+		OriginAddr: origin.IP.String(),
+		OriginPort: uint32(origin.Port),
+	})
+
+	channel, reqs, err := f.conn.OpenChannel("forwarded-tcpip", payload)
+	if err != nil {
+		logrus.WithError(err).Debug("sshd: client rejected forwarded connection")
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	_proxy(channel, conn)
+}
+
+// close -- stops listening for the given forward (returns false if there's no such forward)
+func (f *remoteForwards) close(msg tcpipForwardMsg) bool {
+	var key = _forwardKey(msg.BindAddr, msg.BindPort)
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if l, ok := f.listeners[key]; ok {
+		l.Close()
+		delete(f.listeners, key)
+		return true
+	}
+	return false
+}
+
+// closeAll -- stops all the remote forwards (called once the connection's closed)
+func (f *remoteForwards) closeAll() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for key, l := range f.listeners {
+		l.Close()
+		delete(f.listeners, key)
+	}
+}
+
+func _forwardKey(addr string, port uint32) string {
+	return fmt.Sprintf("%s:%d", addr, port)
+}
+
+// _proxy -- copies data between channel and conn (in both directions, propagating EOFs), then closes both
+func _proxy(channel ssh.Channel, conn net.Conn) {
+	var done = make(chan struct{})
+	go func() {
+		io.Copy(conn, channel)
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+		close(done)
+	}()
+
+	if _, err := io.Copy(channel, conn); err != nil {
+		// connection error (not just EOF) -> don't wait for the client
+		channel.Close()
+		conn.Close()
+	} else {
+		channel.CloseWrite()
+	}
+	<-done
+
+	channel.Close()
+	conn.Close()
+}
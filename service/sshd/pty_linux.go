@@ -0,0 +1,38 @@
+//go:build linux
+// +build linux
+
+package sshd
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPty -- allocates a new pseudo terminal (returns its master and slave ends)
+func openPty() (ptmx *os.File, tty *os.File, err error) {
+	if ptmx, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0); err != nil {
+		return nil, nil, err
+	}
+
+	var fd = int(ptmx.Fd())
+	var n uint32
+	if err = unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err == nil {
+		n, err = unix.IoctlGetUint32(fd, unix.TIOCGPTN)
+	}
+	if err == nil {
+		tty, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	}
+	if err != nil {
+		ptmx.Close()
+		return nil, nil, err
+	}
+	return ptmx, tty, nil
+}
+
+// setWinsize -- updates the terminal's size
+func setWinsize(f *os.File, cols uint32, rows uint32) error {
+	return unix.IoctlSetWinsize(int(f.Fd()), unix.TIOCSWINSZ, &unix.Winsize{Col: uint16(cols), Row: uint16(rows)})
+}
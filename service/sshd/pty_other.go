@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package sshd
+
+import (
+	"errors"
+	"os"
+)
+
+var errPtyUnsupported = errors.New("PTYs aren't supported on this platform")
+
+// openPty -- not supported on this platform
+func openPty() (ptmx *os.File, tty *os.File, err error) {
+	return nil, nil, errPtyUnsupported
+}
+
+// setWinsize -- not supported on this platform
+func setWinsize(f *os.File, cols uint32, rows uint32) error {
+	return errPtyUnsupported
+}
@@ -0,0 +1,134 @@
+// Package sshd -- minimal SSH server, used by the 'ssh' service if it's been set up with 'builtin=true'
+//
+// Supports shells (with or without PTY), exec requests, the 'sftp' subsystem as well as local and remote
+// port forwarding. All sessions run as the user running 'ondevice daemon' (regardless of the login name the
+// client specifies), clients are authenticated using an authorized_keys file.
+package sshd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// Server -- SSH server configuration
+type Server struct {
+	// HostKeyPath -- the server's private key (PEM encoded), will be generated if it doesn't exist
+	HostKeyPath string
+	// AuthorizedKeysPath -- the public keys allowed to log in (OpenSSH authorized_keys format, re-read for each connection)
+	AuthorizedKeysPath string
+	// Shell -- the shell used for interactive sessions and exec requests (defaults to $SHELL or /bin/sh)
+	Shell string
+}
+
+// hostKeyLock -- prevents concurrent connections from generating more than one host key
+var hostKeyLock sync.Mutex
+
+// ServeConn -- runs the SSH protocol over the given connection (blocks until it's closed)
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+
+	var hostKey, err = s.loadHostKey()
+	if err != nil {
+		return err
+	}
+
+	var cfg = ssh.ServerConfig{
+		PublicKeyCallback: s.checkPublicKey,
+	}
+	cfg.AddHostKey(hostKey)
+
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, &cfg)
+	if err != nil {
+		return fmt.Errorf("SSH handshake failed: %s", err.Error())
+	}
+	defer sconn.Close()
+	logrus.Infof("sshd: '%s' logged in (key: %s)", sconn.User(), sconn.Permissions.Extensions["pubkey-fp"])
+
+	var forwards = newRemoteForwards(sconn)
+	defer forwards.closeAll()
+	go forwards.handleRequests(reqs)
+
+	for newChannel := range chans {
+		switch newChannel.ChannelType() {
+		case "session":
+			go s.handleSession(newChannel)
+		case "direct-tcpip":
+			go handleDirectTCPIP(newChannel)
+		default:
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type: "+newChannel.ChannelType())
+		}
+	}
+
+	return nil
+}
+
+// checkPublicKey -- accepts the keys listed in AuthorizedKeysPath
+func (s *Server) checkPublicKey(meta ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+	var data, err = ioutil.ReadFile(s.AuthorizedKeysPath)
+	if err != nil {
+		logrus.WithError(err).Error("sshd: failed to read authorized_keys")
+		return nil, fmt.Errorf("failed to read authorized_keys")
+	}
+
+	var wanted = key.Marshal()
+	for len(data) > 0 {
+		var authorizedKey ssh.PublicKey
+		if authorizedKey, _, _, data, err = ssh.ParseAuthorizedKey(data); err != nil {
+			break // no more (valid) keys
+		}
+		if bytes.Equal(authorizedKey.Marshal(), wanted) {
+			return &ssh.Permissions{
+				Extensions: map[string]string{"pubkey-fp": ssh.FingerprintSHA256(key)},
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown public key for '%s'", meta.User())
+}
+
+// loadHostKey -- reads the host key (and generates it if it doesn't exist yet)
+func (s *Server) loadHostKey() (ssh.Signer, error) {
+	hostKeyLock.Lock()
+	defer hostKeyLock.Unlock()
+
+	var data, err = ioutil.ReadFile(s.HostKeyPath)
+	if os.IsNotExist(err) {
+		logrus.Info("sshd: generating host key: ", s.HostKeyPath)
+		if data, err = generateHostKey(); err == nil {
+			os.MkdirAll(filepath.Dir(s.HostKeyPath), 0700)
+			err = ioutil.WriteFile(s.HostKeyPath, data, 0600)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load host key: %s", err.Error())
+	}
+
+	return ssh.ParsePrivateKey(data)
+}
+
+// generateHostKey -- returns a new PEM encoded ECDSA (P-256) private key
+func generateHostKey() ([]byte, error) {
+	var key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
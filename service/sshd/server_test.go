@@ -0,0 +1,256 @@
+package sshd
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
+)
+
+// testServer -- starts an SSH server on a random local port (returns its address and a client key that's allowed to log in)
+func testServer(t *testing.T, dir string) (string, ssh.Signer) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	signer, err := ssh.NewSignerFromKey(key)
+	assert.NoError(t, err)
+
+	var authorizedKeys = filepath.Join(dir, "authorized_keys")
+	assert.NoError(t, ioutil.WriteFile(authorizedKeys, ssh.MarshalAuthorizedKey(signer.PublicKey()), 0600))
+
+	var server = Server{
+		HostKeyPath:        filepath.Join(dir, "ssh_host_key"),
+		AuthorizedKeysPath: authorizedKeys,
+		Shell:              "/bin/sh",
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() {
+		for {
+			var conn, err = l.Accept()
+			if err != nil {
+				return
+			}
+			go server.ServeConn(conn)
+		}
+	}()
+
+	return l.Addr().String(), signer
+}
+
+func testClient(t *testing.T, addr string, signer ssh.Signer) (*ssh.Client, error) {
+	return ssh.Dial("tcp", addr, &ssh.ClientConfig{
+		User:            "demo",
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+}
+
+func TestServer(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "ondevice-sshd")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var addr, signer = testServer(t, dir)
+
+	// unknown keys are rejected
+	_, otherKey, _ := ed25519.GenerateKey(rand.Reader)
+	otherSigner, _ := ssh.NewSignerFromKey(otherKey)
+	_, err = testClient(t, addr, otherSigner)
+	assert.Error(t, err)
+
+	client, err := testClient(t, addr, signer)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer client.Close()
+
+	// the host key's been generated
+	_, err = os.Stat(filepath.Join(dir, "ssh_host_key"))
+	assert.NoError(t, err)
+
+	// exec (with stdin and exit status)
+	session, err := client.NewSession()
+	assert.NoError(t, err)
+	session.Stdin = bytes.NewBufferString("world\n")
+	output, err := session.Output("read name; echo hello $name; exit 3")
+	assert.Equal(t, "hello world\n", string(output))
+	if exitErr, ok := err.(*ssh.ExitError); assert.True(t, ok) {
+		assert.Equal(t, 3, exitErr.ExitStatus())
+	}
+
+	// PTY
+	if runtime.GOOS == "linux" {
+		session, err = client.NewSession()
+		assert.NoError(t, err)
+		assert.NoError(t, session.RequestPty("xterm", 24, 80, ssh.TerminalModes{}))
+		output, err = session.Output("test -t 0 && echo $TERM")
+		assert.NoError(t, err)
+		assert.Equal(t, "xterm", string(bytes.TrimSpace(output)))
+	}
+
+	// local port forwarding
+	echoListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer echoListener.Close()
+	go func() {
+		if conn, err := echoListener.Accept(); err == nil {
+			io.Copy(conn, conn)
+			conn.Close()
+		}
+	}()
+
+	conn, err := client.Dial("tcp", echoListener.Addr().String())
+	if assert.NoError(t, err) {
+		conn.Write([]byte("ping"))
+		var buff = make([]byte, 4)
+		_, err = io.ReadFull(conn, buff)
+		assert.NoError(t, err)
+		assert.Equal(t, "ping", string(buff))
+		conn.Close()
+	}
+
+	// remote port forwarding
+	remoteListener, err := client.Listen("tcp", "127.0.0.1:0")
+	if assert.NoError(t, err) {
+		go func() {
+			if conn, err := net.Dial("tcp", remoteListener.Addr().String()); err == nil {
+				conn.Write([]byte("pong"))
+				conn.Close()
+			}
+		}()
+
+		conn, err := remoteListener.Accept()
+		assert.NoError(t, err)
+		data, err := ioutil.ReadAll(conn)
+		assert.NoError(t, err)
+		assert.Equal(t, "pong", string(data))
+		remoteListener.Close()
+	}
+}
+
+func TestSFTP(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "ondevice-sftp")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var addr, signer = testServer(t, dir)
+	client, err := testClient(t, addr, signer)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer client.Close()
+
+	session, err := client.NewSession()
+	assert.NoError(t, err)
+	stdin, _ := session.StdinPipe()
+	stdout, _ := session.StdoutPipe()
+	assert.NoError(t, session.RequestSubsystem("sftp"))
+
+	var c = testSFTPClient{t: t, w: stdin, r: stdout}
+
+	// handshake
+	var typ, resp = c.request(newSFTPWriter(sftpInit).uint32(3))
+	assert.Equal(t, byte(sftpVersion), typ)
+	assert.Equal(t, uint32(3), resp.uint32())
+
+	// write a file
+	var path = filepath.Join(dir, "hello.txt")
+	typ, resp = c.request(newSFTPWriter(sftpOpen).uint32(1).string(path).uint32(sftpFlagWrite | sftpFlagCreat | sftpFlagTrunc).uint32(0))
+	assert.Equal(t, byte(sftpHandle), typ)
+	assert.Equal(t, uint32(1), resp.uint32())
+	var handle = resp.string()
+
+	c.expectStatus(sftpOK, newSFTPWriter(sftpWrite).uint32(2).string(handle).uint64(0).string("hello world"))
+	c.expectStatus(sftpOK, newSFTPWriter(sftpClose).uint32(3).string(handle))
+
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello world", string(data))
+
+	// stat
+	typ, resp = c.request(newSFTPWriter(sftpStat).uint32(4).string(path))
+	assert.Equal(t, byte(sftpAttrs), typ)
+	resp.uint32() // id
+	var attrs = resp.attrs()
+	assert.Equal(t, uint64(11), attrs.size)
+	assert.Equal(t, uint32(syscall.S_IFREG), attrs.permissions&syscall.S_IFMT)
+
+	// read it back (and hit EOF)
+	typ, resp = c.request(newSFTPWriter(sftpOpen).uint32(5).string(path).uint32(sftpFlagRead).uint32(0))
+	assert.Equal(t, byte(sftpHandle), typ)
+	resp.uint32()
+	handle = resp.string()
+
+	typ, resp = c.request(newSFTPWriter(sftpRead).uint32(6).string(handle).uint64(6).uint32(100))
+	assert.Equal(t, byte(sftpData), typ)
+	resp.uint32()
+	assert.Equal(t, "world", resp.string())
+	c.expectStatus(sftpEOF, newSFTPWriter(sftpRead).uint32(7).string(handle).uint64(11).uint32(100))
+	c.expectStatus(sftpOK, newSFTPWriter(sftpClose).uint32(8).string(handle))
+
+	// list the directory
+	typ, resp = c.request(newSFTPWriter(sftpOpendir).uint32(9).string(dir))
+	assert.Equal(t, byte(sftpHandle), typ)
+	resp.uint32()
+	handle = resp.string()
+
+	typ, resp = c.request(newSFTPWriter(sftpReaddir).uint32(10).string(handle))
+	assert.Equal(t, byte(sftpName), typ)
+	resp.uint32()
+	var names []string
+	for count := resp.uint32(); count > 0; count-- {
+		names = append(names, resp.string())
+		resp.string() // longname
+		resp.attrs()
+	}
+	assert.Contains(t, names, "hello.txt")
+	c.expectStatus(sftpEOF, newSFTPWriter(sftpReaddir).uint32(11).string(handle))
+
+	// errors
+	c.expectStatus(sftpNoSuchFile, newSFTPWriter(sftpStat).uint32(12).string(filepath.Join(dir, "missing")))
+	c.expectStatus(sftpOK, newSFTPWriter(sftpRemove).uint32(13).string(path))
+	c.expectStatus(sftpNoSuchFile, newSFTPWriter(sftpRemove).uint32(14).string(path))
+	c.expectStatus(sftpBadMessage, newSFTPWriter(sftpClose).uint32(15).string("invalid handle"))
+}
+
+// testSFTPClient -- sends raw SFTP requests
+type testSFTPClient struct {
+	t *testing.T
+	w io.Writer
+	r io.Reader
+}
+
+func (c testSFTPClient) request(w *sftpWriter) (byte, *sftpReader) {
+	binary.BigEndian.PutUint32(w.data, uint32(len(w.data)-4))
+	_, err := c.w.Write(w.data)
+	assert.NoError(c.t, err)
+
+	var header [4]byte
+	_, err = io.ReadFull(c.r, header[:])
+	assert.NoError(c.t, err)
+	var data = make([]byte, binary.BigEndian.Uint32(header[:]))
+	_, err = io.ReadFull(c.r, data)
+	assert.NoError(c.t, err)
+
+	var r = sftpReader{data: data}
+	return r.byte(), &r
+}
+
+func (c testSFTPClient) expectStatus(code uint32, w *sftpWriter) {
+	var typ, resp = c.request(w)
+	assert.Equal(c.t, byte(sftpStatus), typ)
+	resp.uint32() // id
+	assert.Equal(c.t, code, resp.uint32(), resp.string())
+}
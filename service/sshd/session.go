@@ -0,0 +1,284 @@
+package sshd
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh"
+)
+
+// request payloads (RFC 4254, section 6)
+type ptyRequestMsg struct {
+	Term    string
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+	Modes   string
+}
+
+type windowChangeMsg struct {
+	Columns uint32
+	Rows    uint32
+	Width   uint32
+	Height  uint32
+}
+
+type envMsg struct {
+	Name  string
+	Value string
+}
+
+type execMsg struct {
+	Command string
+}
+
+type subsystemMsg struct {
+	Name string
+}
+
+type signalMsg struct {
+	Signal string
+}
+
+type exitStatusMsg struct {
+	Status uint32
+}
+
+type exitSignalMsg struct {
+	Signal     string
+	CoreDumped bool
+	Error      string
+	Lang       string
+}
+
+// signals -- the signal names defined in RFC 4254, section 6.10
+var signals = map[string]syscall.Signal{
+	"ABRT": syscall.SIGABRT,
+	"ALRM": syscall.SIGALRM,
+	"FPE":  syscall.SIGFPE,
+	"HUP":  syscall.SIGHUP,
+	"ILL":  syscall.SIGILL,
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"PIPE": syscall.SIGPIPE,
+	"QUIT": syscall.SIGQUIT,
+	"SEGV": syscall.SIGSEGV,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// session -- a 'session' channel (running at most one shell, command or subsystem)
+type session struct {
+	server  *Server
+	channel ssh.Channel
+	env     []string
+	started bool
+
+	term      string
+	ptmx, tty *os.File
+	cmd       *exec.Cmd
+}
+
+func (s *Server) handleSession(newChannel ssh.NewChannel) {
+	channel, reqs, err := newChannel.Accept()
+	if err != nil {
+		logrus.WithError(err).Error("sshd: failed to accept session")
+		return
+	}
+
+	var sess = session{server: s, channel: channel}
+	for req := range reqs {
+		var ok, then = sess.handleRequest(req)
+		if req.WantReply {
+			req.Reply(ok, nil)
+		}
+		if then != nil {
+			go then()
+		}
+	}
+
+	// the client's gone -> don't leave anything running
+	if sess.cmd != nil && sess.cmd.Process != nil {
+		sess.cmd.Process.Kill()
+	}
+	if sess.tty != nil {
+		sess.tty.Close()
+	}
+	if sess.ptmx != nil && sess.cmd == nil {
+		sess.ptmx.Close() // allocated, but never used
+	}
+}
+
+// handleRequest -- handles a session request
+//
+// returns whether it succeeded and (optionally) a function to run asynchronously after replying to it
+func (sess *session) handleRequest(req *ssh.Request) (bool, func()) {
+	switch req.Type {
+	case "pty-req":
+		var msg ptyRequestMsg
+		if ssh.Unmarshal(req.Payload, &msg) != nil || sess.started || sess.ptmx != nil {
+			return false, nil
+		}
+		var err error
+		if sess.ptmx, sess.tty, err = openPty(); err != nil {
+			logrus.WithError(err).Error("sshd: failed to allocate PTY")
+			return false, nil
+		}
+		sess.term = msg.Term
+		setWinsize(sess.ptmx, msg.Columns, msg.Rows)
+		return true, nil
+	case "window-change":
+		var msg windowChangeMsg
+		if ssh.Unmarshal(req.Payload, &msg) != nil || sess.ptmx == nil {
+			return false, nil
+		}
+		return setWinsize(sess.ptmx, msg.Columns, msg.Rows) == nil, nil
+	case "env":
+		var msg envMsg
+		if ssh.Unmarshal(req.Payload, &msg) != nil {
+			return false, nil
+		}
+		sess.env = append(sess.env, msg.Name+"="+msg.Value)
+		return true, nil
+	case "shell":
+		return sess.start(nil)
+	case "exec":
+		var msg execMsg
+		if ssh.Unmarshal(req.Payload, &msg) != nil {
+			return false, nil
+		}
+		return sess.start([]string{"-c", msg.Command})
+	case "subsystem":
+		var msg subsystemMsg
+		if ssh.Unmarshal(req.Payload, &msg) != nil || msg.Name != "sftp" || sess.started {
+			return false, nil
+		}
+		sess.started = true
+		return true, func() {
+			var status uint32
+			if err := serveSFTP(sess.channel); err != nil {
+				logrus.WithError(err).Error("sshd: SFTP error")
+				status = 1
+			}
+			sess.channel.SendRequest("exit-status", false, ssh.Marshal(exitStatusMsg{status}))
+			sess.channel.Close()
+		}
+	case "signal":
+		var msg signalMsg
+		if ssh.Unmarshal(req.Payload, &msg) != nil || sess.cmd == nil {
+			return false, nil
+		}
+		var sig, ok = signals[msg.Signal]
+		return ok && sess.cmd.Process.Signal(sig) == nil, nil
+	}
+
+	logrus.Debugf("sshd: unsupported session request: '%s'", req.Type)
+	return false, nil
+}
+
+// start -- runs the shell (with the given arguments)
+func (sess *session) start(args []string) (bool, func()) {
+	if sess.started {
+		return false, nil
+	}
+	sess.started = true
+
+	var cmd = exec.Command(sess.server.shell(), args...)
+	cmd.Env = append(os.Environ(), sess.env...)
+	if home, err := os.UserHomeDir(); err == nil {
+		cmd.Dir = home
+	}
+
+	var copyInput func()
+	if sess.ptmx != nil {
+		cmd.Env = append(cmd.Env, "TERM="+sess.term)
+		cmd.Stdin, cmd.Stdout, cmd.Stderr = sess.tty, sess.tty, sess.tty
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+		copyInput = func() { io.Copy(sess.ptmx, sess.channel) }
+	} else {
+		var stdin, err = cmd.StdinPipe()
+		if err != nil {
+			logrus.WithError(err).Error("sshd: failed to create stdin pipe")
+			return false, nil
+		}
+		cmd.Stdout, cmd.Stderr = sess.channel, sess.channel.Stderr()
+		copyInput = func() {
+			io.Copy(stdin, sess.channel)
+			stdin.Close()
+		}
+	}
+
+	if err := cmd.Start(); err != nil {
+		logrus.WithError(err).Error("sshd: failed to start shell")
+		return false, nil
+	}
+	sess.cmd = cmd
+	if sess.tty != nil {
+		// only the child process should hold on to the tty (or we won't notice once it's gone)
+		sess.tty.Close()
+		sess.tty = nil
+	}
+
+	return true, func() {
+		go copyInput()
+
+		var outputDone = make(chan struct{})
+		if sess.ptmx != nil {
+			go func() {
+				io.Copy(sess.channel, sess.ptmx) // returns once every process has closed the tty
+				close(outputDone)
+			}()
+		} else {
+			close(outputDone) // cmd.Wait() waits for the output to be copied
+		}
+
+		var err = cmd.Wait()
+		<-outputDone
+		if sess.ptmx != nil {
+			sess.ptmx.Close()
+		}
+		sess.sendExitStatus(err)
+		sess.channel.Close()
+	}
+}
+
+// sendExitStatus -- tells the client how the shell exited
+func (sess *session) sendExitStatus(err error) {
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			for name, sig := range signals {
+				if sig == status.Signal() {
+					sess.channel.SendRequest("exit-signal", false, ssh.Marshal(exitSignalMsg{
+						Signal:     name,
+						CoreDumped: status.CoreDump(),
+					}))
+					return
+				}
+			}
+		}
+		sess.channel.SendRequest("exit-status", false, ssh.Marshal(exitStatusMsg{uint32(exitErr.ExitCode() & 0xff)}))
+		return
+	} else if err != nil {
+		logrus.WithError(err).Error("sshd: shell error")
+		sess.channel.SendRequest("exit-status", false, ssh.Marshal(exitStatusMsg{255}))
+		return
+	}
+
+	sess.channel.SendRequest("exit-status", false, ssh.Marshal(exitStatusMsg{0}))
+}
+
+// shell -- returns the shell to use for sessions
+func (s *Server) shell() string {
+	if s.Shell != "" {
+		return s.Shell
+	}
+	if shell := os.Getenv("SHELL"); shell != "" {
+		return shell
+	}
+	return "/bin/sh"
+}
@@ -0,0 +1,647 @@
+package sshd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// SFTP packet types (draft-ietf-secsh-filexfer-02, i.e. SFTP version 3 - the one OpenSSH implements)
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpWrite    = 6
+	sftpLstat    = 7
+	sftpFstat    = 8
+	sftpSetstat  = 9
+	sftpFsetstat = 10
+	sftpOpendir  = 11
+	sftpReaddir  = 12
+	sftpRemove   = 13
+	sftpMkdir    = 14
+	sftpRmdir    = 15
+	sftpRealpath = 16
+	sftpStat     = 17
+	sftpRename   = 18
+	sftpReadlink = 19
+	sftpSymlink  = 20
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpName     = 104
+	sftpAttrs    = 105
+)
+
+// SFTP status codes
+const (
+	sftpOK               = 0
+	sftpEOF              = 1
+	sftpNoSuchFile       = 2
+	sftpPermissionDenied = 3
+	sftpFailure          = 4
+	sftpBadMessage       = 5
+	sftpOpUnsupported    = 8
+)
+
+// SFTP open flags
+const (
+	sftpFlagRead   = 0x01
+	sftpFlagWrite  = 0x02
+	sftpFlagAppend = 0x04
+	sftpFlagCreat  = 0x08
+	sftpFlagTrunc  = 0x10
+	sftpFlagExcl   = 0x20
+)
+
+// SFTP attribute flags
+const (
+	sftpAttrSize        = 0x01
+	sftpAttrUIDGID      = 0x02
+	sftpAttrPermissions = 0x04
+	sftpAttrACModTime   = 0x08
+	sftpAttrExtended    = 0x80000000
+)
+
+const (
+	sftpMaxPacket  = 256 * 1024
+	sftpMaxRead    = 64 * 1024
+	sftpMaxReaddir = 100
+)
+
+var errSFTPBadMessage = errors.New("malformed SFTP packet")
+
+// sftpServer -- serves a single SFTP session (processing one request at a time)
+type sftpServer struct {
+	rw      io.ReadWriter
+	cwd     string // relative paths are resolved relative to this (the user's home directory)
+	handles map[string]*sftpFile
+	nextID  int
+}
+
+// sftpFile -- an open file or directory handle
+type sftpFile struct {
+	file    *os.File
+	append  bool
+	entries []os.FileInfo // (directories only) the entries we haven't sent yet
+	isDir   bool
+}
+
+// serveSFTP -- runs an SFTP server over the given channel (returns once the client's closed it)
+func serveSFTP(rw io.ReadWriter) error {
+	var s = sftpServer{
+		rw:      rw,
+		cwd:     "/",
+		handles: make(map[string]*sftpFile),
+	}
+	if home, err := os.UserHomeDir(); err == nil {
+		s.cwd = home
+	}
+	defer s.closeAll()
+
+	for {
+		var data, err = s.readPacket()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if err = s.handlePacket(&sftpReader{data: data}); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *sftpServer) readPacket() ([]byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(s.rw, header[:]); err != nil {
+		return nil, err
+	}
+
+	var length = binary.BigEndian.Uint32(header[:])
+	if length == 0 || length > sftpMaxPacket {
+		return nil, fmt.Errorf("invalid SFTP packet length: %d", length)
+	}
+
+	var data = make([]byte, length)
+	if _, err := io.ReadFull(s.rw, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+func (s *sftpServer) send(w *sftpWriter) error {
+	var data = w.data
+	binary.BigEndian.PutUint32(data, uint32(len(data)-4))
+	_, err := s.rw.Write(data)
+	return err
+}
+
+// handlePacket -- processes a request (only returns an error if we can't reply to it)
+func (s *sftpServer) handlePacket(r *sftpReader) error {
+	var packetType = r.byte()
+	if packetType == sftpInit {
+		// we don't support any extensions
+		return s.send(newSFTPWriter(sftpVersion).uint32(3))
+	}
+
+	var id = r.uint32()
+	if r.err != nil {
+		return s.sendStatus(id, errSFTPBadMessage)
+	}
+
+	switch packetType {
+	case sftpOpen:
+		var path, flags, attrs = s.path(r.string()), r.uint32(), r.attrs()
+		if r.err != nil {
+			return s.sendStatus(id, r.err)
+		}
+		return s.open(id, path, flags, attrs)
+	case sftpClose:
+		var handle = r.string()
+		var f, err = s.handle(handle)
+		if err == nil {
+			delete(s.handles, handle)
+			err = f.file.Close()
+		}
+		return s.sendStatus(id, err)
+	case sftpRead:
+		var f, err = s.handle(r.string())
+		var offset, length = r.uint64(), r.uint32()
+		if err == nil {
+			err = r.err
+		}
+		if err != nil {
+			return s.sendStatus(id, err)
+		}
+		return s.read(id, f, offset, length)
+	case sftpWrite:
+		var f, err = s.handle(r.string())
+		var offset, data = r.uint64(), r.bytes()
+		if err == nil {
+			err = r.err
+		}
+		if err == nil {
+			if f.append {
+				_, err = f.file.Write(data)
+			} else {
+				_, err = f.file.WriteAt(data, int64(offset))
+			}
+		}
+		return s.sendStatus(id, err)
+	case sftpLstat, sftpStat:
+		var path = s.path(r.string())
+		if r.err != nil {
+			return s.sendStatus(id, r.err)
+		}
+		var fi os.FileInfo
+		var err error
+		if packetType == sftpLstat {
+			fi, err = os.Lstat(path)
+		} else {
+			fi, err = os.Stat(path)
+		}
+		if err != nil {
+			return s.sendStatus(id, err)
+		}
+		return s.send(newSFTPWriter(sftpAttrs).uint32(id).attrs(fi))
+	case sftpFstat:
+		var f, err = s.handle(r.string())
+		var fi os.FileInfo
+		if err == nil {
+			fi, err = f.file.Stat()
+		}
+		if err != nil {
+			return s.sendStatus(id, err)
+		}
+		return s.send(newSFTPWriter(sftpAttrs).uint32(id).attrs(fi))
+	case sftpSetstat:
+		var path, attrs = s.path(r.string()), r.attrs()
+		if r.err != nil {
+			return s.sendStatus(id, r.err)
+		}
+		return s.sendStatus(id, attrs.apply(path))
+	case sftpFsetstat:
+		var f, err = s.handle(r.string())
+		var attrs = r.attrs()
+		if err == nil {
+			err = r.err
+		}
+		if err == nil {
+			err = attrs.apply(f.file.Name())
+		}
+		return s.sendStatus(id, err)
+	case sftpOpendir:
+		var path = s.path(r.string())
+		if r.err != nil {
+			return s.sendStatus(id, r.err)
+		}
+		return s.opendir(id, path)
+	case sftpReaddir:
+		var f, err = s.handle(r.string())
+		if err == nil && !f.isDir {
+			err = errSFTPBadMessage
+		}
+		if err != nil {
+			return s.sendStatus(id, err)
+		}
+		return s.readdir(id, f)
+	case sftpRemove, sftpRmdir:
+		var path = s.path(r.string())
+		if r.err != nil {
+			return s.sendStatus(id, r.err)
+		}
+		return s.sendStatus(id, os.Remove(path))
+	case sftpMkdir:
+		var path, attrs = s.path(r.string()), r.attrs()
+		if r.err != nil {
+			return s.sendStatus(id, r.err)
+		}
+		var perm = os.FileMode(0755)
+		if attrs.flags&sftpAttrPermissions != 0 {
+			perm = _sftpToFileMode(attrs.permissions)
+		}
+		return s.sendStatus(id, os.Mkdir(path, perm))
+	case sftpRealpath:
+		var path = s.path(r.string())
+		if r.err != nil {
+			return s.sendStatus(id, r.err)
+		}
+		return s.send(newSFTPWriter(sftpName).uint32(id).uint32(1).string(path).string(path).uint32(0))
+	case sftpRename:
+		var from, to = s.path(r.string()), s.path(r.string())
+		if r.err != nil {
+			return s.sendStatus(id, r.err)
+		}
+		return s.sendStatus(id, os.Rename(from, to))
+	case sftpReadlink:
+		var path = s.path(r.string())
+		if r.err != nil {
+			return s.sendStatus(id, r.err)
+		}
+		var target, err = os.Readlink(path)
+		if err != nil {
+			return s.sendStatus(id, err)
+		}
+		return s.send(newSFTPWriter(sftpName).uint32(id).uint32(1).string(target).string(target).uint32(0))
+	case sftpSymlink:
+		// OpenSSH sends the arguments in reverse order (target first, see its PROTOCOL file) -> we do the same
+		var target, link = r.string(), s.path(r.string())
+		if r.err != nil {
+			return s.sendStatus(id, r.err)
+		}
+		return s.sendStatus(id, os.Symlink(target, link))
+	}
+
+	return s.send(newSFTPWriter(sftpStatus).uint32(id).uint32(sftpOpUnsupported).string("unsupported request").string(""))
+}
+
+func (s *sftpServer) open(id uint32, path string, flags uint32, attrs sftpAttributes) error {
+	var osFlags int
+	switch {
+	case flags&sftpFlagRead != 0 && flags&sftpFlagWrite != 0:
+		osFlags = os.O_RDWR
+	case flags&sftpFlagWrite != 0:
+		osFlags = os.O_WRONLY
+	default:
+		osFlags = os.O_RDONLY
+	}
+	if flags&sftpFlagAppend != 0 {
+		osFlags |= os.O_APPEND
+	}
+	if flags&sftpFlagCreat != 0 {
+		osFlags |= os.O_CREATE
+	}
+	if flags&sftpFlagTrunc != 0 {
+		osFlags |= os.O_TRUNC
+	}
+	if flags&sftpFlagExcl != 0 {
+		osFlags |= os.O_EXCL
+	}
+
+	var perm = os.FileMode(0644)
+	if attrs.flags&sftpAttrPermissions != 0 {
+		perm = _sftpToFileMode(attrs.permissions)
+	}
+
+	var f, err = os.OpenFile(path, osFlags, perm)
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+	return s.sendHandle(id, &sftpFile{file: f, append: flags&sftpFlagAppend != 0})
+}
+
+func (s *sftpServer) read(id uint32, f *sftpFile, offset uint64, length uint32) error {
+	if length > sftpMaxRead {
+		length = sftpMaxRead
+	}
+
+	var buff = make([]byte, length)
+	var n, err = f.file.ReadAt(buff, int64(offset))
+	if n == 0 {
+		if err == nil || err == io.EOF {
+			return s.send(newSFTPWriter(sftpStatus).uint32(id).uint32(sftpEOF).string("EOF").string(""))
+		}
+		return s.sendStatus(id, err)
+	}
+	return s.send(newSFTPWriter(sftpData).uint32(id).bytes(buff[:n]))
+}
+
+func (s *sftpServer) opendir(id uint32, path string) error {
+	var f, err = os.Open(path)
+	if err != nil {
+		return s.sendStatus(id, err)
+	}
+
+	entries, err := ioutil.ReadDir(path)
+	if err != nil {
+		f.Close()
+		return s.sendStatus(id, err)
+	}
+	return s.sendHandle(id, &sftpFile{file: f, entries: entries, isDir: true})
+}
+
+func (s *sftpServer) readdir(id uint32, f *sftpFile) error {
+	if len(f.entries) == 0 {
+		return s.send(newSFTPWriter(sftpStatus).uint32(id).uint32(sftpEOF).string("EOF").string(""))
+	}
+
+	var entries = f.entries
+	if len(entries) > sftpMaxReaddir {
+		entries = entries[:sftpMaxReaddir]
+	}
+	f.entries = f.entries[len(entries):]
+
+	var w = newSFTPWriter(sftpName).uint32(id).uint32(uint32(len(entries)))
+	for _, fi := range entries {
+		w.string(fi.Name()).string(_sftpLongName(fi)).attrs(fi)
+	}
+	return s.send(w)
+}
+
+func (s *sftpServer) sendHandle(id uint32, f *sftpFile) error {
+	s.nextID++
+	var handle = strconv.Itoa(s.nextID)
+	s.handles[handle] = f
+	return s.send(newSFTPWriter(sftpHandle).uint32(id).string(handle))
+}
+
+// sendStatus -- sends an SSH_FXP_STATUS response (OK if err is nil)
+func (s *sftpServer) sendStatus(id uint32, err error) error {
+	var code uint32 = sftpOK
+	var msg = "OK"
+	if err != nil {
+		msg = err.Error()
+		switch {
+		case err == errSFTPBadMessage:
+			code = sftpBadMessage
+		case os.IsNotExist(err):
+			code = sftpNoSuchFile
+		case os.IsPermission(err):
+			code = sftpPermissionDenied
+		default:
+			code = sftpFailure
+		}
+	}
+	return s.send(newSFTPWriter(sftpStatus).uint32(id).uint32(code).string(msg).string(""))
+}
+
+func (s *sftpServer) handle(handle string) (*sftpFile, error) {
+	if f, ok := s.handles[handle]; ok {
+		return f, nil
+	}
+	return nil, errSFTPBadMessage
+}
+
+// path -- returns the absolute (cleaned up) version of the given path
+func (s *sftpServer) path(path string) string {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(s.cwd, path)
+	}
+	return filepath.Clean(path)
+}
+
+func (s *sftpServer) closeAll() {
+	for _, f := range s.handles {
+		f.file.Close()
+	}
+}
+
+// sftpAttributes -- file attributes sent by the client (see flags for the ones that are set)
+type sftpAttributes struct {
+	flags        uint32
+	size         uint64
+	uid, gid     uint32
+	permissions  uint32
+	atime, mtime uint32
+}
+
+// apply -- updates the given file's attributes
+func (a sftpAttributes) apply(path string) error {
+	if a.flags&sftpAttrSize != 0 {
+		if err := os.Truncate(path, int64(a.size)); err != nil {
+			return err
+		}
+	}
+	if a.flags&sftpAttrUIDGID != 0 {
+		if err := os.Chown(path, int(a.uid), int(a.gid)); err != nil {
+			return err
+		}
+	}
+	if a.flags&sftpAttrPermissions != 0 {
+		if err := os.Chmod(path, _sftpToFileMode(a.permissions)); err != nil {
+			return err
+		}
+	}
+	if a.flags&sftpAttrACModTime != 0 {
+		if err := os.Chtimes(path, time.Unix(int64(a.atime), 0), time.Unix(int64(a.mtime), 0)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sftpReader -- parses SFTP packets (check err once you're done)
+type sftpReader struct {
+	data []byte
+	err  error
+}
+
+func (r *sftpReader) _next(n int) []byte {
+	if r.err != nil || len(r.data) < n {
+		r.err = errSFTPBadMessage
+		return make([]byte, n)
+	}
+	var rc = r.data[:n]
+	r.data = r.data[n:]
+	return rc
+}
+
+func (r *sftpReader) byte() byte     { return r._next(1)[0] }
+func (r *sftpReader) uint32() uint32 { return binary.BigEndian.Uint32(r._next(4)) }
+func (r *sftpReader) uint64() uint64 { return binary.BigEndian.Uint64(r._next(8)) }
+
+func (r *sftpReader) bytes() []byte {
+	var length = r.uint32()
+	if int(length) > len(r.data) {
+		r.err = errSFTPBadMessage
+		return nil
+	}
+	return r._next(int(length))
+}
+
+func (r *sftpReader) string() string { return string(r.bytes()) }
+
+func (r *sftpReader) attrs() sftpAttributes {
+	var rc = sftpAttributes{flags: r.uint32()}
+	if rc.flags&sftpAttrSize != 0 {
+		rc.size = r.uint64()
+	}
+	if rc.flags&sftpAttrUIDGID != 0 {
+		rc.uid, rc.gid = r.uint32(), r.uint32()
+	}
+	if rc.flags&sftpAttrPermissions != 0 {
+		rc.permissions = r.uint32()
+	}
+	if rc.flags&sftpAttrACModTime != 0 {
+		rc.atime, rc.mtime = r.uint32(), r.uint32()
+	}
+	if rc.flags&sftpAttrExtended != 0 {
+		// we don't support any extended attributes -> skip them
+		for count := r.uint32(); count > 0 && r.err == nil; count-- {
+			r.string()
+			r.string()
+		}
+	}
+	return rc
+}
+
+// sftpWriter -- builds SFTP packets (the length is filled in by sftpServer.send())
+type sftpWriter struct {
+	data []byte
+}
+
+func newSFTPWriter(packetType byte) *sftpWriter {
+	return &sftpWriter{data: []byte{0, 0, 0, 0, packetType}}
+}
+
+func (w *sftpWriter) uint32(v uint32) *sftpWriter {
+	w.data = append(w.data, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	return w
+}
+
+func (w *sftpWriter) uint64(v uint64) *sftpWriter {
+	return w.uint32(uint32(v >> 32)).uint32(uint32(v))
+}
+
+func (w *sftpWriter) bytes(v []byte) *sftpWriter {
+	w.uint32(uint32(len(v)))
+	w.data = append(w.data, v...)
+	return w
+}
+
+func (w *sftpWriter) string(v string) *sftpWriter {
+	return w.bytes([]byte(v))
+}
+
+func (w *sftpWriter) attrs(fi os.FileInfo) *sftpWriter {
+	var uid, gid uint32
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		uid, gid = stat.Uid, stat.Gid
+	}
+	var mtime = uint32(fi.ModTime().Unix())
+
+	return w.uint32(sftpAttrSize | sftpAttrUIDGID | sftpAttrPermissions | sftpAttrACModTime).
+		uint64(uint64(fi.Size())).
+		uint32(uid).uint32(gid).
+		uint32(_sftpFromFileMode(fi.Mode())).
+		uint32(mtime).uint32(mtime)
+}
+
+// _sftpFromFileMode -- converts os.FileMode to the unix st_mode bits SFTP uses
+func _sftpFromFileMode(mode os.FileMode) uint32 {
+	var rc = uint32(mode.Perm())
+	switch {
+	case mode.IsDir():
+		rc |= syscall.S_IFDIR
+	case mode&os.ModeSymlink != 0:
+		rc |= syscall.S_IFLNK
+	case mode&os.ModeNamedPipe != 0:
+		rc |= syscall.S_IFIFO
+	case mode&os.ModeSocket != 0:
+		rc |= syscall.S_IFSOCK
+	case mode&os.ModeCharDevice != 0:
+		rc |= syscall.S_IFCHR
+	case mode&os.ModeDevice != 0:
+		rc |= syscall.S_IFBLK
+	default:
+		rc |= syscall.S_IFREG
+	}
+
+	if mode&os.ModeSetuid != 0 {
+		rc |= syscall.S_ISUID
+	}
+	if mode&os.ModeSetgid != 0 {
+		rc |= syscall.S_ISGID
+	}
+	if mode&os.ModeSticky != 0 {
+		rc |= syscall.S_ISVTX
+	}
+	return rc
+}
+
+// _sftpToFileMode -- converts unix permission bits to os.FileMode (ignoring the file type)
+func _sftpToFileMode(perm uint32) os.FileMode {
+	var rc = os.FileMode(perm & 0777)
+	if perm&syscall.S_ISUID != 0 {
+		rc |= os.ModeSetuid
+	}
+	if perm&syscall.S_ISGID != 0 {
+		rc |= os.ModeSetgid
+	}
+	if perm&syscall.S_ISVTX != 0 {
+		rc |= os.ModeSticky
+	}
+	return rc
+}
+
+// _sftpLongName -- returns an 'ls -l' style description of the file (shown by 'ls -l' in sftp clients)
+func _sftpLongName(fi os.FileInfo) string {
+	var uid, gid, nlink uint64 = 0, 0, 1
+	if stat, ok := fi.Sys().(*syscall.Stat_t); ok {
+		uid, gid, nlink = uint64(stat.Uid), uint64(stat.Gid), uint64(stat.Nlink)
+	}
+
+	var mode = []byte(fi.Mode().String())
+	if len(mode) > 10 {
+		// os.FileMode adds one letter per flag, ls only shows the type
+		mode = append(mode[:1], mode[len(mode)-9:]...)
+	}
+	switch mode[0] {
+	case 'L':
+		mode[0] = 'l'
+	case 'D':
+		mode[0] = 'b'
+	case '-', 'd':
+	default:
+		if fi.Mode()&os.ModeCharDevice != 0 {
+			mode[0] = 'c'
+		} else if fi.Mode()&os.ModeNamedPipe != 0 {
+			mode[0] = 'p'
+		} else if fi.Mode()&os.ModeSocket != 0 {
+			mode[0] = 's'
+		}
+	}
+
+	return fmt.Sprintf("%s %4d %-8d %-8d %8d %s %s", mode, nlink, uid, gid, fi.Size(), fi.ModTime().Format("Jan _2 15:04"), fi.Name())
+}
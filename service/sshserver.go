@@ -0,0 +1,57 @@
+package service
+
+import (
+	"github.com/ondevice/ondevice/service/sshd"
+	"github.com/sirupsen/logrus"
+)
+
+// SSHServerHandler -- protocol handler running the built-in SSH server (for devices without sshd)
+type SSHServerHandler struct {
+	ProtocolHandlerBase
+
+	server sshd.Server
+	conn   *handlerConn
+}
+
+// NewSSHServerHandler -- Create new SSHServerHandler
+func NewSSHServerHandler(server sshd.Server) ProtocolHandler {
+	rc := new(SSHServerHandler)
+	rc.server = server
+
+	return rc
+}
+
+// Close -- stops the SSH server (e.g. once the tunnel's been closed)
+func (s *SSHServerHandler) Close() {
+	s.conn.abort()
+}
+
+func (s *SSHServerHandler) connect() error {
+	s.conn = newHandlerConn(&s.ProtocolHandlerBase)
+	return nil
+}
+
+func (s *SSHServerHandler) onData(data []byte) {
+	// blocks until the SSH server has read everything
+	if err := s.conn.feed(data); err != nil {
+		logrus.WithError(err).Debug("SSHServerHandler: dropping data")
+	}
+}
+
+func (s *SSHServerHandler) onEOF() {
+	logrus.Debug("SSHServerHandler.onEOF()")
+	s.conn.closeWrite()
+}
+
+func (s *SSHServerHandler) receive() {
+	if err := s.server.ServeConn(s.conn); err != nil {
+		logrus.WithError(err).Error("SSHServerHandler error")
+	}
+
+	logrus.Debug("SSHServerHandler: done receiving")
+	s.tunnel.Close()
+}
+
+func (s *SSHServerHandler) self() *ProtocolHandlerBase {
+	return &s.ProtocolHandlerBase
+}
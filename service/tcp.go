@@ -3,6 +3,7 @@ package service
 import (
 	"net"
 	"reflect"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
@@ -11,8 +12,10 @@ import (
 type TCPHandler struct {
 	ProtocolHandlerBase
 
-	sock     net.Conn
-	addr     string
+	sock net.Conn
+	addr string
+
+	lock     sync.Mutex
 	isClosed bool
 }
 
@@ -26,13 +29,19 @@ func NewTCPHandler(addr string) ProtocolHandler {
 
 // Close -- Close both connections
 func (t *TCPHandler) Close() {
+	t.lock.Lock()
 	if t.isClosed {
+		t.lock.Unlock()
 		return
 	}
+	t.isClosed = true
+	t.lock.Unlock()
+
 	logrus.Debug("TCPHandler.Close()")
 	t.sock.Close()
-	t.tunnel.Close()
-	t.isClosed = true
+	if t.tunnel != nil {
+		t.tunnel.Close()
+	}
 }
 
 func (t *TCPHandler) connect() error {
@@ -72,7 +81,11 @@ func (t *TCPHandler) receive() {
 			logrus.Fatal("ERROR: TCPHandler.tunnel is null!!!")
 			break
 		}
-		t.tunnel.Write(buff[:count])
+		// blocks if the client can't keep up
+		if _, err = t.tunnel.Write(buff[:count]); err != nil {
+			logrus.WithError(err).Debug("TCPHandler: failed to write to tunnel")
+			break
+		}
 	}
 
 	logrus.Debug("TCPHandler: done receiving")
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ondevice/ondevice/tunnel"
+	"github.com/sirupsen/logrus"
+)
+
+// UDPSessionTimeout -- sessions that haven't been used for that long will be closed (by both sides)
+const UDPSessionTimeout = 2 * time.Minute
+
+// udpPacketHeaderSize -- each UDP packet is prefixed with its session ID (32 bit, big endian)
+const udpPacketHeaderSize = 4
+
+// MaxUDPPayloadSize -- the largest UDP packet that fits into a single datagram (see EncodeUDPPacket())
+const MaxUDPPayloadSize = tunnel.MaxDatagramSize - udpPacketHeaderSize
+
+// UDPHandler -- relays UDP packets between the tunnel and a UDP server
+//
+// Data is sent as datagrams (see tunnel.EncodeDatagram()), each of them an EncodeUDPPacket()ed packet.
+// The client assigns a session ID to each of its local peers, we'll use a separate socket for each
+// session (so the server's responses can be routed back to the right peer)
+type UDPHandler struct {
+	ProtocolHandlerBase
+
+	addr    string
+	udpAddr *net.UDPAddr
+	decoder tunnel.DatagramDecoder
+
+	lock      sync.Mutex
+	sessions  map[uint32]*udpSession
+	done      chan struct{}
+	isClosed  bool
+	writeLock sync.Mutex // prevents concurrent sessions from interleaving their datagrams
+}
+
+type udpSession struct {
+	conn     *net.UDPConn
+	lastUsed time.Time
+}
+
+// EncodeUDPPacket -- prefixes data with the session ID (the result has to be sent as a single datagram)
+func EncodeUDPPacket(session uint32, data []byte) []byte {
+	var rc = make([]byte, udpPacketHeaderSize+len(data))
+	binary.BigEndian.PutUint32(rc, session)
+	copy(rc[udpPacketHeaderSize:], data)
+	return rc
+}
+
+// DecodeUDPPacket -- returns the session ID and payload of an EncodeUDPPacket()ed datagram
+func DecodeUDPPacket(datagram []byte) (uint32, []byte, error) {
+	if len(datagram) < udpPacketHeaderSize {
+		return 0, nil, fmt.Errorf("UDP packet too short (%d bytes)", len(datagram))
+	}
+	return binary.BigEndian.Uint32(datagram), datagram[udpPacketHeaderSize:], nil
+}
+
+// NewUDPHandler -- Create new UDPHandler (relaying packets to addr)
+func NewUDPHandler(addr string) (ProtocolHandler, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return nil, fmt.Errorf("invalid 'addr' option (expected host:port): '%s'", addr)
+	}
+
+	rc := new(UDPHandler)
+	rc.addr = addr
+	rc.sessions = make(map[uint32]*udpSession)
+	rc.done = make(chan struct{})
+	rc.decoder.OnDatagram = rc.onDatagram
+	return rc, nil
+}
+
+// Close -- closes all the sessions
+func (h *UDPHandler) Close() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.isClosed {
+		return
+	}
+	logrus.Debug("UDPHandler.Close()")
+	h.isClosed = true
+	close(h.done)
+	for id, s := range h.sessions {
+		s.conn.Close()
+		delete(h.sessions, id)
+	}
+}
+
+func (h *UDPHandler) connect() error {
+	var err error
+	h.udpAddr, err = net.ResolveUDPAddr("udp", h.addr)
+	return err
+}
+
+func (h *UDPHandler) onData(data []byte) {
+	h.decoder.Write(data)
+}
+
+func (h *UDPHandler) onDatagram(datagram []byte) {
+	var id, payload, err = DecodeUDPPacket(datagram)
+	if err != nil {
+		logrus.WithError(err).Error("UDPHandler: dropping malformed packet")
+		return
+	}
+
+	s, err := h.getSession(id)
+	if err != nil {
+		logrus.WithError(err).Errorf("UDPHandler: failed to connect to %s", h.addr)
+		return
+	} else if s == nil {
+		return // closed
+	}
+
+	if _, err = s.conn.Write(payload); err != nil {
+		logrus.WithError(err).Debug("UDPHandler: failed to send packet")
+	}
+}
+
+func (h *UDPHandler) onEOF() {
+	// the client's gone
+	logrus.Debug("UDPHandler.onEOF()")
+	h.Close()
+}
+
+// receive -- closes idle sessions (until the handler's closed)
+func (h *UDPHandler) receive() {
+	var ticker = time.NewTicker(UDPSessionTimeout / 4)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-h.done:
+			logrus.Debug("UDPHandler: done receiving")
+			h.tunnel.Close()
+			return
+		case now := <-ticker.C:
+			h.lock.Lock()
+			for id, s := range h.sessions {
+				if now.Sub(s.lastUsed) > UDPSessionTimeout {
+					logrus.Debugf("UDPHandler: closing idle session %d", id)
+					s.conn.Close()
+					delete(h.sessions, id)
+				}
+			}
+			h.lock.Unlock()
+		}
+	}
+}
+
+// getSession -- returns the given session (opening a new socket if necessary), or nil if the handler's been closed
+func (h *UDPHandler) getSession(id uint32) (*udpSession, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.isClosed {
+		return nil, nil
+	}
+
+	var s, ok = h.sessions[id]
+	if !ok {
+		conn, err := net.DialUDP("udp", nil, h.udpAddr)
+		if err != nil {
+			return nil, err
+		}
+		logrus.Debugf("UDPHandler: new session %d (%s)", id, conn.LocalAddr())
+		s = &udpSession{conn: conn}
+		h.sessions[id] = s
+		go h.receiveSession(id, s)
+	}
+	s.lastUsed = time.Now()
+	return s, nil
+}
+
+// receiveSession -- passes the server's responses on to the client
+func (h *UDPHandler) receiveSession(id uint32, s *udpSession) {
+	var buff = make([]byte, MaxUDPPayloadSize)
+	for {
+		count, err := s.conn.Read(buff)
+		if err != nil {
+			logrus.WithError(err).Debugf("UDPHandler: session %d closed", id)
+			break
+		}
+
+		h.lock.Lock()
+		s.lastUsed = time.Now()
+		h.lock.Unlock()
+
+		frame, _ := tunnel.EncodeDatagram(EncodeUDPPacket(id, buff[:count]))
+		h.writeLock.Lock()
+		_, err = h.tunnel.Write(frame)
+		h.writeLock.Unlock()
+		if err != nil {
+			logrus.WithError(err).Debug("UDPHandler: failed to write to tunnel")
+			h.Close()
+			break
+		}
+	}
+
+	h.lock.Lock()
+	if h.sessions[id] == s {
+		delete(h.sessions, id)
+	}
+	h.lock.Unlock()
+}
+
+func (h *UDPHandler) self() *ProtocolHandlerBase {
+	return &h.ProtocolHandlerBase
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ondevice/ondevice/tunnel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUDPHandler(t *testing.T) {
+	// responds with the packet (upper case) and the address it came from
+	server, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	assert.NoError(t, err)
+	defer server.Close()
+	go func() {
+		var buff = make([]byte, 1024)
+		for {
+			count, addr, err := server.ReadFromUDP(buff)
+			if err != nil {
+				return
+			}
+			server.WriteToUDP([]byte(strings.ToUpper(string(buff[:count]))+" "+addr.String()), addr)
+		}
+	}()
+
+	var h, _ = NewUDPHandler(server.LocalAddr().String())
+	var endpoint = newTestEndpoint()
+	h.self().tunnel = endpoint
+	assert.NoError(t, h.connect())
+	go h.receive()
+
+	// two sessions, the first packet split up in transit
+	var frame, _ = tunnel.EncodeDatagram(EncodeUDPPacket(1, []byte("hello")))
+	h.onData(frame[:3])
+	h.onData(frame[3:])
+	frame, _ = tunnel.EncodeDatagram(EncodeUDPPacket(2, []byte("world")))
+	h.onData(frame)
+
+	var responses = map[uint32]string{}
+	var decoder = tunnel.DatagramDecoder{OnDatagram: func(data []byte) {
+		id, payload, err := DecodeUDPPacket(data)
+		assert.NoError(t, err)
+		responses[id] = string(payload)
+	}}
+	for start := time.Now(); len(responses) < 2 && time.Since(start) < 5*time.Second; {
+		time.Sleep(10 * time.Millisecond)
+		endpoint.lock.Lock()
+		decoder.Write(endpoint.data.Next(endpoint.data.Len()))
+		endpoint.lock.Unlock()
+	}
+
+	if assert.Len(t, responses, 2) {
+		var hello, world = strings.Fields(responses[1]), strings.Fields(responses[2])
+		assert.Equal(t, "HELLO", hello[0])
+		assert.Equal(t, "WORLD", world[0])
+		assert.NotEqual(t, hello[1], world[1], "each session should use its own socket")
+	}
+
+	// the client's gone -> close the sessions (and the tunnel)
+	h.onEOF()
+	<-endpoint.closed
+	assert.Empty(t, h.(*UDPHandler).sessions)
+
+	_, err = NewUDPHandler("localhost")
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"net"
+
+	"github.com/sirupsen/logrus"
+)
+
+// UnixHandler -- protocol handler connecting to a UNIX domain socket (e.g. /var/run/docker.sock)
+type UnixHandler struct {
+	TCPHandler
+}
+
+// NewUnixHandler -- Create new UnixHandler
+func NewUnixHandler(path string) ProtocolHandler {
+	rc := new(UnixHandler)
+	rc.addr = path
+
+	return rc
+}
+
+func (u *UnixHandler) connect() error {
+	var err error
+	u.sock, err = net.Dial("unix", u.addr)
+	return err
+}
+
+// onEOF -- the client won't send any more data -> half-close the socket (we'll keep forwarding its response)
+func (u *UnixHandler) onEOF() {
+	logrus.Debug("UnixHandler.onEOF()")
+	if conn, ok := u.sock.(*net.UnixConn); ok {
+		if err := conn.CloseWrite(); err == nil {
+			return
+		}
+	}
+	u.Close()
+}
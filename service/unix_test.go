@@ -0,0 +1,45 @@
+package service
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnixHandler(t *testing.T) {
+	var dir, err = ioutil.TempDir("", "ondevice-unix")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var path = filepath.Join(dir, "test.sock")
+	l, err := net.Listen("unix", path)
+	assert.NoError(t, err)
+	defer l.Close()
+
+	// reads the whole request, then responds (i.e. relies on the client half-closing the connection)
+	go func() {
+		var conn, err = l.Accept()
+		if err != nil {
+			return
+		}
+		var data, _ = ioutil.ReadAll(conn)
+		conn.Write(append([]byte("got: "), data...))
+		conn.Close()
+	}()
+
+	var h = NewUnixHandler(path)
+	var endpoint = newTestEndpoint()
+	h.self().tunnel = endpoint
+	assert.NoError(t, h.connect())
+
+	go h.receive()
+	h.onData([]byte("ping"))
+	h.onEOF()
+
+	<-endpoint.closed
+	assert.Equal(t, "got: ping", endpoint.data.String())
+}
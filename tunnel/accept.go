@@ -53,6 +53,7 @@ func Accept(t *Tunnel, tunnelID string, relayURL string, auths ...config.Auth) e
 	// init watchdog
 	if err == nil {
 		t.wdog = util.NewWatchdog(180*time.Second, t._onTimeout)
+		t._sendFlowControlPing()
 	}
 
 	return err
@@ -0,0 +1,253 @@
+package tunnel
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/util"
+)
+
+// Conn -- wraps a Tunnel, implementing net.Conn
+//
+// This allows tunnels to be used wherever Go expects an ordinary socket
+// (io.Copy(), http.Transport, ssh.NewClientConn(), grpc.WithContextDialer(), ...)
+type Conn struct {
+	tunnel *Tunnel
+	addr   Addr
+
+	lock         sync.Mutex
+	cond         *sync.Cond
+	queue        [][]byte // received but not yet read
+	readEOF      bool     // the remote side won't send any more data
+	writeEOF     bool     // CloseWrite() has been called
+	closed       bool     // Close() has been called
+	err          util.APIError
+	readDeadline time.Time
+	readTimer    *time.Timer
+}
+
+// Addr -- the address of a tunnel endpoint (implements net.Addr)
+type Addr struct {
+	DevID   string
+	Service string
+}
+
+// timeoutError -- returned by Conn's methods once a deadline has passed (implements net.Error)
+type timeoutError struct{}
+
+// Dial -- connects to a device's service, returning the tunnel as net.Conn
+func Dial(devID string, service string, protocol string, auths ...config.Auth) (*Conn, util.APIError) {
+	return DialContext(context.Background(), devID, service, protocol, auths...)
+}
+
+// DialContext -- like Dial(), but gives up once ctx is done
+//
+// (ctx only affects connecting, cancelling it later on won't close the tunnel)
+func DialContext(ctx context.Context, devID string, service string, protocol string, auths ...config.Auth) (*Conn, util.APIError) {
+	var t Tunnel
+	var rc = NewConn(&t, devID, service)
+
+	if err := ConnectContext(ctx, &t, devID, service, protocol, auths...); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+// NewConn -- wraps the given Tunnel (which has to be passed to Connect() or Accept() afterwards)
+//
+// Received data is only acknowledged once it's been read, so slow readers
+// will eventually block the remote side (if it supports flow control)
+func NewConn(t *Tunnel, devID string, service string) *Conn {
+	var rc = &Conn{
+		tunnel: t,
+		addr:   Addr{DevID: devID, Service: service},
+	}
+	rc.cond = sync.NewCond(&rc.lock)
+
+	t.deferAck = true
+	t.DataListeners = append(t.DataListeners, rc.onData)
+	t.EOFListeners = append(t.EOFListeners, rc.onEOF)
+	t.ErrorListeners = append(t.ErrorListeners, rc.onError)
+	t.CloseListeners = append(t.CloseListeners, rc.onEOF)
+	return rc
+}
+
+// Close -- closes the tunnel (discarding any data that hasn't been read yet)
+func (c *Conn) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+	c.closed = true
+	c.queue = nil
+	c.cond.Broadcast()
+	c.lock.Unlock()
+
+	c.tunnel.Close()
+	return nil
+}
+
+// CloseWrite -- sends an EOF to the remote side (i.e. closes the write channel)
+func (c *Conn) CloseWrite() error {
+	c.lock.Lock()
+	if c.closed || c.writeEOF {
+		c.lock.Unlock()
+		return nil
+	}
+	c.writeEOF = true
+	c.lock.Unlock()
+
+	c.tunnel.SendEOF()
+	return nil
+}
+
+// LocalAddr -- returns the device ID and service this tunnel is connected to
+//
+// (tunnels don't have a meaningful local address, so this is the same as RemoteAddr())
+func (c *Conn) LocalAddr() net.Addr {
+	return c.addr
+}
+
+// RemoteAddr -- returns the device ID and service this tunnel is connected to
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// Read -- reads tunnel data (implements io.Reader)
+//
+// returns io.EOF once the remote side has sent its EOF (and we've read all the data)
+func (c *Conn) Read(p []byte) (int, error) {
+	c.lock.Lock()
+	for len(c.queue) == 0 && !c.readEOF && !c.closed && !c._readDeadlineExceeded() {
+		c.cond.Wait()
+	}
+
+	if c.closed {
+		c.lock.Unlock()
+		return 0, util.NewAPIError(util.OtherError, "use of closed tunnel")
+	} else if len(c.queue) == 0 {
+		var err, readEOF = c.err, c.readEOF
+		c.lock.Unlock()
+
+		if !readEOF {
+			return 0, timeoutError{}
+		} else if err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+
+	var n = copy(p, c.queue[0])
+	if n < len(c.queue[0]) {
+		c.queue[0] = c.queue[0][n:]
+	} else {
+		c.queue = c.queue[1:]
+	}
+	c.lock.Unlock()
+
+	c.tunnel._ack(n)
+	return n, nil
+}
+
+// SetDeadline -- sets both the read and write deadline
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline -- makes pending and future Read() calls fail once t has passed (a zero value disables the deadline)
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.readDeadline = t
+	if c.readTimer != nil {
+		c.readTimer.Stop()
+		c.readTimer = nil
+	}
+	if !t.IsZero() {
+		c.readTimer = time.AfterFunc(time.Until(t), func() {
+			c.lock.Lock()
+			c.cond.Broadcast()
+			c.lock.Unlock()
+		})
+	}
+	return nil
+}
+
+// SetWriteDeadline -- makes Write() calls fail if they're still blocked (waiting for the remote side to catch up) once t has passed
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.tunnel.flow.setDeadline(t)
+	return nil
+}
+
+// Write -- sends data (implements io.Writer)
+func (c *Conn) Write(p []byte) (int, error) {
+	c.lock.Lock()
+	var closed, writeEOF = c.closed, c.writeEOF
+	c.lock.Unlock()
+
+	if closed {
+		return 0, util.NewAPIError(util.OtherError, "use of closed tunnel")
+	} else if writeEOF {
+		return 0, util.NewAPIError(util.OtherError, "write after EOF")
+	}
+	return c.tunnel.Write(p)
+}
+
+// Wait -- waits for the tunnel to close
+func (c *Conn) Wait() {
+	c.tunnel.Wait()
+}
+
+// _readDeadlineExceeded -- expects c.lock to be held
+func (c *Conn) _readDeadlineExceeded() bool {
+	return !c.readDeadline.IsZero() && !time.Now().Before(c.readDeadline)
+}
+
+func (c *Conn) onData(data []byte) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return
+	}
+
+	c.queue = append(c.queue, append([]byte(nil), data...))
+	c.cond.Broadcast()
+}
+
+func (c *Conn) onEOF() {
+	c.lock.Lock()
+	c.readEOF = true
+	c.cond.Broadcast()
+	c.lock.Unlock()
+}
+
+func (c *Conn) onError(err util.APIError) {
+	c.lock.Lock()
+	if c.err == nil {
+		c.err = err
+	}
+	c.cond.Broadcast()
+	c.lock.Unlock()
+}
+
+// Network -- returns "ondevice" (implements net.Addr)
+func (a Addr) Network() string {
+	return "ondevice"
+}
+
+// String -- returns "devId:service" (implements net.Addr)
+func (a Addr) String() string {
+	return fmt.Sprintf("%s:%s", a.DevID, a.Service)
+}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
@@ -0,0 +1,50 @@
+package tunnel
+
+import (
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConn(t *testing.T) {
+	var tunnel Tunnel
+	tunnel._initTunnel(ClientSide)
+	var c net.Conn = NewConn(&tunnel, "myDev", "web")
+
+	assert.Equal(t, "ondevice", c.RemoteAddr().Network())
+	assert.Equal(t, "myDev:web", c.RemoteAddr().String())
+
+	// Read() blocks until we get data (or the deadline passes)
+	c.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	var buff = make([]byte, 3)
+	var n, err = c.Read(buff)
+	assert.Equal(t, 0, n)
+	if netErr, ok := err.(net.Error); assert.True(t, ok) {
+		assert.True(t, netErr.Timeout())
+	}
+	c.SetReadDeadline(time.Time{})
+
+	// emulate incoming data (and the remote side's EOF)
+	for _, cb := range tunnel.DataListeners {
+		cb([]byte("hello "))
+		cb([]byte("world"))
+	}
+	for _, cb := range tunnel.EOFListeners {
+		cb()
+	}
+
+	n, err = c.Read(buff)
+	assert.NoError(t, err)
+	assert.Equal(t, "hel", string(buff[:n]))
+
+	data, err := ioutil.ReadAll(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "lo world", string(data))
+
+	n, err = c.Read(buff)
+	assert.Equal(t, io.EOF, err)
+}
@@ -1,6 +1,7 @@
 package tunnel
 
 import (
+	"context"
 	"time"
 
 	"github.com/ondevice/ondevice/config"
@@ -10,11 +11,16 @@ import (
 
 // Connect to a service on one of your devices
 func Connect(t *Tunnel, devID string, service string, protocol string, auths ...config.Auth) util.APIError {
+	return ConnectContext(context.Background(), t, devID, service, protocol, auths...)
+}
+
+// ConnectContext -- like Connect(), but gives up (and closes the tunnel) once ctx is done
+func ConnectContext(ctx context.Context, t *Tunnel, devID string, service string, protocol string, auths ...config.Auth) util.APIError {
 	params := map[string]string{"dev": devID, "service": service, "protocol": protocol}
 
 	t._initTunnel(ClientSide)
 	t.TimeoutListeners = append(t.TimeoutListeners, t._sendPing)
-	err := OpenWebsocket(&t.Connection, "/connect", params, t.onMessage, auths...)
+	err := OpenWebsocketContext(ctx, &t.Connection, "/connect", params, t.onMessage, auths...)
 
 	if err != nil {
 		return err
@@ -26,6 +32,9 @@ func Connect(t *Tunnel, devID string, service string, protocol string, auths ...
 		break
 	case <-time.After(time.Second * 30):
 		err = util.NewAPIError(util.OtherError, "Timeout while connecting to ", devID)
+	case <-ctx.Done():
+		err = util.NewAPIError(util.OtherError, "Aborted connecting to ", devID, ": ", ctx.Err())
+		t.Close()
 	}
 
 	close(t.connected)
@@ -33,6 +42,7 @@ func Connect(t *Tunnel, devID string, service string, protocol string, auths ...
 
 	if err == nil {
 		t.wdog = util.NewWatchdog(60*time.Second, t._onTimeout)
+		t._sendFlowControlPing()
 	}
 
 	return err
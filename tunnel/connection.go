@@ -1,9 +1,11 @@
 package tunnel
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 	"reflect"
+	"strconv"
 	"sync"
 	"time"
 
@@ -40,6 +42,8 @@ type Connection struct {
 	CloseListeners   []func()
 	ErrorListeners   []func(err util.APIError)
 	MessageListeners []func(int, []byte)
+	// PongListeners -- get the round trip time of each ping we've sent with SendPing()
+	PongListeners []func(rtt time.Duration)
 
 	writeLock sync.Mutex
 	done      chan struct{}
@@ -47,6 +51,11 @@ type Connection struct {
 
 // OpenWebsocket -- Open a websocket connection
 func OpenWebsocket(c *Connection, endpoint string, params map[string]string, onMessage func(int, []byte), auths ...config.Auth) util.APIError {
+	return OpenWebsocketContext(context.Background(), c, endpoint, params, onMessage, auths...)
+}
+
+// OpenWebsocketContext -- like OpenWebsocket(), but ctx can be used to abort the handshake
+func OpenWebsocketContext(ctx context.Context, c *Connection, endpoint string, params map[string]string, onMessage func(int, []byte), auths ...config.Auth) util.APIError {
 	if c.stateMachine != nil {
 		// TODO this is not thread safe
 		panic("OpenWebsocket() called twice on a single Connection!")
@@ -83,18 +92,22 @@ func OpenWebsocket(c *Connection, endpoint string, params map[string]string, onM
 
 	c.stateMachine.Event(evConnect)
 	websocket.DefaultDialer.HandshakeTimeout = 60 * time.Second
-	ws, resp, err := websocket.DefaultDialer.Dial(url, hdr)
+	ws, resp, err := websocket.DefaultDialer.DialContext(ctx, url, hdr)
 	if err != nil {
 		if resp != nil {
 			if resp.StatusCode == 401 {
 				return util.NewAPIError(resp.StatusCode, "API server authentication failed")
 			}
+			if resp.StatusCode == util.TooManyRequestsError {
+				return util.NewRetryAfterError(resp.StatusCode, util.ParseRetryAfter(resp.Header), "Error opening websocket: ", err)
+			}
 			return util.NewAPIError(resp.StatusCode, "Error opening websocket: ", err)
 		}
 		return util.NewAPIError(util.OtherError, "Error opening websocket: ", err)
 	}
 
 	c.ws = ws
+	c.ws.SetPongHandler(c._onPong)
 	c.MessageListeners = append(c.MessageListeners, onMessage)
 
 	go c.receive()
@@ -157,6 +170,12 @@ func (c *Connection) SendBinary(data []byte) error {
 	return c.ws.WriteMessage(websocket.BinaryMessage, data)
 }
 
+// SendPing -- Send a WebSocket ping frame (PongListeners will be called once the response arrives)
+func (c *Connection) SendPing() error {
+	var payload = strconv.FormatInt(time.Now().UnixNano(), 10)
+	return c.ws.WriteControl(websocket.PingMessage, []byte(payload), time.Now().Add(10*time.Second))
+}
+
 // SendJSON -- Send a JSON text message to the WebSocket
 func (c *Connection) SendJSON(value interface{}) error {
 	c.writeLock.Lock()
@@ -206,6 +225,20 @@ func (c *Connection) _onError(ev *fsm.Event) {
 	}
 }
 
+func (c *Connection) _onPong(payload string) error {
+	var sent, err = strconv.ParseInt(payload, 10, 64)
+	if err != nil {
+		logrus.Debugf("got unexpected pong: '%s'", payload)
+		return nil
+	}
+
+	var rtt = time.Since(time.Unix(0, sent))
+	for _, cb := range c.PongListeners {
+		cb(rtt)
+	}
+	return nil
+}
+
 func (c *Connection) _onStateChange(ev *fsm.Event) {
 	logrus.Debug("connection state changed: ", ev.Src, " -> ", ev.Dst)
 }
@@ -0,0 +1,80 @@
+package tunnel
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// MaxDatagramSize -- the largest datagram EncodeDatagram() accepts
+const MaxDatagramSize = 0xffff
+
+// datagramHeaderSize -- each datagram is prefixed with its length (16 bit, big endian)
+const datagramHeaderSize = 2
+
+// DatagramDecoder -- splits a byte stream of EncodeDatagram()ed messages back into datagrams
+//
+// Incomplete datagrams are buffered until the rest of their data arrives
+type DatagramDecoder struct {
+	// OnDatagram -- called for each complete datagram (the data is only valid until it returns)
+	OnDatagram func(data []byte)
+
+	buff []byte
+}
+
+// EncodeDatagram -- returns data prefixed with its length (so message boundaries survive byte streams)
+func EncodeDatagram(data []byte) ([]byte, error) {
+	if len(data) > MaxDatagramSize {
+		return nil, fmt.Errorf("datagram too large (%d bytes, max: %d)", len(data), MaxDatagramSize)
+	}
+
+	var rc = make([]byte, datagramHeaderSize+len(data))
+	binary.BigEndian.PutUint16(rc, uint16(len(data)))
+	copy(rc[datagramHeaderSize:], data)
+	return rc, nil
+}
+
+// Write -- feeds data to the decoder, calling OnDatagram for each datagram completed by it (implements io.Writer)
+func (d *DatagramDecoder) Write(data []byte) (int, error) {
+	var rc = len(data)
+	if len(d.buff) > 0 {
+		d.buff = append(d.buff, data...)
+		data = d.buff
+	}
+
+	for len(data) >= datagramHeaderSize {
+		var size = datagramHeaderSize + int(binary.BigEndian.Uint16(data))
+		if len(data) < size {
+			break
+		}
+		d.OnDatagram(data[datagramHeaderSize:size])
+		data = data[size:]
+	}
+
+	// keep what's left for later (copying it, data might be reused by the caller)
+	d.buff = append([]byte(nil), data...)
+	return rc, nil
+}
+
+// EnableDatagrams -- switches the Tunnel to datagram mode (call this before Connect() or Accept())
+//
+// In datagram mode, the DataListeners are called once per datagram the remote side has sent
+// (using WriteDatagram() or EncodeDatagram()), regardless of how they've been split up in transit
+func (t *Tunnel) EnableDatagrams() {
+	t.datagrams = &DatagramDecoder{OnDatagram: t._onDatagram}
+}
+
+// WriteDatagram -- sends data as a single datagram (the remote side has to decode it, see EnableDatagrams())
+func (t *Tunnel) WriteDatagram(data []byte) error {
+	var frame, err = EncodeDatagram(data)
+	if err != nil {
+		return err
+	}
+	_, err = t.Write(frame)
+	return err
+}
+
+func (t *Tunnel) _onDatagram(data []byte) {
+	for _, cb := range t.DataListeners {
+		cb(data)
+	}
+}
@@ -0,0 +1,58 @@
+package tunnel
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDatagramDecoder(t *testing.T) {
+	var received []string
+	var d = DatagramDecoder{OnDatagram: func(data []byte) {
+		received = append(received, string(data))
+	}}
+
+	var stream []byte
+	for _, msg := range []string{"hello", "", "world"} {
+		var frame, err = EncodeDatagram([]byte(msg))
+		assert.NoError(t, err)
+		stream = append(stream, frame...)
+	}
+
+	// split up at random positions
+	d.Write(stream[:1])
+	d.Write(stream[1:9])
+	assert.Equal(t, []string{"hello", ""}, received)
+	d.Write(stream[9:])
+	assert.Equal(t, []string{"hello", "", "world"}, received)
+
+	_, err := EncodeDatagram(make([]byte, MaxDatagramSize+1))
+	assert.Error(t, err)
+}
+
+func TestTunnelDatagrams(t *testing.T) {
+	var tunnel Tunnel
+	var received [][]byte
+	tunnel.EnableDatagrams()
+	tunnel.DataListeners = append(tunnel.DataListeners, func(data []byte) {
+		received = append(received, append([]byte(nil), data...))
+	})
+
+	// two datagrams in one message, the second one incomplete
+	var a, _ = EncodeDatagram([]byte("ping"))
+	var b, _ = EncodeDatagram(bytes.Repeat([]byte("x"), 1000))
+	tunnel.onMessage(websocket.BinaryMessage, append(append([]byte("data:"), a...), b[:500]...))
+	tunnel.onMessage(websocket.BinaryMessage, append([]byte("data:"), b[500:]...))
+
+	// the listeners are called in the dispatch goroutine
+	var done = make(chan struct{})
+	tunnel.dispatch.push(0, func() { close(done) })
+	<-done
+
+	if assert.Len(t, received, 2) {
+		assert.Equal(t, []byte("ping"), received[0])
+		assert.Equal(t, bytes.Repeat([]byte("x"), 1000), received[1])
+	}
+}
@@ -0,0 +1,84 @@
+package tunnel
+
+import (
+	"sync"
+)
+
+// maxDispatchQueue -- the receive goroutine blocks once this many bytes are waiting to be delivered
+//
+// Only applies if the remote side doesn't support flow control (see dispatchQueue.unbounded),
+// the others won't send much more than flowControlWindow bytes ahead
+const maxDispatchQueue = 2 * flowControlWindow
+
+// dispatchQueue -- delivers a Tunnel's data (and EOF) to its listeners in a separate goroutine
+//
+// That way the websocket's receive goroutine keeps handling 'meta:' messages while a
+// listener is blocked, e.g. in Tunnel.Write() (waiting for a 'meta:ack' that would
+// otherwise be queued behind the very message the listener is still handling)
+type dispatchQueue struct {
+	lock      sync.Mutex
+	cond      *sync.Cond
+	items     []dispatchItem
+	size      int64 // bytes waiting to be delivered
+	running   bool  // true while there's a goroutine delivering the items
+	unbounded bool  // set once the remote side has announced flow control support (see maxDispatchQueue)
+}
+
+type dispatchItem struct {
+	size int64
+	fn   func()
+}
+
+// push -- queues fn (to be called after all the previously queued ones)
+//
+// blocks while too much data is waiting to be delivered (unless size is 0, e.g. for EOF)
+func (q *dispatchQueue) push(size int64, fn func()) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.cond == nil {
+		q.cond = sync.NewCond(&q.lock)
+	}
+	for size > 0 && !q.unbounded && q.size > 0 && q.size+size > maxDispatchQueue {
+		q.cond.Wait()
+	}
+
+	q.items = append(q.items, dispatchItem{size: size, fn: fn})
+	q.size += size
+	if !q.running {
+		q.running = true
+		go q.run()
+	}
+}
+
+// run -- delivers the queued items (exiting once there are none left)
+func (q *dispatchQueue) run() {
+	for {
+		q.lock.Lock()
+		if len(q.items) == 0 {
+			q.running = false
+			q.lock.Unlock()
+			return
+		}
+		var item = q.items[0]
+		q.items = q.items[1:]
+		q.lock.Unlock()
+
+		item.fn()
+
+		q.lock.Lock()
+		q.size -= item.size
+		q.cond.Broadcast()
+		q.lock.Unlock()
+	}
+}
+
+// setUnbounded -- the remote side supports flow control, so push() doesn't have to block anymore
+func (q *dispatchQueue) setUnbounded() {
+	q.lock.Lock()
+	q.unbounded = true
+	if q.cond != nil {
+		q.cond.Broadcast()
+	}
+	q.lock.Unlock()
+}
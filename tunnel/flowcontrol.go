@@ -0,0 +1,163 @@
+package tunnel
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ondevice/ondevice/util"
+	"github.com/sirupsen/logrus"
+)
+
+// flowControlWindow -- maximum number of bytes a Tunnel may send before the remote side has acknowledged them
+const flowControlWindow = 512 * 1024
+
+// flowControlPing -- ping payload announcing flow control support
+//
+// Older versions treat unknown 'meta:' messages as errors, but they'll reply to any
+// ping. So we only send 'meta:ack' messages (and enforce the window) once the
+// remote side has sent us a 'meta:ping:flowControl'.
+const flowControlPing = "flowControl"
+
+// flowControl -- window based flow control for Tunnels
+//
+// The receiving side sends 'meta:ack:<bytes>' after its DataListeners have consumed
+// the data, the sending side blocks in Tunnel.Write() while more than flowControlWindow
+// bytes are unacknowledged.
+type flowControl struct {
+	lock sync.Mutex
+	cond *sync.Cond
+
+	enabled  bool  // true once the remote side has announced flow control support
+	closed   bool  // set when the tunnel closes (to wake up blocked writers)
+	inFlight int64 // bytes we've sent that haven't been acknowledged yet
+	unacked  int64 // bytes we've consumed but haven't acknowledged yet
+
+	deadline time.Time   // reserve() fails with a timeout error once this has passed (see Conn.SetWriteDeadline())
+	timer    *time.Timer // wakes up blocked writers when the deadline passes
+}
+
+func (f *flowControl) init() {
+	f.cond = sync.NewCond(&f.lock)
+}
+
+// close -- wakes up blocked writers
+func (f *flowControl) close() {
+	f.lock.Lock()
+	f.closed = true
+	f.cond.Broadcast()
+	f.lock.Unlock()
+}
+
+// enable -- the remote side supports flow control, returns the number of bytes that need to be acknowledged
+func (f *flowControl) enable() int64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.enabled = true
+	var rc = f.unacked
+	f.unacked = 0
+	return rc
+}
+
+// onAck -- the remote side has consumed count bytes
+func (f *flowControl) onAck(count int64) {
+	f.lock.Lock()
+	f.inFlight -= count
+	if f.inFlight < 0 {
+		f.inFlight = 0
+	}
+	f.cond.Broadcast()
+	f.lock.Unlock()
+}
+
+// consumed -- our DataListeners have consumed count bytes, returns the number of bytes to acknowledge (or 0)
+func (f *flowControl) consumed(count int64) int64 {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.unacked += count
+	if !f.enabled || f.unacked < flowControlWindow/4 {
+		return 0
+	}
+	var rc = f.unacked
+	f.unacked = 0
+	return rc
+}
+
+// reserve -- waits until we may send count bytes
+//
+// fails if the tunnel was closed or the deadline has passed in the meantime
+func (f *flowControl) reserve(count int64) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	// (inFlight > 0 makes sure we won't block forever on writes larger than the window)
+	for f.enabled && !f.closed && !f._deadlineExceeded() && f.inFlight > 0 && f.inFlight+count > flowControlWindow {
+		f.cond.Wait()
+	}
+
+	if f.closed {
+		return util.NewAPIError(util.OtherError, "tunnel closed")
+	} else if f._deadlineExceeded() {
+		return timeoutError{}
+	}
+	f.inFlight += count
+	return nil
+}
+
+// setDeadline -- makes reserve() fail once the deadline has passed (a zero value disables the deadline)
+func (f *flowControl) setDeadline(deadline time.Time) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.deadline = deadline
+	if f.timer != nil {
+		f.timer.Stop()
+		f.timer = nil
+	}
+	if !deadline.IsZero() {
+		f.timer = time.AfterFunc(time.Until(deadline), func() {
+			f.lock.Lock()
+			f.cond.Broadcast()
+			f.lock.Unlock()
+		})
+	}
+}
+
+// _deadlineExceeded -- expects f.lock to be held
+func (f *flowControl) _deadlineExceeded() bool {
+	return !f.deadline.IsZero() && !time.Now().Before(f.deadline)
+}
+
+// _ack -- our listeners have consumed count bytes (sends an ack if necessary)
+func (t *Tunnel) _ack(count int) {
+	t._sendAck(t.flow.consumed(int64(count)))
+}
+
+// _sendAck -- sends a 'meta:ack' message (if count > 0)
+func (t *Tunnel) _sendAck(count int64) {
+	if count <= 0 {
+		return
+	}
+	if err := t.SendBinary([]byte(fmt.Sprintf("meta:ack:%d", count))); err != nil {
+		logrus.WithError(err).Debug("failed to send tunnel ack")
+	}
+}
+
+// _sendFlowControlPing -- tells the remote side we support flow control
+func (t *Tunnel) _sendFlowControlPing() {
+	if err := t.SendBinary([]byte("meta:ping:" + flowControlPing)); err != nil {
+		logrus.WithError(err).Debug("failed to send flow control ping")
+	}
+}
+
+func (t *Tunnel) _onAck(payload []byte) {
+	var count, err = strconv.ParseInt(string(payload), 10, 64)
+	if err != nil {
+		logrus.WithError(err).Errorf("malformed tunnel ack: '%s'", payload)
+		return
+	}
+	t.flow.onAck(count)
+}
@@ -0,0 +1,42 @@
+package tunnel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlowControl(t *testing.T) {
+	var f flowControl
+	f.init()
+
+	// flow control is disabled until the remote side announces support
+	assert.NoError(t, f.reserve(2*flowControlWindow))
+	assert.Equal(t, int64(0), f.consumed(flowControlWindow))
+
+	// ... in which case we'll acknowledge everything we've consumed so far
+	assert.Equal(t, int64(flowControlWindow), f.enable())
+	assert.Equal(t, int64(0), f.consumed(100))
+	assert.Equal(t, int64(flowControlWindow/4), f.consumed(flowControlWindow/4-100))
+
+	// the window is full -> reserve() blocks until we get an ack
+	var done = make(chan error)
+	go func() { done <- f.reserve(100) }()
+
+	select {
+	case <-done:
+		t.Fatal("reserve() should've blocked")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	f.onAck(2 * flowControlWindow)
+	assert.NoError(t, <-done)
+
+	// closing the tunnel wakes up blocked writers
+	f.onAck(100)
+	assert.NoError(t, f.reserve(flowControlWindow))
+	go func() { done <- f.reserve(100) }()
+	f.close()
+	assert.Error(t, <-done)
+}
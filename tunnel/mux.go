@@ -0,0 +1,554 @@
+package tunnel
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ondevice/ondevice/config"
+	"github.com/ondevice/ondevice/util"
+	"github.com/sirupsen/logrus"
+)
+
+// MuxService -- service (and protocol) name of multiplexed tunnels (offered by every `ondevice daemon`)
+const MuxService = "mux"
+
+const (
+	// muxWindowSize -- maximum number of unacknowledged bytes per stream
+	muxWindowSize = 256 * 1024
+	// muxFrameSize -- maximum payload size of a single 'data' frame
+	muxFrameSize = 16 * 1024
+)
+
+// Mux -- multiplexes many independent Streams over a single Tunnel
+//
+// Each mux frame is sent as a single tunnel data message and has the format
+//
+//	<type>:<streamId>[:<payload>]
+//
+// with the following frame types:
+// - open:<id>:<service>:<protocol> -- (client -> device) open a new stream
+// - opened:<id>                    -- (device -> client) the stream has been accepted
+// - data:<id>:<bytes>              -- stream data
+// - ack:<id>:<count>               -- the receiver has consumed <count> bytes (flow control)
+// - eof:<id>                       -- the sender won't send any more data on this stream
+// - close:<id>[:<code>:<msg>]      -- the stream has been closed (or rejected, if <code> is set)
+//
+// Each side of a stream may only have muxWindowSize unacknowledged bytes in flight
+// (Stream.Write() blocks until the receiver has caught up), so a slow stream won't
+// affect the others.
+type Mux struct {
+	// OnStream -- (device side) called (in its own goroutine) for each stream the client opens.
+	// Return an error to reject the stream (its code and message will be sent to the client)
+	OnStream func(s *Stream) util.APIError
+
+	tunnel *Tunnel
+	send   func(frame []byte) error
+
+	lock    sync.Mutex
+	streams map[uint64]*Stream
+	lastID  uint64
+	closed  bool
+}
+
+// NewMux -- creates a Mux for the given Tunnel
+//
+// call this before Connect() or Accept() (to make sure we won't miss any data)
+func NewMux(t *Tunnel) *Mux {
+	var rc = newMux(func(frame []byte) error {
+		_, err := t.Write(frame)
+		return err
+	})
+	rc.tunnel = t
+
+	t.DataListeners = append(t.DataListeners, rc.onFrame)
+	t.EOFListeners = append(t.EOFListeners, rc.onTunnelClosed)
+	return rc
+}
+
+// ConnectMux -- opens a multiplexed tunnel to the given device (use Mux.Open() to open streams)
+func ConnectMux(devID string, auths ...config.Auth) (*Mux, util.APIError) {
+	var t = new(Tunnel)
+	var rc = NewMux(t)
+
+	if err := Connect(t, devID, MuxService, MuxService, auths...); err != nil {
+		return nil, err
+	}
+	return rc, nil
+}
+
+func newMux(send func(frame []byte) error) *Mux {
+	return &Mux{
+		send:    send,
+		streams: make(map[uint64]*Stream),
+	}
+}
+
+// Close -- closes the Mux (and all of its streams)
+func (m *Mux) Close() {
+	if m.tunnel != nil {
+		m.tunnel.Close() // will call onTunnelClosed()
+	} else {
+		m.onTunnelClosed()
+	}
+}
+
+// IsClosed -- returns true once the underlying Tunnel has been closed
+func (m *Mux) IsClosed() bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.closed
+}
+
+// Open -- (client side) opens a new stream to the given service
+//
+// blocks until the device has accepted (or rejected) the stream
+func (m *Mux) Open(service string, protocol string) (*Stream, util.APIError) {
+	m.lock.Lock()
+	if m.closed {
+		m.lock.Unlock()
+		return nil, util.NewAPIError(util.OtherError, "mux tunnel closed")
+	}
+	m.lastID++
+	var opened = make(chan util.APIError, 1)
+	var s = newStream(m, m.lastID, service, protocol)
+	s.opened = opened
+	m.streams[s.ID] = s
+	m.lock.Unlock()
+
+	if err := m.sendFrame("open", s.ID, []byte(service+":"+protocol)); err != nil {
+		m.remove(s.ID)
+		return nil, util.NewAPIError(util.OtherError, "failed to open stream: ", err)
+	}
+
+	select {
+	case err := <-opened:
+		if err != nil {
+			return nil, err
+		}
+	case <-time.After(30 * time.Second):
+		s.Close()
+		return nil, util.NewAPIError(util.OtherError, "Timeout while opening stream to ", service)
+	}
+
+	return s, nil
+}
+
+// get -- returns the stream with the given ID (or nil)
+func (m *Mux) get(id uint64) *Stream {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.streams[id]
+}
+
+// remove -- forgets about the given stream
+func (m *Mux) remove(id uint64) {
+	m.lock.Lock()
+	delete(m.streams, id)
+	m.lock.Unlock()
+}
+
+func (m *Mux) sendFrame(frameType string, id uint64, payload []byte) error {
+	var frame = []byte(fmt.Sprintf("%s:%d", frameType, id))
+	if payload != nil {
+		frame = append(frame, ':')
+		frame = append(frame, payload...)
+	}
+	return m.send(frame)
+}
+
+// onFrame -- handles incoming mux frames (registered as Tunnel.DataListener)
+func (m *Mux) onFrame(frame []byte) {
+	var parts = bytes.SplitN(frame, []byte(":"), 3)
+	if len(parts) < 2 {
+		logrus.Errorf("malformed mux frame: '%s'", frame)
+		return
+	}
+
+	var frameType = string(parts[0])
+	var id, err = strconv.ParseUint(string(parts[1]), 10, 64)
+	if err != nil {
+		logrus.WithError(err).Errorf("malformed mux stream ID: '%s'", parts[1])
+		return
+	}
+	var payload []byte
+	if len(parts) > 2 {
+		payload = parts[2]
+	}
+
+	if frameType == "open" {
+		go m.onOpen(id, payload)
+		return
+	}
+
+	var s = m.get(id)
+	if s == nil {
+		if frameType != "close" {
+			logrus.Debugf("got mux '%s' frame for unknown stream %d", frameType, id)
+		}
+		return
+	}
+
+	switch frameType {
+	case "opened":
+		s.onOpened(nil)
+	case "data":
+		s.onData(payload)
+	case "ack":
+		if count, err := strconv.Atoi(string(payload)); err == nil {
+			s.onAck(count)
+		} else {
+			logrus.WithError(err).Errorf("malformed mux ack: '%s'", payload)
+		}
+	case "eof":
+		s.onEOF()
+	case "close":
+		s.onRemoteClose(parseMuxError(payload))
+	default:
+		logrus.Warning("unsupported mux frame type: ", frameType)
+	}
+}
+
+// onOpen -- (device side) the client wants to open a new stream
+func (m *Mux) onOpen(id uint64, payload []byte) {
+	var parts = bytes.SplitN(payload, []byte(":"), 2)
+	var service, protocol = string(parts[0]), ""
+	if len(parts) > 1 {
+		protocol = string(parts[1])
+	}
+
+	m.lock.Lock()
+	if m.closed || m.streams[id] != nil {
+		m.lock.Unlock()
+		logrus.Errorf("refusing to open mux stream %d", id)
+		return
+	}
+	var s = newStream(m, id, service, protocol)
+	m.streams[id] = s
+	m.lock.Unlock()
+
+	var err util.APIError
+	if m.OnStream == nil {
+		err = util.NewAPIError(util.NotFoundError, "this side doesn't accept streams")
+	} else {
+		err = m.OnStream(s)
+	}
+
+	if err != nil {
+		m.remove(id)
+		s.onRemoteClose(err)
+		m.sendFrame("close", id, []byte(fmt.Sprintf("%d:%s", err.Code(), err.Error())))
+		return
+	}
+
+	// send 'opened' before allowing the stream to send any data
+	m.sendFrame("opened", id, nil)
+	s.onOpened(nil)
+}
+
+// onTunnelClosed -- closes all the streams (with an error)
+func (m *Mux) onTunnelClosed() {
+	m.lock.Lock()
+	var streams = m.streams
+	m.streams = make(map[uint64]*Stream)
+	m.closed = true
+	m.lock.Unlock()
+
+	for _, s := range streams {
+		s.onRemoteClose(util.NewAPIError(util.OtherError, "mux tunnel closed"))
+	}
+}
+
+// parseMuxError -- parses the '<code>:<msg>' payload of 'close' frames (returns nil if empty)
+func parseMuxError(payload []byte) util.APIError {
+	if len(payload) == 0 {
+		return nil
+	}
+
+	var parts = bytes.SplitN(payload, []byte(":"), 2)
+	var code, _ = strconv.Atoi(string(parts[0]))
+	var msg = string(payload)
+	if len(parts) > 1 {
+		msg = string(parts[1])
+	}
+	return util.NewAPIError(code, msg)
+}
+
+// Stream -- a single bidirectional byte stream within a Mux
+//
+// implements io.Reader, io.Writer and Endpoint
+type Stream struct {
+	ID       uint64
+	Service  string
+	Protocol string
+
+	mux    *Mux
+	opened chan util.APIError // (client side) gets the result of Mux.Open()
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	queue    [][]byte // received but not yet read
+	unacked  int      // bytes we've read but haven't acknowledged yet
+	inFlight int      // bytes we've sent but the remote side hasn't acknowledged yet
+
+	isOpen, readEOF, writeEOF, closed bool
+	err                               util.APIError
+	done                              chan struct{}
+
+	bytesRead, bytesWritten int64
+	startTs                 time.Time
+}
+
+func newStream(m *Mux, id uint64, service string, protocol string) *Stream {
+	var rc = &Stream{
+		ID:       id,
+		Service:  service,
+		Protocol: protocol,
+		mux:      m,
+		done:     make(chan struct{}),
+		startTs:  time.Now(),
+	}
+	rc.cond = sync.NewCond(&rc.lock)
+	return rc
+}
+
+// Close -- closes the stream (discarding any data that hasn't been read yet)
+func (s *Stream) Close() {
+	s.closeWithPayload(nil, nil)
+}
+
+// CloseWithError -- closes the stream, telling the remote side why
+func (s *Stream) CloseWithError(code int, msg string) {
+	s.closeWithPayload(util.NewAPIError(code, msg), []byte(fmt.Sprintf("%d:%s", code, msg)))
+}
+
+func (s *Stream) closeWithPayload(err util.APIError, payload []byte) {
+	s.lock.Lock()
+	if s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.queue = nil
+	s._setClosed(err)
+	s.lock.Unlock()
+
+	s.mux.remove(s.ID)
+	s.mux.sendFrame("close", s.ID, payload)
+}
+
+// CloseWrite -- alias for SendEOF() (matching net.TCPConn's signature)
+func (s *Stream) CloseWrite() error {
+	s.SendEOF()
+	return nil
+}
+
+// Error -- returns the error this stream has been closed with (or nil)
+func (s *Stream) Error() util.APIError {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.err
+}
+
+// Read -- reads stream data (implements io.Reader)
+//
+// returns io.EOF once the remote side has sent its EOF (and we've read all the data)
+func (s *Stream) Read(p []byte) (int, error) {
+	s.lock.Lock()
+	for len(s.queue) == 0 && !s.readEOF && !s.closed {
+		s.cond.Wait()
+	}
+
+	if len(s.queue) == 0 {
+		var err = s.err
+		s.lock.Unlock()
+
+		s._checkDone()
+		if err != nil {
+			return 0, err
+		}
+		return 0, io.EOF
+	}
+
+	var n = copy(p, s.queue[0])
+	if n < len(s.queue[0]) {
+		s.queue[0] = s.queue[0][n:]
+	} else {
+		s.queue = s.queue[1:]
+	}
+
+	// acknowledge what we've read (but don't send an ack for every single read)
+	var ack int
+	s.unacked += n
+	if s.unacked >= muxWindowSize/4 || len(s.queue) == 0 {
+		ack = s.unacked
+		s.unacked = 0
+	}
+	var closed = s.closed
+	s.lock.Unlock()
+
+	if ack > 0 && !closed {
+		s.mux.sendFrame("ack", s.ID, []byte(strconv.Itoa(ack)))
+	}
+	return n, nil
+}
+
+// SendEOF -- tells the remote side we won't send any more data (i.e. close the write channel)
+func (s *Stream) SendEOF() {
+	s.lock.Lock()
+	if s.writeEOF || s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.writeEOF = true
+	s.cond.Broadcast()
+	s.lock.Unlock()
+
+	s.mux.sendFrame("eof", s.ID, nil)
+	s._checkDone()
+}
+
+// Stats -- returns the number of bytes sent and received over this stream so far
+func (s *Stream) Stats() Stats {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return Stats{
+		BytesRead:    s.bytesRead,
+		BytesWritten: s.bytesWritten,
+		StartTs:      s.startTs,
+	}
+}
+
+// Wait -- waits for the stream to close
+func (s *Stream) Wait() {
+	<-s.done
+}
+
+// Write -- sends data (implements io.Writer)
+//
+// blocks while the remote side hasn't acknowledged enough of the data we've sent previously
+func (s *Stream) Write(p []byte) (int, error) {
+	var rc int
+	for len(p) > 0 {
+		var chunk = len(p)
+		if chunk > muxFrameSize {
+			chunk = muxFrameSize
+		}
+
+		s.lock.Lock()
+		for !s.closed && !s.writeEOF && (!s.isOpen || s.inFlight+chunk > muxWindowSize) {
+			s.cond.Wait()
+		}
+		if s.closed {
+			var err = s.err
+			s.lock.Unlock()
+			if err == nil {
+				err = util.NewAPIError(util.OtherError, "stream closed")
+			}
+			return rc, err
+		} else if s.writeEOF {
+			s.lock.Unlock()
+			return rc, util.NewAPIError(util.OtherError, "write after EOF")
+		}
+		s.inFlight += chunk
+		s.lock.Unlock()
+
+		if err := s.mux.sendFrame("data", s.ID, p[:chunk]); err != nil {
+			return rc, err
+		}
+		s.lock.Lock()
+		s.bytesWritten += int64(chunk)
+		s.lock.Unlock()
+		rc += chunk
+		p = p[chunk:]
+	}
+
+	return rc, nil
+}
+
+// _checkDone -- finishes the stream once both sides have sent their EOF (and all the data has been read)
+func (s *Stream) _checkDone() {
+	s.lock.Lock()
+	if s.closed || !s.readEOF || !s.writeEOF || len(s.queue) > 0 {
+		s.lock.Unlock()
+		return
+	}
+	s._setClosed(nil)
+	s.lock.Unlock()
+
+	s.mux.remove(s.ID)
+	s.mux.sendFrame("close", s.ID, nil)
+}
+
+// _setClosed -- marks the stream as closed (expects s.lock to be held)
+func (s *Stream) _setClosed(err util.APIError) {
+	s.closed = true
+	s.err = err
+	s.cond.Broadcast()
+	close(s.done)
+
+	if s.opened != nil {
+		if err == nil {
+			err = util.NewAPIError(util.OtherError, "stream closed")
+		}
+		s.opened <- err
+		s.opened = nil
+	}
+}
+
+func (s *Stream) onAck(count int) {
+	s.lock.Lock()
+	s.inFlight -= count
+	if s.inFlight < 0 {
+		s.inFlight = 0
+	}
+	s.cond.Broadcast()
+	s.lock.Unlock()
+}
+
+func (s *Stream) onData(data []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed || s.readEOF {
+		logrus.Debugf("dropping data for finished mux stream %d", s.ID)
+		return
+	}
+
+	s.queue = append(s.queue, append([]byte(nil), data...))
+	s.bytesRead += int64(len(data))
+	s.cond.Broadcast()
+}
+
+func (s *Stream) onEOF() {
+	s.lock.Lock()
+	s.readEOF = true
+	s.cond.Broadcast()
+	s.lock.Unlock()
+
+	s._checkDone()
+}
+
+func (s *Stream) onOpened(err util.APIError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.isOpen = true
+	s.cond.Broadcast()
+	if s.opened != nil {
+		s.opened <- err
+		s.opened = nil
+	}
+}
+
+// onRemoteClose -- the remote side has closed the stream (any data we've already received can still be read)
+func (s *Stream) onRemoteClose(err util.APIError) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return
+	}
+	s.mux.remove(s.ID)
+	s._setClosed(err)
+}
@@ -0,0 +1,133 @@
+package tunnel
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/ondevice/ondevice/util"
+	"github.com/stretchr/testify/assert"
+)
+
+// newMuxPair -- returns two Muxes connected to each other (delivering frames in order, like a Tunnel would)
+func newMuxPair() (client *Mux, device *Mux) {
+	var toClient, toDevice = make(chan []byte, 100), make(chan []byte, 100)
+	var pipe = func(ch chan []byte) func([]byte) error {
+		return func(frame []byte) error {
+			ch <- append([]byte(nil), frame...)
+			return nil
+		}
+	}
+
+	client = newMux(pipe(toDevice))
+	device = newMux(pipe(toClient))
+	go func() {
+		for frame := range toClient {
+			client.onFrame(frame)
+		}
+	}()
+	go func() {
+		for frame := range toDevice {
+			device.onFrame(frame)
+		}
+	}()
+	return client, device
+}
+
+// echoStreams -- device side handler returning whatever it receives
+func echoStreams(s *Stream) util.APIError {
+	if s.Service != "echo" {
+		return util.NewAPIError(util.NotFoundError, "service not found: ", s.Service)
+	}
+	go func() {
+		io.Copy(s, s)
+		s.SendEOF()
+	}()
+	return nil
+}
+
+func TestMuxEcho(t *testing.T) {
+	var client, device = newMuxPair()
+	device.OnStream = echoStreams
+
+	// more data than fits into a single window (to make sure acks work)
+	var data = bytes.Repeat([]byte("0123456789abcdef"), 3*muxWindowSize/16+5)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var s, err = client.Open("echo", "echo")
+			if !assert.Nil(t, err) {
+				return
+			}
+
+			go func() {
+				s.Write(data)
+				s.SendEOF()
+			}()
+
+			var received, readErr = ioutil.ReadAll(s)
+			assert.NoError(t, readErr)
+			assert.Equal(t, len(data), len(received))
+			assert.True(t, bytes.Equal(data, received))
+			s.Wait()
+
+			var stats = s.Stats()
+			assert.Equal(t, int64(len(data)), stats.BytesRead)
+			assert.Equal(t, int64(len(data)), stats.BytesWritten)
+			assert.False(t, stats.StartTs.IsZero())
+		}()
+	}
+	wg.Wait()
+}
+
+func TestMuxRejectStream(t *testing.T) {
+	var client, device = newMuxPair()
+	device.OnStream = echoStreams
+
+	var s, err = client.Open("unknown", "tcp")
+	assert.Nil(t, s)
+	if assert.NotNil(t, err) {
+		assert.Equal(t, util.NotFoundError, err.Code())
+	}
+}
+
+func TestMuxClose(t *testing.T) {
+	var client, device = newMuxPair()
+	device.OnStream = echoStreams
+
+	var s, err = client.Open("echo", "echo")
+	assert.Nil(t, err)
+
+	client.Close()
+	assert.True(t, client.IsClosed())
+	s.Wait()
+
+	_, writeErr := s.Write([]byte("hello"))
+	assert.Error(t, writeErr)
+	_, err = client.Open("echo", "echo")
+	assert.NotNil(t, err)
+}
+
+func TestMuxCloseWithError(t *testing.T) {
+	var client, device = newMuxPair()
+	var deviceStream = make(chan *Stream, 1)
+	device.OnStream = func(s *Stream) util.APIError {
+		deviceStream <- s
+		return nil
+	}
+
+	var s, err = client.Open("echo", "echo")
+	assert.Nil(t, err)
+
+	(<-deviceStream).CloseWithError(util.OtherError, "killed")
+	s.Wait()
+	if assert.NotNil(t, s.Error()) {
+		assert.Equal(t, util.OtherError, s.Error().Code())
+		assert.Equal(t, "killed", s.Error().Error())
+	}
+}
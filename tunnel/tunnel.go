@@ -3,8 +3,10 @@ package tunnel
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -23,8 +25,13 @@ type Tunnel struct {
 	lastPing  time.Time
 
 	readEOF, writeEOF bool
+	flow              flowControl
+	deferAck          bool             // set by Conn (which acknowledges data once it's actually been read)
+	datagrams         *DatagramDecoder // set by EnableDatagrams()
+	dispatch          dispatchQueue    // calls the DataListeners and EOFListeners
 
 	// metrics:
+	statsLock               sync.Mutex
 	bytesRead, bytesWritten int64
 	startTs                 time.Time
 
@@ -34,6 +41,23 @@ type Tunnel struct {
 	TimeoutListeners []func()
 }
 
+// Stats -- a Tunnel's traffic counters (see Tunnel.Stats())
+type Stats struct {
+	BytesRead    int64
+	BytesWritten int64
+	StartTs      time.Time
+}
+
+// Endpoint -- the sending half of a tunnel (implemented by Tunnel and Stream)
+type Endpoint interface {
+	io.Writer
+
+	// SendEOF -- closes the write channel
+	SendEOF()
+	// Close -- closes both channels
+	Close()
+}
+
 const (
 	// ClientSide -- This Tunnel instance represents the client side of the tunnel (see Tunnel.Side)
 	ClientSide = "client"
@@ -50,6 +74,8 @@ func GetErrorCodeName(code int) string {
 		return "Access Denied"
 	case 404:
 		return "Not Found"
+	case 410:
+		return "Gone"
 	case 503:
 		return "Service Unavailable"
 	}
@@ -60,7 +86,10 @@ func GetErrorCodeName(code int) string {
 func (t *Tunnel) _initTunnel(side string) {
 	t.connected = make(chan util.APIError)
 	t.Side = side
+	t.statsLock.Lock()
 	t.startTs = time.Now()
+	t.statsLock.Unlock()
+	t.flow.init()
 	t.CloseListeners = append([]func(){t._onClose}, t.CloseListeners...)
 }
 
@@ -77,11 +106,42 @@ func (t *Tunnel) SendEOF() {
 	t._checkClose()
 }
 
-func (t *Tunnel) Write(data []byte) {
+// CloseWithError -- sends an 'error:' message (telling the remote side why we're closing the tunnel), then closes it
+func (t *Tunnel) CloseWithError(code int, msg string) {
+	if err := t.SendBinary([]byte(fmt.Sprintf("error:%d:%s", code, msg))); err != nil {
+		logrus.WithError(err).Debug("failed to send tunnel error")
+	}
+	t.Close()
+}
+
+// Write -- send data to the remote end of the tunnel (implements io.Writer)
+//
+// If the remote side supports flow control, this blocks while too much of the data
+// we've sent hasn't been acknowledged yet
+func (t *Tunnel) Write(data []byte) (int, error) {
+	if err := t.flow.reserve(int64(len(data))); err != nil {
+		return 0, err
+	}
 	msg := append([]byte("data:"), data...)
 
+	if err := t.SendBinary(msg); err != nil {
+		return 0, err
+	}
+	t.statsLock.Lock()
 	t.bytesWritten += int64(len(data))
-	t.SendBinary(msg)
+	t.statsLock.Unlock()
+	return len(data), nil
+}
+
+// Stats -- returns the number of bytes received/sent so far (and when the tunnel was opened)
+func (t *Tunnel) Stats() Stats {
+	t.statsLock.Lock()
+	defer t.statsLock.Unlock()
+	return Stats{
+		BytesRead:    t.bytesRead,
+		BytesWritten: t.bytesWritten,
+		StartTs:      t.startTs,
+	}
 }
 
 func (t *Tunnel) onMessage(_type int, msg []byte) {
@@ -106,13 +166,21 @@ func (t *Tunnel) onMessage(_type int, msg []byte) {
 			//logrus.Debug("got tunnel ping")
 			pong := []byte("meta:pong")
 			t.lastPing = time.Now()
-			t.wdog.Kick()
+			if t.wdog != nil {
+				t.wdog.Kick()
+			}
 
 			if len(parts) > 1 {
 				pong = append(pong, byte(':'))
 				pong = append(pong, msg[5:]...)
 			}
 			t.SendBinary(pong)
+
+			if len(parts) > 1 && string(parts[1]) == flowControlPing {
+				logrus.Debug("remote side supports flow control")
+				t.dispatch.setUnbounded()
+				t._sendAck(t.flow.enable())
+			}
 		} else if metaType == "pong" {
 			logrus.Debug("got tunnel pong: ", string(msg))
 			t.lastPing = time.Now()
@@ -122,23 +190,43 @@ func (t *Tunnel) onMessage(_type int, msg []byte) {
 				logrus.WithError(err).Error("state change failed (ev: 'connected')")
 			}
 			t.connected <- nil
+		} else if metaType == "ack" {
+			if len(parts) > 1 {
+				t._onAck(parts[1])
+			}
 		} else if metaType == "EOF" {
-			t._onEOF()
-			t._checkClose()
+			// after the data we've received so far
+			t.dispatch.push(0, func() {
+				t._onEOF()
+				t._checkClose()
+			})
 		} else {
 			t._error(util.NewAPIError(util.OtherError, "Unsupported meta message: ", metaType))
 		}
 	} else if msgType == "data" {
+		t.statsLock.Lock()
 		t.bytesRead += int64(len(msg))
+		t.statsLock.Unlock()
 
 		if len(t.DataListeners) == 0 {
 			panic("Tunnel: Missing OnData handler")
 		}
 
-		// call listeners
-		for _, cb := range t.DataListeners {
-			cb(msg)
-		}
+		// call listeners (in the dispatch goroutine, see dispatchQueue)
+		t.dispatch.push(int64(len(msg)), func() {
+			if t.datagrams != nil {
+				t.datagrams.Write(msg)
+			} else {
+				for _, cb := range t.DataListeners {
+					cb(msg)
+				}
+			}
+
+			// the listeners are done with the data -> acknowledge it
+			if !t.deferAck {
+				t._ack(len(msg))
+			}
+		})
 	} else if msgType == "error" {
 		parts := strings.SplitN(string(msg), ":", 2)
 		var code int
@@ -188,11 +276,15 @@ func (t *Tunnel) _error(err util.APIError) {
 
 func (t *Tunnel) _onClose() {
 	t.writeEOF = true // no need to send an EOF over a closed tunnel
-	t._onEOF()        // always fire the EOF signal
+	t.flow.close()    // wake up blocked writers
+
+	// always fire the EOF signal (once the listeners are done with the data we've received)
+	t.dispatch.push(0, t._onEOF)
 
 	// print log message and stop timers
-	duration := time.Now().Sub(t.startTs)
-	msg := fmt.Sprintf("Tunnel closed, bytesRead=%d, bytesWritten=%d, duration=%s", t.bytesRead, t.bytesWritten, duration.String())
+	stats := t.Stats()
+	duration := time.Now().Sub(stats.StartTs)
+	msg := fmt.Sprintf("Tunnel closed, bytesRead=%d, bytesWritten=%d, duration=%s", stats.BytesRead, stats.BytesWritten, duration.String())
 	if t.Side == ClientSide {
 		logrus.Debug(msg)
 	} else if t.Side == DeviceSide {
@@ -3,6 +3,8 @@ package util
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -29,8 +31,9 @@ type APIError interface {
 }
 
 type apiErrorImpl struct {
-	msg  string
-	code int
+	msg        string
+	code       int
+	retryAfter time.Duration
 }
 
 func (e *apiErrorImpl) Error() string {
@@ -41,11 +44,52 @@ func (e *apiErrorImpl) Code() int {
 	return e.code
 }
 
+func (e *apiErrorImpl) RetryAfter() time.Duration {
+	return e.retryAfter
+}
+
 // NewAPIError -- Create an APIError instance
 func NewAPIError(code int, msg ...interface{}) APIError {
 	return &apiErrorImpl{code: code, msg: fmt.Sprint(msg...)}
 }
 
+// NewRetryAfterError -- Create an APIError that tells the caller how long to wait before trying again (see RetryAfter())
+func NewRetryAfterError(code int, retryAfter time.Duration, msg ...interface{}) APIError {
+	return &apiErrorImpl{code: code, msg: fmt.Sprint(msg...), retryAfter: retryAfter}
+}
+
+// RetryAfter -- returns how long the server wants us to wait before trying again (or 0 if it didn't tell us)
+func RetryAfter(err error) time.Duration {
+	if e, ok := err.(interface{ RetryAfter() time.Duration }); ok {
+		return e.RetryAfter()
+	}
+	return 0
+}
+
+// ParseRetryAfter -- parses the 'Retry-After' (or our own 'X-Ratelimit-Delay') response header
+//
+// 'Retry-After' may either contain a number of seconds or a HTTP date. Returns 0 if neither header is set
+func ParseRetryAfter(hdr http.Header) time.Duration {
+	if value := hdr.Get("Retry-After"); value != "" {
+		if ts, err := http.ParseTime(value); err == nil {
+			if rc := time.Until(ts); rc > 0 {
+				return rc
+			}
+			return 0
+		}
+		return _parseSeconds(value)
+	}
+	return _parseSeconds(hdr.Get("X-Ratelimit-Delay"))
+}
+
+func _parseSeconds(value string) time.Duration {
+	var seconds, err = strconv.ParseFloat(value, 64)
+	if err != nil || seconds < 0 {
+		return 0
+	}
+	return time.Duration(seconds * float64(time.Second))
+}
+
 // FailWithAPIError -- call Fatal with a nice error message matching the API error we got
 func FailWithAPIError(err APIError) {
 	if err.Code() == NotFoundError {